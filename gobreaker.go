@@ -50,6 +50,7 @@ type Counts struct {
 	TotalFailures        uint32
 	ConsecutiveSuccesses uint32
 	ConsecutiveFailures  uint32
+	TotalExclusions      uint32
 }
 
 func (c *Counts) onRequest() {
@@ -68,12 +69,17 @@ func (c *Counts) onFailure() {
 	c.ConsecutiveSuccesses = 0
 }
 
+func (c *Counts) onExclusion() {
+	c.TotalExclusions++
+}
+
 func (c *Counts) clear() {
 	c.Requests = 0
 	c.TotalSuccesses = 0
 	c.TotalFailures = 0
 	c.ConsecutiveSuccesses = 0
 	c.ConsecutiveFailures = 0
+	c.TotalExclusions = 0
 }
 
 // Settings configures CircuitBreaker:
@@ -103,6 +109,12 @@ func (c *Counts) clear() {
 // If IsSuccessful returns true, the error is counted as a success.
 // Otherwise the error is counted as a failure.
 // If IsSuccessful is nil, default IsSuccessful is used, which returns false for all non-nil errors.
+//
+// IsExcluded is called with the error returned from a request before IsSuccessful.
+// If IsExcluded returns true, the request is counted as an exclusion,
+// which is neither a success nor a failure, e.g. for errors caused by the caller rather than the dependency.
+// An excluded request doesn't count toward MaxRequests in the half-open state once it finishes.
+// If IsExcluded is nil, no request is excluded.
 type Settings struct {
 	Name          string
 	MaxRequests   uint32
@@ -111,6 +123,7 @@ type Settings struct {
 	ReadyToTrip   func(counts Counts) bool
 	OnStateChange func(name string, from State, to State)
 	IsSuccessful  func(err error) bool
+	IsExcluded    func(err error) bool
 }
 
 // CircuitBreaker is a state machine to prevent sending requests that are likely to fail.
@@ -121,6 +134,7 @@ type CircuitBreaker struct {
 	timeout       time.Duration
 	readyToTrip   func(counts Counts) bool
 	isSuccessful  func(err error) bool
+	isExcluded    func(err error) bool
 	onStateChange func(name string, from State, to State)
 
 	mutex      sync.Mutex
@@ -174,6 +188,8 @@ func NewCircuitBreaker(st Settings) *CircuitBreaker {
 		cb.isSuccessful = st.IsSuccessful
 	}
 
+	cb.isExcluded = st.IsExcluded
+
 	cb.toNewGeneration(time.Now())
 
 	return cb
@@ -234,16 +250,39 @@ func (cb *CircuitBreaker) Execute(req func() (interface{}, error)) (interface{},
 	defer func() {
 		e := recover()
 		if e != nil {
-			cb.afterRequest(generation, false)
+			cb.afterRequest(generation, resultFailure)
 			panic(e)
 		}
 	}()
 
 	result, err := req()
-	cb.afterRequest(generation, cb.isSuccessful(err))
+	cb.afterRequest(generation, cb.classify(err))
 	return result, err
 }
 
+// result is the classification of the outcome of a request.
+type result int
+
+const (
+	resultSuccess result = iota
+	resultFailure
+	resultExclusion
+)
+
+func resultOf(success bool) result {
+	if success {
+		return resultSuccess
+	}
+	return resultFailure
+}
+
+func (cb *CircuitBreaker) classify(err error) result {
+	if cb.isExcluded != nil && cb.isExcluded(err) {
+		return resultExclusion
+	}
+	return resultOf(cb.isSuccessful(err))
+}
+
 // Name returns the name of the TwoStepCircuitBreaker.
 func (tscb *TwoStepCircuitBreaker) Name() string {
 	return tscb.cb.Name()
@@ -269,7 +308,7 @@ func (tscb *TwoStepCircuitBreaker) Allow() (done func(success bool), err error)
 	}
 
 	return func(success bool) {
-		tscb.cb.afterRequest(generation, success)
+		tscb.cb.afterRequest(generation, resultOf(success))
 	}, nil
 }
 
@@ -282,7 +321,7 @@ func (cb *CircuitBreaker) beforeRequest() (uint64, error) {
 
 	if state == StateOpen {
 		return generation, ErrOpenState
-	} else if state == StateHalfOpen && cb.counts.Requests >= cb.maxRequests {
+	} else if state == StateHalfOpen && cb.counts.Requests-cb.counts.TotalExclusions >= cb.maxRequests {
 		return generation, ErrTooManyRequests
 	}
 
@@ -290,7 +329,7 @@ func (cb *CircuitBreaker) beforeRequest() (uint64, error) {
 	return generation, nil
 }
 
-func (cb *CircuitBreaker) afterRequest(before uint64, success bool) {
+func (cb *CircuitBreaker) afterRequest(before uint64, res result) {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
@@ -300,10 +339,13 @@ func (cb *CircuitBreaker) afterRequest(before uint64, success bool) {
 		return
 	}
 
-	if success {
+	switch res {
+	case resultSuccess:
 		cb.onSuccess(state, now)
-	} else {
+	case resultFailure:
 		cb.onFailure(state, now)
+	default:
+		cb.counts.onExclusion()
 	}
 }
 
@@ -0,0 +1,53 @@
+package gobreaker
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// apdex counts the requests in the bands of Apdex for Metrics.
+type apdex struct {
+	target     time.Duration
+	tolerating time.Duration
+
+	satisfied  atomic.Uint64
+	tolerated  atomic.Uint64
+	frustrated atomic.Uint64
+}
+
+// newApdex returns a new apdex with the thresholds of Settings,
+// or nil if Apdex is not measured.
+func newApdex(target, tolerating time.Duration) *apdex {
+	if target <= 0 {
+		return nil
+	}
+	if tolerating < target {
+		tolerating = 4 * target
+	}
+	return &apdex{target: target, tolerating: tolerating}
+}
+
+// observe counts the request of the given outcome that took d.
+func (a *apdex) observe(o Outcome, d time.Duration) {
+	switch {
+	case o == OutcomeExcluded:
+	case o == OutcomeFailure || d > a.tolerating:
+		a.frustrated.Add(1)
+	case d > a.target:
+		a.tolerated.Add(1)
+	default:
+		a.satisfied.Add(1)
+	}
+}
+
+// metrics sets the Apdex of m.
+func (a *apdex) metrics(m *Metrics) {
+	m.Satisfied = a.satisfied.Load()
+	m.Tolerating = a.tolerated.Load()
+	m.Frustrated = a.frustrated.Load()
+
+	total := m.Satisfied + m.Tolerating + m.Frustrated
+	if total > 0 {
+		m.Apdex = (float64(m.Satisfied) + float64(m.Tolerating)/2) / float64(total)
+	}
+}
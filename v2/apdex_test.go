@@ -0,0 +1,56 @@
+package gobreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApdex(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{
+		ApdexTarget:     100 * time.Millisecond,
+		ApdexTolerating: 300 * time.Millisecond,
+		IsExcluded:      isExcluded,
+		Clock:           clock,
+	})
+	assert.Equal(t, Metrics{}, cb.Metrics())
+
+	request := func(d time.Duration, err error) {
+		cb.Execute(func() (bool, error) {
+			clock.advance(d)
+			return err == nil, err
+		})
+	}
+	request(50*time.Millisecond, nil)
+	request(100*time.Millisecond, nil)
+	request(200*time.Millisecond, nil)
+	request(300*time.Millisecond, nil)
+	request(400*time.Millisecond, nil)
+	request(10*time.Millisecond, errors.New("fail"))
+	request(time.Second, errExcluded)
+
+	m := cb.Metrics()
+	assert.Equal(t, uint64(2), m.Satisfied)
+	assert.Equal(t, uint64(2), m.Tolerating)
+	assert.Equal(t, uint64(2), m.Frustrated)
+	assert.Equal(t, 0.5, m.Apdex)
+}
+
+func TestApdexDefaultTolerating(t *testing.T) {
+	a := newApdex(100*time.Millisecond, 0)
+	assert.Equal(t, 400*time.Millisecond, a.tolerating)
+
+	a.observe(OutcomeSuccess, 400*time.Millisecond)
+	a.observe(OutcomeSuccess, 401*time.Millisecond)
+	a.observe(OutcomeSuccess, 0)
+	a.observe(OutcomeSuccess, 0)
+
+	var m Metrics
+	a.metrics(&m)
+	assert.Equal(t, Metrics{Satisfied: 2, Tolerating: 1, Frustrated: 1, Apdex: 0.625}, m)
+
+	assert.Nil(t, newApdex(0, time.Second))
+}
@@ -0,0 +1,104 @@
+package gobreaker
+
+import "time"
+
+// AllowN checks if a batch of n requests can proceed, e.g. n work items dispatched at once
+// against the same dependency, taking the lock of the CircuitBreaker once rather than n times.
+// The batch is admitted or rejected as a whole: AllowN returns ErrTooManyRequests if the free slots
+// of the half-open state are fewer than n, and ErrTooManyConcurrentRequests if n more requests
+// would exceed MaxConcurrentRequests. HalfOpenProbeRatio and RampUpPeriod sample the batch as if it were
+// a single request, and ObserveOnly admits the batch in the same way as a single request.
+// Once admitted, the batch is counted as n requests.
+//
+// The returned callback records the outcomes of the batch at once, one per error of results,
+// which are classified by Classifiers, IsExcluded and IsSuccessful like the errors of StreamAllow.
+// The errors beyond n are ignored, and the requests without an error in results are counted as exclusions.
+// If n is less than 1, AllowN is the same as Allow for a single request.
+func (tscb *TwoStepCircuitBreaker[T]) AllowN(n int) (done func(results []error), err error) {
+	n = max(n, 1)
+	_, generation, age, err := tscb.cb.admitN(n)
+	if err != nil {
+		return nil, err
+	}
+
+	cb := tscb.cb
+	start := cb.startTime()
+	return func(results []error) {
+		if generation == bypassGeneration {
+			return
+		}
+
+		var freed []*halfOpenGate
+		defer func() {
+			for _, gate := range freed {
+				gate.release()
+			}
+		}()
+
+		cb.mutex.Lock()
+		defer cb.unlock()
+
+		for i := 0; i < n; i++ {
+			var gate *halfOpenGate
+			if i < len(results) {
+				gate = cb.recordOutcome(generation, age, cb.classifyError(results[i]), results[i], start)
+			} else {
+				gate = cb.recordOutcome(generation, age, OutcomeExcluded, nil, start)
+			}
+			if gate != nil {
+				freed = append(freed, gate)
+			}
+		}
+	}, nil
+}
+
+// admitBatchAt admits or rejects a batch of n requests at the given time like admitAt.
+// The first request goes through admitAt, after the capacity for the whole batch is checked,
+// and the others take the rest of the capacity.
+// It must be called with the write lock held.
+func (cb *CircuitBreaker[T]) admitBatchAt(now time.Time, n int) (State, uint64, uint64, error) {
+	state, generation, age := cb.currentState(now)
+	if err := cb.batchFits(state, n); err != nil {
+		if !cb.observeOnly {
+			return state, generation, age, err
+		}
+		cb.wouldReject(err)
+	}
+
+	state, generation, age, err := cb.admitAt(now, nil)
+	if err != nil {
+		return state, generation, age, err
+	}
+	for i := 1; i < n; i++ {
+		if state == StateOpen {
+			// The requests admitted by ObserveOnly in the open state are not counted.
+			cb.inFlight++
+			continue
+		}
+		if gate := cb.halfOpenGate.Load(); state == StateHalfOpen && cb.probeGated() && !gate.tryAcquire() {
+			cb.saturated = true
+			gate.occupy()
+		}
+		cb.countAdmission(state, age)
+	}
+	return state, generation, age, nil
+}
+
+// batchFits returns the error to reject a batch of n requests in the given state for the lack of capacity,
+// or nil if the batch fits.
+func (cb *CircuitBreaker[T]) batchFits(state State, n int) error {
+	switch state {
+	case StateOpen, StateForcedOpen:
+		// admitAt rejects the batch by the state.
+		return nil
+	}
+
+	if cb.maxConcurrent > 0 && state != StateForcedClosed && uint64(cb.inFlight)+uint64(n) > uint64(cb.maxConcurrent) {
+		return ErrTooManyConcurrentRequests
+	}
+	if state == StateHalfOpen && cb.probeGated() && cb.halfOpenGate.Load().free() < n {
+		cb.saturated = true
+		return ErrTooManyRequests
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package gobreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowN(t *testing.T) {
+	clock := newFakeClock()
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{MaxRequests: 3, Clock: clock})
+
+	done, err := tscb.AllowN(3)
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{3, 0, 0, 0, 0, 0, 0}, tscb.Counts())
+	done([]error{nil, errors.New("fail"), nil})
+	assert.Equal(t, Counts{3, 2, 1, 1, 0, 0, 1}, tscb.Counts())
+
+	// the requests without an error are counted as exclusions
+	done, err = tscb.AllowN(2)
+	assert.NoError(t, err)
+	done(nil)
+	assert.Equal(t, Counts{5, 2, 1, 1, 0, 2, 1}, tscb.Counts())
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail2Step(tscb))
+	}
+	_, err = tscb.AllowN(2)
+	assert.Equal(t, ErrOpenState, err)
+
+	// the whole batch must fit in the slots of the half-open state
+	clock.advance(defaultTimeout + time.Second)
+	_, err = tscb.AllowN(4)
+	assert.Equal(t, ErrTooManyRequests, err)
+	assert.Equal(t, Counts{}, tscb.Counts())
+
+	done, err = tscb.AllowN(3)
+	assert.NoError(t, err)
+	_, err = tscb.Allow()
+	assert.Equal(t, ErrTooManyRequests, err)
+	done([]error{nil, nil, nil})
+	assert.Equal(t, StateClosed, tscb.State())
+}
+
+func TestAllowNMaxConcurrentRequests(t *testing.T) {
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{MaxConcurrentRequests: 4})
+
+	done, err := tscb.AllowN(3)
+	assert.NoError(t, err)
+	_, err = tscb.AllowN(2)
+	assert.Equal(t, ErrTooManyConcurrentRequests, err)
+
+	done([]error{nil, nil, nil})
+	done, err = tscb.AllowN(4)
+	assert.NoError(t, err)
+	done([]error{nil, nil, nil, nil})
+	assert.Equal(t, Counts{7, 7, 0, 7, 0, 0, 0}, tscb.Counts())
+}
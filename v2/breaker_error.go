@@ -0,0 +1,49 @@
+package gobreaker
+
+import "fmt"
+
+// BreakerError is the error returned by Execute, ExecuteWithClassifier and ExecuteContext
+// with Settings.WrapErrors, telling from the error alone what the CircuitBreaker did with the request.
+// Name is the name of the CircuitBreaker and State is the state in which the request was admitted or rejected.
+// If ShortCircuited is true, the CircuitBreaker rejected the request without running it
+// and Cause is the rejection error, e.g. ErrOpenState.
+// Otherwise Cause is the error returned from the request, which was counted as Outcome.
+// BreakerError unwraps to Cause, so that errors.Is(err, ErrOpenState) keeps working.
+type BreakerError struct {
+	Name           string
+	State          State
+	Cause          error
+	ShortCircuited bool
+	Outcome        Outcome
+}
+
+// Error implements error interface.
+func (e *BreakerError) Error() string {
+	if e.ShortCircuited {
+		return fmt.Sprintf("circuit breaker %q rejected the request in the %s state: %v", e.Name, e.State, e.Cause)
+	}
+	return fmt.Sprintf("circuit breaker %q counted the request as %s in the %s state: %v", e.Name, e.Outcome, e.State, e.Cause)
+}
+
+// Unwrap returns Cause.
+func (e *BreakerError) Unwrap() error {
+	return e.Cause
+}
+
+// rejectionError returns the error of a request rejected in the given state,
+// which is wrapped in BreakerError with Settings.WrapErrors.
+func (cb *CircuitBreaker[T]) rejectionError(state State, err error) error {
+	if !cb.wrapErrors {
+		return err
+	}
+	return &BreakerError{Name: cb.name, State: state, Cause: err, ShortCircuited: true}
+}
+
+// requestError returns the error of a request admitted in the given state and counted as o,
+// which is wrapped in BreakerError with Settings.WrapErrors if it is not nil.
+func (cb *CircuitBreaker[T]) requestError(state State, o Outcome, err error) error {
+	if !cb.wrapErrors || err == nil {
+		return err
+	}
+	return &BreakerError{Name: cb.name, State: state, Cause: err, Outcome: o}
+}
@@ -0,0 +1,83 @@
+package gobreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapErrors(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{Name: "cb", WrapErrors: true, IsExcluded: isExcluded})
+
+	_, err := cb.Execute(func() (bool, error) { return true, nil })
+	assert.NoError(t, err)
+
+	_, err = cb.Execute(func() (bool, error) { return false, errExcluded })
+	var be *BreakerError
+	assert.True(t, errors.As(err, &be))
+	assert.Equal(t, &BreakerError{Name: "cb", State: StateClosed, Cause: errExcluded, Outcome: OutcomeExcluded}, be)
+	assert.ErrorIs(t, err, errExcluded)
+
+	errFailed := errors.New("failed")
+	for i := 0; i < 6; i++ {
+		_, err = cb.Execute(func() (bool, error) { return false, errFailed })
+	}
+	assert.True(t, errors.As(err, &be))
+	assert.Equal(t, &BreakerError{Name: "cb", State: StateClosed, Cause: errFailed, Outcome: OutcomeFailure}, be)
+	assert.Equal(t, `circuit breaker "cb" counted the request as failure in the closed state: failed`, err.Error())
+
+	// the rejections are short-circuited
+	_, err = cb.Execute(func() (bool, error) { return true, nil })
+	assert.True(t, errors.As(err, &be))
+	assert.Equal(t, &BreakerError{Name: "cb", State: StateOpen, Cause: ErrOpenState, ShortCircuited: true}, be)
+	assert.ErrorIs(t, err, ErrOpenState)
+	assert.Equal(t, `circuit breaker "cb" rejected the request in the open state: circuit breaker is open`, err.Error())
+
+	_, err = cb.ExecuteContext(context.Background(), func(ctx context.Context) (bool, error) { return true, nil })
+	assert.ErrorIs(t, err, ErrOpenState)
+	assert.True(t, errors.As(err, &be))
+	assert.True(t, be.ShortCircuited)
+
+	// the errors are returned as they are by default
+	cb = NewCircuitBreaker[bool](Settings{})
+	_, err = cb.Execute(func() (bool, error) { return false, errFailed })
+	assert.Equal(t, errFailed, err)
+}
+
+func TestWrapErrorsExecuteWithRetry(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{Name: "cb", WrapErrors: true})
+	errFailed := errors.New("failed")
+	var be *BreakerError
+	for i := 0; i < 3; i++ {
+		_, err := cb.ExecuteWithRetry(context.Background(), RetryPolicy{MaxAttempts: 2}, func(ctx context.Context) (bool, error) {
+			return false, errFailed
+		})
+		assert.True(t, errors.As(err, &be))
+		assert.Equal(t, &BreakerError{Name: "cb", State: StateClosed, Cause: errFailed, Outcome: OutcomeFailure}, be)
+	}
+
+	_, err := cb.ExecuteWithRetry(context.Background(), RetryPolicy{}, func(ctx context.Context) (bool, error) { return true, nil })
+	assert.True(t, errors.As(err, &be))
+	assert.Equal(t, &BreakerError{Name: "cb", State: StateOpen, Cause: ErrOpenState, ShortCircuited: true}, be)
+}
+
+func TestWrapErrorsDistributedOpenStateCache(t *testing.T) {
+	cache := newMapCache()
+	settings := Settings{Name: "cached", WrapErrors: true, Clock: newFakeClock()}
+	dcb, err := NewDistributedCircuitBreaker[any](NewCacheStore(cache.get, cache.set), settings,
+		WithOpenStateCache(10*time.Second))
+	assert.NoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		_, err = dcb.Execute(func() (any, error) { return nil, errors.New("failed") })
+	}
+	// the rejections read from the store and from the cached open state are wrapped alike
+	for i := 0; i < 3; i++ {
+		var be *BreakerError
+		assert.True(t, errors.As(successRequest(dcb), &be))
+		assert.Equal(t, &BreakerError{Name: "cached", State: StateOpen, Cause: ErrOpenState, ShortCircuited: true}, be)
+	}
+}
@@ -0,0 +1,25 @@
+package breakerhttp
+
+import (
+	"net/http"
+
+	"github.com/sony/gobreaker/v2"
+)
+
+// NewHTTPClient returns a new http.Client that sends requests with http.DefaultTransport
+// through a new CircuitBreaker configured with st.
+// The round trips are classified by DefaultClassifier unless opts set another Classifier.
+// CircuitBreakerOf returns the CircuitBreaker of the client, e.g. to inspect its state.
+func NewHTTPClient(st gobreaker.Settings, opts ...Option) *http.Client {
+	cb := gobreaker.NewCircuitBreaker[*http.Response](st)
+	return &http.Client{Transport: NewRoundTripper(cb, nil, opts...)}
+}
+
+// CircuitBreakerOf returns the CircuitBreaker that the Transport of client sends requests through,
+// or nil if the Transport is not a RoundTripper.
+func CircuitBreakerOf(client *http.Client) *gobreaker.CircuitBreaker[*http.Response] {
+	if rt, ok := client.Transport.(*RoundTripper); ok {
+		return rt.cb
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package breakerhttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sony/gobreaker/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(gobreaker.Settings{
+		Name:    "server",
+		Timeout: 10 * time.Millisecond,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= 3
+		},
+	})
+	cb := CircuitBreakerOf(client)
+	assert.NotNil(t, cb)
+	assert.Equal(t, "server", cb.Name())
+
+	get := func() (*http.Response, error) {
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, err := get()
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	}
+	assert.Equal(t, gobreaker.StateOpen, cb.State())
+
+	_, err := get()
+	assert.True(t, errors.Is(err, gobreaker.ErrOpenState))
+
+	status.Store(http.StatusOK)
+	time.Sleep(20 * time.Millisecond)
+	resp, err := get()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, gobreaker.StateClosed, cb.State())
+}
+
+func TestCircuitBreakerOf(t *testing.T) {
+	assert.Nil(t, CircuitBreakerOf(http.DefaultClient))
+	assert.Nil(t, CircuitBreakerOf(&http.Client{Transport: http.DefaultTransport}))
+}
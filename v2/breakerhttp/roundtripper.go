@@ -0,0 +1,167 @@
+// Package breakerhttp provides an http.RoundTripper that sends requests through a CircuitBreaker.
+package breakerhttp
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/sony/gobreaker/v2"
+)
+
+// Classifier determines how the response and the error of a round trip are counted.
+type Classifier func(resp *http.Response, err error) gobreaker.Outcome
+
+// DefaultClassifier counts transport errors and 5xx responses as failures
+// and any other responses, including 4xx responses, as successes.
+func DefaultClassifier(resp *http.Response, err error) gobreaker.Outcome {
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		return gobreaker.OutcomeFailure
+	}
+	return gobreaker.OutcomeSuccess
+}
+
+// StatusClassifier returns a Classifier that counts the responses with the status codes in outcomes
+// as mapped, and the other round trips as DefaultClassifier does.
+// For example, mapping http.StatusTooManyRequests to gobreaker.OutcomeExcluded keeps
+// the CircuitBreaker and the rate limiter of the upstream from fighting each other,
+// and mapping it to gobreaker.OutcomeFailure makes the CircuitBreaker back off instead.
+func StatusClassifier(outcomes map[int]gobreaker.Outcome) Classifier {
+	return func(resp *http.Response, err error) gobreaker.Outcome {
+		if err == nil {
+			if o, ok := outcomes[resp.StatusCode]; ok {
+				return o
+			}
+		}
+		return DefaultClassifier(resp, err)
+	}
+}
+
+// StatusIsSuccessful returns a function that reports whether resp is successful,
+// that is, resp is not nil and its status code is less than failureFrom,
+// e.g. http.StatusInternalServerError to count 5xx responses as failures.
+// It helps to write Settings.IsSuccessfulResult of a CircuitBreaker of *http.Response:
+//
+//	isSuccessful := breakerhttp.StatusIsSuccessful(http.StatusInternalServerError)
+//	st.IsSuccessfulResult = func(result any, err error) bool {
+//		resp, _ := result.(*http.Response)
+//		return err == nil && isSuccessful(resp)
+//	}
+func StatusIsSuccessful(failureFrom int) func(resp *http.Response) bool {
+	return func(resp *http.Response) bool {
+		return resp != nil && resp.StatusCode < failureFrom
+	}
+}
+
+// RejectedHeader is the header of the response synthesized for a rejected request by WithUnavailableResponse,
+// whose value is the error of the rejection, e.g. "circuit breaker is open".
+const RejectedHeader = "X-Circuit-Breaker-Rejected"
+
+// RoundTripper is an http.RoundTripper that sends each request through a CircuitBreaker.
+type RoundTripper struct {
+	cb          *gobreaker.CircuitBreaker[*http.Response]
+	next        http.RoundTripper
+	classify    Classifier
+	unavailable bool
+}
+
+// Option configures RoundTripper.
+type Option func(*RoundTripper)
+
+// WithClassifier sets the Classifier of the round trips. The default is DefaultClassifier.
+func WithClassifier(classify Classifier) Option {
+	return func(rt *RoundTripper) {
+		rt.classify = classify
+	}
+}
+
+// WithUnavailableResponse makes RoundTripper respond to a rejected request with a synthesized response
+// of status 503 Service Unavailable and RejectedHeader instead of returning the error of the rejection,
+// e.g. for a reverse proxy that passes the response on to its client.
+func WithUnavailableResponse() Option {
+	return func(rt *RoundTripper) {
+		rt.unavailable = true
+	}
+}
+
+// NewRoundTripper returns a new RoundTripper that sends requests with next through cb.
+// If next is nil, http.DefaultTransport is used.
+// The round trips are classified by the Classifier of RoundTripper instead of the classifiers of
+// the Settings of cb.
+func NewRoundTripper(cb *gobreaker.CircuitBreaker[*http.Response], next http.RoundTripper, opts ...Option) *RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	rt := &RoundTripper{
+		cb:       cb,
+		next:     next,
+		classify: DefaultClassifier,
+	}
+	for _, opt := range opts {
+		opt(rt)
+	}
+	return rt
+}
+
+// RoundTrip implements http.RoundTripper.
+// If the CircuitBreaker rejects the request, RoundTrip closes the body of the request
+// and returns the error of the rejection, or the response of WithUnavailableResponse.
+// If the context of the request is already done, RoundTrip returns its error without sending the request,
+// and a round trip that fails after the context is done is counted as an exclusion,
+// since the caller rather than the upstream cut it off.
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if err := ctx.Err(); err != nil {
+		closeBody(req)
+		return nil, err
+	}
+
+	sent := false
+	resp, err := rt.cb.ExecuteWithClassifier(func() (*http.Response, error) {
+		sent = true
+		return rt.next.RoundTrip(req)
+	}, func(resp *http.Response, err error) gobreaker.Outcome {
+		if err != nil && ctx.Err() != nil {
+			return gobreaker.OutcomeExcluded
+		}
+		return rt.classify(resp, err)
+	})
+	if sent || err == nil {
+		return resp, err
+	}
+
+	// The request was rejected. The response given by Settings.RejectValue, if any, is discarded.
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+	closeBody(req)
+	if rt.unavailable {
+		return unavailableResponse(req, err), nil
+	}
+	return nil, err
+}
+
+// closeBody closes the body of the request that is not sent, as http.RoundTripper must.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// unavailableResponse returns the response of status 503 to the request rejected with err.
+func unavailableResponse(req *http.Request, err error) *http.Response {
+	header := make(http.Header)
+	header.Set(RejectedHeader, err.Error())
+	header.Set("Content-Length", "0")
+	return &http.Response{
+		Status:        strconv.Itoa(http.StatusServiceUnavailable) + " " + http.StatusText(http.StatusServiceUnavailable),
+		StatusCode:    http.StatusServiceUnavailable,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          http.NoBody,
+		ContentLength: 0,
+		Request:       req,
+	}
+}
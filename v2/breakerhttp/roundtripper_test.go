@@ -0,0 +1,173 @@
+package breakerhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sony/gobreaker/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultClassifier(t *testing.T) {
+	for status, o := range map[int]gobreaker.Outcome{
+		http.StatusOK:                  gobreaker.OutcomeSuccess,
+		http.StatusNoContent:           gobreaker.OutcomeSuccess,
+		http.StatusFound:               gobreaker.OutcomeSuccess,
+		http.StatusNotFound:            gobreaker.OutcomeSuccess,
+		http.StatusTooManyRequests:     gobreaker.OutcomeSuccess,
+		http.StatusInternalServerError: gobreaker.OutcomeFailure,
+		http.StatusServiceUnavailable:  gobreaker.OutcomeFailure,
+	} {
+		assert.Equal(t, o, DefaultClassifier(&http.Response{StatusCode: status}, nil), status)
+	}
+	assert.Equal(t, gobreaker.OutcomeFailure, DefaultClassifier(nil, errors.New("connection refused")))
+}
+
+func TestStatusClassifier(t *testing.T) {
+	classify := StatusClassifier(map[int]gobreaker.Outcome{
+		http.StatusNotFound:           gobreaker.OutcomeFailure,
+		http.StatusTooManyRequests:    gobreaker.OutcomeExcluded,
+		http.StatusServiceUnavailable: gobreaker.OutcomeSuccess,
+	})
+
+	for status, o := range map[int]gobreaker.Outcome{
+		http.StatusOK:                  gobreaker.OutcomeSuccess,
+		http.StatusNotFound:            gobreaker.OutcomeFailure,
+		http.StatusTooManyRequests:     gobreaker.OutcomeExcluded,
+		http.StatusServiceUnavailable:  gobreaker.OutcomeSuccess,
+		http.StatusInternalServerError: gobreaker.OutcomeFailure,
+	} {
+		assert.Equal(t, o, classify(&http.Response{StatusCode: status}, nil), status)
+	}
+	assert.Equal(t, gobreaker.OutcomeFailure, classify(nil, errors.New("connection refused")))
+}
+
+func TestStatusIsSuccessful(t *testing.T) {
+	isSuccessful := StatusIsSuccessful(http.StatusInternalServerError)
+	for status, successful := range map[int]bool{
+		http.StatusOK:                  true,
+		http.StatusNotFound:            true,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: false,
+		http.StatusServiceUnavailable:  false,
+	} {
+		assert.Equal(t, successful, isSuccessful(&http.Response{StatusCode: status}), status)
+	}
+	assert.False(t, isSuccessful(nil))
+
+	isSuccessful = StatusIsSuccessful(http.StatusBadRequest)
+	assert.False(t, isSuccessful(&http.Response{StatusCode: http.StatusNotFound}))
+	assert.True(t, isSuccessful(&http.Response{StatusCode: http.StatusFound}))
+}
+
+func TestRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	cb := gobreaker.NewCircuitBreaker[*http.Response](gobreaker.Settings{
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= 2
+		},
+	})
+	client := &http.Client{Transport: NewRoundTripper(cb, nil, WithClassifier(StatusClassifier(map[int]gobreaker.Outcome{
+		http.StatusTooManyRequests: gobreaker.OutcomeExcluded,
+	})))}
+
+	get := func(status int) (*http.Response, error) {
+		resp, err := client.Get(server.URL + "?status=" + strconv.Itoa(status))
+		if err == nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	resp, err := get(http.StatusOK)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = get(http.StatusTooManyRequests)
+	assert.NoError(t, err)
+	_, err = get(http.StatusInternalServerError)
+	assert.NoError(t, err)
+	assert.Equal(t, gobreaker.Counts{Requests: 3, TotalSuccesses: 1, TotalFailures: 1, ConsecutiveFailures: 1, TotalExclusions: 1, TotalFailureWeight: 1}, cb.Counts())
+
+	_, err = get(http.StatusBadGateway)
+	assert.NoError(t, err)
+	assert.Equal(t, gobreaker.StateOpen, cb.State())
+
+	_, err = get(http.StatusOK)
+	assert.ErrorIs(t, err, gobreaker.ErrOpenState)
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeRecorder) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestRoundTripperRejection(t *testing.T) {
+	cb := gobreaker.NewCircuitBreaker[*http.Response](gobreaker.Settings{})
+	cb.ForceOpen()
+	sent := false
+	next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent = true
+		return nil, errors.New("unreachable")
+	})
+
+	body := &closeRecorder{Reader: strings.NewReader("payload")}
+	req := httptest.NewRequest(http.MethodPost, "http://example.com", body)
+	resp, err := NewRoundTripper(cb, next).RoundTrip(req)
+	assert.Nil(t, resp)
+	assert.Equal(t, gobreaker.ErrOpenState, err)
+	assert.True(t, body.closed)
+
+	body = &closeRecorder{Reader: strings.NewReader("payload")}
+	req = httptest.NewRequest(http.MethodPost, "http://example.com", body)
+	resp, err = NewRoundTripper(cb, next, WithUnavailableResponse()).RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "503 Service Unavailable", resp.Status)
+	assert.Equal(t, "circuit breaker is open", resp.Header.Get(RejectedHeader))
+	assert.Equal(t, req, resp.Request)
+	assert.True(t, body.closed)
+	assert.False(t, sent)
+}
+
+func TestRoundTripperContext(t *testing.T) {
+	cb := gobreaker.NewCircuitBreaker[*http.Response](gobreaker.Settings{})
+	ctx, cancel := context.WithCancel(context.Background())
+	next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		cancel()
+		return nil, req.Context().Err()
+	})
+	rt := NewRoundTripper(cb, next)
+
+	// the round trip cut off by the cancellation is an exclusion
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil).WithContext(ctx)
+	_, err := rt.RoundTrip(req)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, gobreaker.Counts{Requests: 1, TotalExclusions: 1}, cb.Counts())
+
+	// the request of a done context is not sent nor counted
+	_, err = rt.RoundTrip(req)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, gobreaker.Counts{Requests: 1, TotalExclusions: 1}, cb.Counts())
+}
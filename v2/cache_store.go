@@ -0,0 +1,115 @@
+package gobreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLocked is returned by CacheStore when the lock is already held.
+var ErrLocked = errors.New("already locked")
+
+// CacheStore is a SharedDataStore backed by a generic key-value cache.
+// It lets DistributedCircuitBreaker use any cache with get and set operations
+// without implementing a full SharedDataStore.
+type CacheStore struct {
+	ctx    context.Context
+	get    func(ctx context.Context, key string) ([]byte, error)
+	set    func(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	lock   func(ctx context.Context, key string) error
+	unlock func(ctx context.Context, key string) error
+	ttl    time.Duration
+
+	mutex  sync.Mutex
+	locked map[string]bool
+}
+
+// CacheStoreOption configures CacheStore.
+type CacheStoreOption func(*CacheStore)
+
+// WithCacheTTL sets the expiration passed to set, so that the state of an idle breaker expires.
+// The TTL should be longer than Interval and Timeout of the breaker to avoid losing live state.
+// If the TTL is 0, which is the default, the state never expires.
+func WithCacheTTL(ttl time.Duration) CacheStoreOption {
+	return func(cs *CacheStore) {
+		cs.ttl = ttl
+	}
+}
+
+// WithCacheLock sets the functions to acquire and release a distributed lock.
+// lock should return an error without blocking if the lock is already held.
+// Without this option, CacheStore uses a local lock, which excludes only
+// the breakers in the same process.
+func WithCacheLock(lock, unlock func(ctx context.Context, key string) error) CacheStoreOption {
+	return func(cs *CacheStore) {
+		cs.lock = lock
+		cs.unlock = unlock
+	}
+}
+
+// WithCacheContext sets the context passed to the cache functions.
+// The default is context.Background().
+func WithCacheContext(ctx context.Context) CacheStoreOption {
+	return func(cs *CacheStore) {
+		cs.ctx = ctx
+	}
+}
+
+// NewCacheStore returns a new CacheStore that reads and writes data with get and set.
+// get should return empty data if the key doesn't exist.
+func NewCacheStore(
+	get func(ctx context.Context, key string) ([]byte, error),
+	set func(ctx context.Context, key string, value []byte, ttl time.Duration) error,
+	opts ...CacheStoreOption,
+) *CacheStore {
+	cs := &CacheStore{
+		ctx:    context.Background(),
+		get:    get,
+		set:    set,
+		locked: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(cs)
+	}
+	return cs
+}
+
+// Lock acquires the lock of the given name.
+func (cs *CacheStore) Lock(name string) error {
+	if cs.lock != nil {
+		return cs.lock(cs.ctx, name)
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if cs.locked[name] {
+		return ErrLocked
+	}
+	cs.locked[name] = true
+	return nil
+}
+
+// Unlock releases the lock of the given name.
+func (cs *CacheStore) Unlock(name string) error {
+	if cs.unlock != nil {
+		return cs.unlock(cs.ctx, name)
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	delete(cs.locked, name)
+	return nil
+}
+
+// GetData returns the data of the given name.
+func (cs *CacheStore) GetData(name string) ([]byte, error) {
+	return cs.get(cs.ctx, name)
+}
+
+// SetData stores the data of the given name with the TTL of the CacheStore.
+func (cs *CacheStore) SetData(name string, data []byte) error {
+	return cs.set(cs.ctx, name, data, cs.ttl)
+}
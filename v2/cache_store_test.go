@@ -0,0 +1,91 @@
+package gobreaker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mapCache struct {
+	mutex sync.Mutex
+	data  map[string][]byte
+	ttls  map[string]time.Duration
+}
+
+func newMapCache() *mapCache {
+	return &mapCache{data: map[string][]byte{}, ttls: map[string]time.Duration{}}
+}
+
+func (c *mapCache) get(ctx context.Context, key string) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.data[key], nil
+}
+
+func (c *mapCache) set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.data[key] = value
+	c.ttls[key] = ttl
+	return nil
+}
+
+func TestCacheStore(t *testing.T) {
+	cache := newMapCache()
+	store := NewCacheStore(cache.get, cache.set, WithCacheTTL(time.Hour))
+
+	dcb, err := NewDistributedCircuitBreaker[any](store, Settings{Name: "cache"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, cache.ttls[dcb.sharedStateKey()])
+
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, failRequest(dcb))
+	}
+	assertState(t, dcb, StateOpen)
+
+	// another instance sees the shared state
+	other, err := NewDistributedCircuitBreaker[any](NewCacheStore(cache.get, cache.set), Settings{Name: "cache"})
+	assert.NoError(t, err)
+	assertState(t, other, StateOpen)
+	assert.Equal(t, time.Duration(0), cache.ttls[dcb.sharedStateKey()])
+}
+
+func TestCacheStoreLocalLock(t *testing.T) {
+	cache := newMapCache()
+	store := NewCacheStore(cache.get, cache.set)
+
+	assert.NoError(t, store.Lock("a"))
+	assert.Equal(t, ErrLocked, store.Lock("a"))
+	assert.NoError(t, store.Lock("b"))
+	assert.NoError(t, store.Unlock("a"))
+	assert.NoError(t, store.Lock("a"))
+}
+
+func TestCacheStoreCustomLock(t *testing.T) {
+	cache := newMapCache()
+
+	var calls []string
+	lock := func(ctx context.Context, key string) error {
+		assert.Equal(t, "value", ctx.Value(ctxKey{}))
+		calls = append(calls, "lock "+key)
+		return nil
+	}
+	unlock := func(ctx context.Context, key string) error {
+		calls = append(calls, "unlock "+key)
+		return nil
+	}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	store := NewCacheStore(cache.get, cache.set, WithCacheLock(lock, unlock), WithCacheContext(ctx))
+
+	assert.NoError(t, store.Lock("a"))
+	assert.NoError(t, store.Lock("a"))
+	assert.NoError(t, store.Unlock("a"))
+	assert.Equal(t, []string{"lock a", "lock a", "unlock a"}, calls)
+}
+
+type ctxKey struct{}
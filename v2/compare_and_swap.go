@@ -0,0 +1,199 @@
+package gobreaker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CompareAndSwapStore is a SharedDataStore that can update data optimistically,
+// e.g. with Redis WATCH and MULTI or an etcd transaction.
+// DistributedCircuitBreaker with CompareAndSwapStore updates the shared state without Lock and Unlock,
+// retrying an update that conflicts with another instance up to the attempts of WithCompareAndSwapAttempts
+// before falling back to Lock and Unlock. The attempts are 0 by default, so that the optimistic update is opt-in.
+//
+// CompareAndSwap sets the data of the given name to new if the current data is old,
+// and reports whether it did. It returns false without an error if the current data is different.
+type CompareAndSwapStore interface {
+	SharedDataStore
+	CompareAndSwap(name string, old, new []byte) (bool, error)
+}
+
+const defaultCompareAndSwapAttempts = 0
+
+// WithCompareAndSwapAttempts sets how many times Execute tries to update the shared state
+// with CompareAndSwapStore before falling back to Lock and Unlock.
+// If attempts is less than or equal to 0, Execute always uses Lock and Unlock.
+// The default is 0 attempts. It has no effect on the stores that don't implement CompareAndSwapStore.
+func WithCompareAndSwapAttempts(attempts int) DistributedOption {
+	return func(o *distributedOptions) {
+		o.casAttempts = attempts
+	}
+}
+
+// compareAndSwapStore returns the store as CompareAndSwapStore if it implements it and the attempts are enabled.
+func (dcb *DistributedCircuitBreaker[T]) compareAndSwapStore() (CompareAndSwapStore, bool) {
+	cas, ok := dcb.store.(CompareAndSwapStore)
+	return cas, ok && dcb.options.casAttempts > 0
+}
+
+// executeOptimistic is Execute with CompareAndSwapStore.
+// Unlike Execute with Lock and Unlock, which holds the lock while the request runs,
+// it updates the shared state once to admit the request and once to count its outcome,
+// and runs the request in between without holding anything.
+func (dcb *DistributedCircuitBreaker[T]) executeOptimistic(cas CompareAndSwapStore, req func(d Decision) (T, error), classify func(T, error) Outcome) (t T, err error) {
+	var state State
+	var generation, age uint64
+	var admitErr error
+	err = dcb.update(cas, func() {
+		state, generation, age, admitErr = dcb.CircuitBreaker.admit()
+	})
+	if err != nil {
+		return dcb.executeUnavailable(req, classify, err)
+	}
+	if admitErr != nil {
+		if errors.Is(admitErr, ErrOpenState) || errors.Is(admitErr, ErrTooManyRequests) {
+			dcb.pendingRejections.Add(1)
+		}
+		return dcb.rejectedValue(), dcb.rejectionError(state, admitErr)
+	}
+
+	var writeErr error
+	panicked := true
+	defer func() {
+		if panicked {
+			dcb.handleError(writeErr)
+		}
+	}()
+	d := Decision{Name: dcb.name, State: state, Generation: generation}
+	t, o, err := dcb.runWith(func() (T, error) { return req(d) }, classify, func(o Outcome, err error, began time.Time) {
+		defer func() {
+			if e := recover(); e != nil {
+				writeErr = fmt.Errorf("panic in SharedDataStore: %v", e)
+			}
+		}()
+		writeErr = dcb.update(cas, func() {
+			dcb.afterRequestSince(generation, age, o, err, began)
+		})
+	})
+	panicked = false
+	if writeErr != nil {
+		return t, writeErr
+	}
+	return t, dcb.requestError(state, o, err)
+}
+
+// update reads the shared state, modifies it by modify through the local CircuitBreaker and writes it back
+// with CompareAndSwap, retrying on a conflict, or under the lock of SharedDataStore once the attempts run out.
+// modify may be called more than once, but the callbacks of Settings are called only for the call
+// whose change is written, after the locks are released.
+func (dcb *DistributedCircuitBreaker[T]) update(cas CompareAndSwapStore, modify func()) error {
+	var callbacks []func()
+	defer func() {
+		for _, f := range callbacks {
+			f()
+		}
+	}()
+
+	swapped, callbacks, err := dcb.compareAndSwap(cas, modify)
+	if err != nil || swapped {
+		return err
+	}
+
+	err = dcb.lock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		dcb.handleError(dcb.unlock())
+	}()
+
+	// The other instances still swap without the lock, so the write under the lock compares and swaps too.
+	// It conflicts only until they run out of their attempts and wait for the lock.
+	for !swapped && err == nil {
+		swapped, callbacks, err = dcb.swap(cas, modify)
+	}
+	return err
+}
+
+// updateLocked reads, modifies and writes the shared state under the lock of SharedDataStore.
+func (dcb *DistributedCircuitBreaker[T]) updateLocked(modify func()) error {
+	err := dcb.lock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		dcb.handleError(dcb.unlock())
+	}()
+
+	shared, err := dcb.getSharedState()
+	if err != nil {
+		return err
+	}
+	dcb.inject(shared)
+	modify()
+	return dcb.setSharedState(dcb.extract())
+}
+
+// updateShared is update with CompareAndSwapStore if possible, or under the lock of SharedDataStore otherwise.
+// It is used by the methods that change the shared state without running a request, e.g. ForceOpen.
+func (dcb *DistributedCircuitBreaker[T]) updateShared(modify func()) error {
+	if cas, ok := dcb.compareAndSwapStore(); ok {
+		return dcb.update(cas, modify)
+	}
+	return dcb.updateLocked(modify)
+}
+
+// compareAndSwap tries to update the shared state with CompareAndSwap up to the attempts of
+// WithCompareAndSwapAttempts, and reports whether it did along with the callbacks of the written change.
+func (dcb *DistributedCircuitBreaker[T]) compareAndSwap(cas CompareAndSwapStore, modify func()) (bool, []func(), error) {
+	dcb.rmwMutex.Lock()
+	defer dcb.rmwMutex.Unlock()
+
+	for attempt := 0; attempt < dcb.options.casAttempts; attempt++ {
+		swapped, callbacks, err := dcb.swap(cas, modify)
+		if err != nil || swapped {
+			return swapped, callbacks, err
+		}
+	}
+	return false, nil, nil
+}
+
+// swap makes a single attempt of compareAndSwap, holding rmwMutex.
+// The callbacks scheduled by modify are returned only if the change is written,
+// and the requests in flight, which are counted only locally, are restored on a conflict
+// so that they are not counted again on a retry.
+func (dcb *DistributedCircuitBreaker[T]) swap(cas CompareAndSwapStore, modify func()) (bool, []func(), error) {
+	dcb.mutex.RLock()
+	inFlight := dcb.inFlight
+	dcb.mutex.RUnlock()
+
+	old, shared, err := dcb.getSharedData()
+	if err != nil {
+		return false, nil, err
+	}
+	dcb.inject(shared)
+	dcb.stage()
+	modify()
+	state := dcb.extract()
+	callbacks := dcb.unstage()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return false, nil, err
+	}
+
+	dcb.cachedOpen.Store(nil)
+	swapped, err := cas.CompareAndSwap(dcb.sharedStateKey(), old, data)
+	if err != nil {
+		return false, nil, err
+	}
+	if !swapped {
+		dcb.mutex.Lock()
+		dcb.inFlight = inFlight
+		dcb.mutex.Unlock()
+		return false, nil, nil
+	}
+	dcb.written(state)
+	return true, callbacks, nil
+}
@@ -0,0 +1,170 @@
+package gobreaker
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// casStore is a CompareAndSwapStore backed by mapCache, whose Lock waits for the lock to be released.
+// If conflicting is true, CompareAndSwap reports a conflict while the lock is free,
+// as if the other instances kept swapping until they ran out of their attempts and waited for the lock.
+// interfere, if set, is called once by the first CompareAndSwap under the lock before it compares the data.
+type casStore struct {
+	*CacheStore
+	cache       *mapCache
+	mutex       sync.Mutex
+	locked      atomic.Bool
+	conflicting bool
+	interfere   func()
+	swaps       atomic.Int32
+	locks       atomic.Int32
+}
+
+func newCASStore() *casStore {
+	cache := newMapCache()
+	return &casStore{CacheStore: NewCacheStore(cache.get, cache.set), cache: cache}
+}
+
+func (cs *casStore) Lock(name string) error {
+	cs.locks.Add(1)
+	cs.mutex.Lock()
+	cs.locked.Store(true)
+	return nil
+}
+
+func (cs *casStore) Unlock(name string) error {
+	cs.locked.Store(false)
+	cs.mutex.Unlock()
+	return nil
+}
+
+func (cs *casStore) CompareAndSwap(name string, old, new []byte) (bool, error) {
+	// yield as a round trip to a remote store would, so that the instances conflict
+	runtime.Gosched()
+
+	if f := cs.interfere; f != nil && cs.locked.Load() {
+		cs.interfere = nil
+		f()
+	}
+
+	cs.cache.mutex.Lock()
+	defer cs.cache.mutex.Unlock()
+
+	if cs.conflicting && !cs.locked.Load() || !bytes.Equal(cs.cache.data[name], old) {
+		return false, nil
+	}
+	cs.cache.data[name] = new
+	cs.swaps.Add(1)
+	return true, nil
+}
+
+func TestDistributedCircuitBreakerCompareAndSwap(t *testing.T) {
+	store := newCASStore()
+	settings := Settings{Name: "cas", Clock: newFakeClock()}
+	dcb1, err := NewDistributedCircuitBreaker[any](store, settings, WithCompareAndSwapAttempts(3))
+	assert.NoError(t, err)
+	dcb2, err := NewDistributedCircuitBreaker[any](store, settings, WithCompareAndSwapAttempts(3))
+	assert.NoError(t, err)
+
+	const requests = 1000
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for _, dcb := range []*DistributedCircuitBreaker[any]{dcb1, dcb2} {
+		wg.Add(1)
+		go func(dcb *DistributedCircuitBreaker[any]) {
+			defer wg.Done()
+			<-start
+			for i := 0; i < requests; i++ {
+				assert.NoError(t, successRequest(dcb))
+			}
+		}(dcb)
+	}
+	close(start)
+	wg.Wait()
+
+	// no increment is lost by the conflicting updates
+	state, err := dcb1.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2*requests), state.Counts.Requests)
+	assert.Equal(t, uint32(2*requests), state.Counts.TotalSuccesses)
+	assert.Greater(t, store.swaps.Load(), int32(0))
+	assert.Equal(t, uint32(0), dcb1.inFlight)
+	assert.Equal(t, uint32(0), dcb2.inFlight)
+}
+
+func TestDistributedCircuitBreakerCompareAndSwapFallback(t *testing.T) {
+	store := newCASStore()
+	store.conflicting = true
+	dcb, err := NewDistributedCircuitBreaker[any](store, Settings{Name: "cas", MaxConcurrentRequests: 1}, WithCompareAndSwapAttempts(3))
+	assert.NoError(t, err)
+	locks := store.locks.Load()
+
+	// the lock is taken once the attempts run out, and the data is still swapped under the lock
+	assert.NoError(t, successRequest(dcb))
+	assert.Equal(t, locks+2, store.locks.Load())
+	assert.Equal(t, int32(2), store.swaps.Load())
+	state, err := dcb.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0, 0}, state.Counts)
+
+	// the failed attempts don't leak the requests in flight
+	assert.NoError(t, successRequest(dcb))
+	assert.Equal(t, uint32(0), dcb.inFlight)
+
+	// the lock is always taken without attempts, which is the default
+	store = newCASStore()
+	dcb, err = NewDistributedCircuitBreaker[any](store, Settings{Name: "cas"})
+	assert.NoError(t, err)
+	assert.NoError(t, failRequest(dcb))
+	assert.Equal(t, int32(0), store.swaps.Load())
+	state, err = dcb.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, state.Counts)
+}
+
+func TestDistributedCircuitBreakerCompareAndSwapUnderLock(t *testing.T) {
+	store := newCASStore()
+	store.conflicting = true
+	dcb1, err := NewDistributedCircuitBreaker[any](store, Settings{Name: "cas"}, WithCompareAndSwapAttempts(3))
+	assert.NoError(t, err)
+	dcb2, err := NewDistributedCircuitBreaker[any](store, Settings{Name: "cas"}, WithCompareAndSwapAttempts(3))
+	assert.NoError(t, err)
+
+	// the write under the lock doesn't overwrite an instance that swaps without the lock
+	store.interfere = func() {
+		assert.NoError(t, failRequest(dcb2))
+	}
+	assert.NoError(t, successRequest(dcb1))
+	state, err := dcb1.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{2, 1, 1, 1, 0, 0, 1}, state.Counts)
+}
+
+func TestDistributedCircuitBreakerCompareAndSwapCallbacks(t *testing.T) {
+	store := newCASStore()
+	store.conflicting = true
+	var changes []State
+	var outcomes []Outcome
+	dcb, err := NewDistributedCircuitBreaker[any](store, Settings{
+		Name:        "cas",
+		ReadyToTrip: func(counts Counts) bool { return counts.ConsecutiveFailures >= 1 },
+		OnStateChange: func(name string, from State, to State) {
+			changes = append(changes, to)
+		},
+		OnOutcome: func(info OutcomeInfo) {
+			outcomes = append(outcomes, info.Outcome)
+		},
+	}, WithCompareAndSwapAttempts(3))
+	assert.NoError(t, err)
+
+	// the callbacks of the conflicting attempts are not called
+	assert.NoError(t, failRequest(dcb))
+	assert.Equal(t, []State{StateOpen}, changes)
+	assert.Equal(t, []Outcome{OutcomeFailure}, outcomes)
+	assertState(t, dcb, StateOpen)
+}
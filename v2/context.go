@@ -0,0 +1,133 @@
+package gobreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Decision describes how CircuitBreaker admitted a request run by ExecuteContext.
+// Name is the name of the CircuitBreaker.
+// State is the state of the CircuitBreaker when the request was admitted;
+// StateOpen means that the request would have been rejected but ObserveOnly let it through.
+// Generation is the generation of the Counts in which the request is counted.
+type Decision struct {
+	Name       string
+	State      State
+	Generation uint64
+}
+
+type decisionKey struct{}
+
+// DecisionFromContext returns the Decision carried by the context given to the request of ExecuteContext.
+// The second return value is false if ctx doesn't carry a Decision.
+func DecisionFromContext(ctx context.Context) (Decision, bool) {
+	d, ok := ctx.Value(decisionKey{}).(Decision)
+	return d, ok
+}
+
+// ExecuteContext is like Execute, but the request is given a child context of ctx
+// that carries the Decision of the CircuitBreaker, e.g. for logging middleware
+// to include the name and the state of the CircuitBreaker without threading extra parameters.
+// With Settings.CancelOnOpen, the context is also cancelled when the CircuitBreaker becomes open.
+//
+// If ctx is already done, ExecuteContext returns ctx.Err() without admitting the request or counting it.
+// If ctx is done after the request is admitted but before req is called, req is not called and
+// ExecuteContext returns ctx.Err(), which is counted as the outcome of the request,
+// e.g. as an exclusion if IsExcluded matches it.
+// If ctx is done when req returns an error, the outcome is classified with an error that wraps both
+// the error of req and ctx.Err(), so that IsExcluded and IsSuccessful can tell the requests cut off
+// by the deadline or the cancellation of the caller with errors.Is. ExecuteContext still returns the error of req.
+func (cb *CircuitBreaker[T]) ExecuteContext(ctx context.Context, req func(ctx context.Context) (T, error)) (T, error) {
+	if err := ctx.Err(); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	ctx, stop := cb.cancelOnOpen(ctx)
+	defer stop()
+
+	state, generation, age, err := cb.admit()
+	if err != nil {
+		return cb.rejectedValue(), cb.rejectionError(state, err)
+	}
+
+	d := Decision{Name: cb.name, State: state, Generation: generation}
+	run := func() (T, error) {
+		return runWithDecision(ctx, d, req)
+	}
+	result, o, err := cb.run(generation, age, run, cb.contextClassifier(ctx))
+	return result, cb.requestError(state, o, err)
+}
+
+// ExecuteContext is like Execute, but the request is given a child context of ctx that carries the Decision.
+// See CircuitBreaker.ExecuteContext.
+// With Settings.CancelOnOpen, the context is cancelled when this instance opens the shared state;
+// the shared state opened by the other instances is seen only by the requests admitted after it.
+// If ctx is already done, ExecuteContext returns ctx.Err() without reading or writing the shared state.
+func (dcb *DistributedCircuitBreaker[T]) ExecuteContext(ctx context.Context, req func(ctx context.Context) (T, error)) (T, error) {
+	if err := ctx.Err(); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	ctx, stop := dcb.cancelOnOpen(ctx)
+	defer stop()
+
+	return dcb.execute(func(d Decision) (T, error) {
+		return runWithDecision(ctx, d, req)
+	}, dcb.contextClassifier(ctx))
+}
+
+// runWithDecision runs the request of ExecuteContext with ctx carrying d, unless ctx is already done.
+func runWithDecision[T any](ctx context.Context, d Decision, req func(ctx context.Context) (T, error)) (T, error) {
+	ctx = context.WithValue(ctx, decisionKey{}, d)
+	if err := ctx.Err(); err != nil {
+		var zero T
+		return zero, err
+	}
+	return req(ctx)
+}
+
+// contextClassifier returns the classifier of the requests of ExecuteContext given ctx.
+func (cb *CircuitBreaker[T]) contextClassifier(ctx context.Context) func(T, error) Outcome {
+	return func(result T, err error) Outcome {
+		return cb.classify(result, contextError(ctx, err))
+	}
+}
+
+// contextError returns err wrapping the error of ctx too, if ctx is done and err doesn't match it already.
+func contextError(ctx context.Context, err error) error {
+	ctxErr := ctx.Err()
+	if err == nil || ctxErr == nil || errors.Is(err, ctxErr) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", err, ctxErr)
+}
+
+// cancelOnOpen returns a child context of ctx cancelled when the CircuitBreaker becomes open
+// with Settings.CancelOnOpen, or ctx itself otherwise, along with the function to release it.
+// It is called before the request is admitted, so that a request admitted just before
+// the CircuitBreaker becomes open is cancelled, too.
+func (cb *CircuitBreaker[T]) cancelOnOpen(ctx context.Context) (context.Context, func()) {
+	openCtx := cb.openContext()
+	if openCtx == nil {
+		return ctx, func() {}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(openCtx, func() { cancel(context.Cause(openCtx)) })
+	return ctx, func() {
+		stop()
+		cancel(nil)
+	}
+}
+
+// openContext returns the context of the CircuitBreaker cancelled when it becomes open,
+// or nil without Settings.CancelOnOpen.
+func (cb *CircuitBreaker[T]) openContext() context.Context {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	return cb.openCtx
+}
@@ -0,0 +1,169 @@
+package gobreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteContext(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{Name: "ctx"})
+
+	type key struct{}
+	parent := context.WithValue(context.Background(), key{}, "value")
+	result, err := cb.ExecuteContext(parent, func(ctx context.Context) (int, error) {
+		d, ok := DecisionFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, Decision{Name: "ctx", State: StateClosed, Generation: cb.generation}, d)
+		assert.Equal(t, "value", ctx.Value(key{}))
+		return 1, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result)
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0, 0}, cb.Counts())
+
+	_, ok := DecisionFromContext(parent)
+	assert.False(t, ok)
+
+	for i := 0; i < 6; i++ {
+		_, err = cb.ExecuteContext(parent, func(ctx context.Context) (int, error) { return 0, errors.New("fail") })
+		assert.EqualError(t, err, "fail")
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	called := false
+	_, err = cb.ExecuteContext(parent, func(ctx context.Context) (int, error) {
+		called = true
+		return 0, nil
+	})
+	assert.Equal(t, ErrOpenState, err)
+	assert.False(t, called)
+}
+
+func TestExecuteContextObserveOnly(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{Name: "ctx", ObserveOnly: true})
+	for i := 0; i < 6; i++ {
+		_, _ = cb.ExecuteContext(context.Background(), func(ctx context.Context) (int, error) { return 0, errors.New("fail") })
+	}
+
+	_, err := cb.ExecuteContext(context.Background(), func(ctx context.Context) (int, error) {
+		d, ok := DecisionFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, StateOpen, d.State)
+		return 0, nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestCancelOnOpen(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{
+		CancelOnOpen: true,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 1
+		},
+	})
+
+	started := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := cb.ExecuteContext(context.Background(), func(ctx context.Context) (int, error) {
+			close(started)
+			<-ctx.Done()
+			assert.Equal(t, ErrOpenState, context.Cause(ctx))
+			return 0, ctx.Err()
+		})
+		done <- err
+	}()
+	<-started
+
+	// another request trips the CircuitBreaker
+	_, err := cb.ExecuteContext(context.Background(), func(ctx context.Context) (int, error) { return 0, errors.New("fail") })
+	assert.EqualError(t, err, "fail")
+	assert.Equal(t, StateOpen, cb.State())
+
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("the request in flight was not cancelled")
+	}
+
+	// the requests after the reset get a new context
+	cb.Reset()
+	_, err = cb.ExecuteContext(context.Background(), func(ctx context.Context) (int, error) { return 0, ctx.Err() })
+	assert.NoError(t, err)
+}
+
+func TestCancelOnOpenDisabled(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{})
+	assert.Nil(t, cb.openContext())
+
+	_, err := cb.ExecuteContext(context.Background(), func(ctx context.Context) (int, error) {
+		cb.mutex.Lock()
+		cb.setState(StateOpen, cb.clock.Now())
+		cb.unlock()
+		return 0, ctx.Err()
+	})
+	assert.NoError(t, err)
+}
+
+func TestExecuteContextDone(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{
+		IsExcluded: func(err error) bool { return errors.Is(err, context.Canceled) },
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	_, err := cb.ExecuteContext(ctx, func(ctx context.Context) (int, error) {
+		called = true
+		return 1, nil
+	})
+	assert.False(t, called)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, Counts{}, cb.Counts())
+
+	// a context done after the admission is counted as the outcome of the request;
+	// the callback cancels it as the admission releases the lock
+	ctx, cancel = context.WithCancel(context.Background())
+	cb.mutex.Lock()
+	cb.callback(cancel)
+	cb.mutex.Unlock()
+	_, err = cb.ExecuteContext(ctx, func(ctx context.Context) (int, error) {
+		called = true
+		return 1, nil
+	})
+	assert.False(t, called)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, Counts{1, 0, 0, 0, 0, 1, 0}, cb.Counts())
+
+	// an error of the request cut off by the cancellation is classified with the context error
+	ctx, cancel = context.WithCancel(context.Background())
+	_, err = cb.ExecuteContext(ctx, func(ctx context.Context) (int, error) {
+		cancel()
+		return 0, errors.New("connection reset")
+	})
+	assert.EqualError(t, err, "connection reset")
+	assert.Equal(t, Counts{2, 0, 0, 0, 0, 2, 0}, cb.Counts())
+
+	// a deadline not matched by IsExcluded is a failure
+	_, err = cb.ExecuteContext(context.Background(), func(ctx context.Context) (int, error) {
+		return 0, context.DeadlineExceeded
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, Counts{3, 0, 1, 0, 1, 2, 1}, cb.Counts())
+
+	// a deadline passed before the admission is not counted at all
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	_, err = cb.ExecuteContext(ctx, func(ctx context.Context) (int, error) { return 1, nil })
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, Counts{3, 0, 1, 0, 1, 2, 1}, cb.Counts())
+
+	_, err = cb.ExecuteContext(context.Background(), func(ctx context.Context) (int, error) { return 0, errors.New("fail") })
+	assert.EqualError(t, err, "fail")
+	assert.Equal(t, Counts{4, 0, 2, 0, 2, 2, 2}, cb.Counts())
+}
@@ -3,6 +3,9 @@ package gobreaker
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,14 +14,83 @@ var (
 	ErrNoSharedStore = errors.New("no shared store")
 	// ErrNoSharedState is returned when there is no shared state.
 	ErrNoSharedState = errors.New("no shared state")
+	// ErrUnsupportedSharedState is returned when the shared state was written in a newer format.
+	ErrUnsupportedSharedState = errors.New("unsupported shared state version")
+	// ErrEmptyName is returned when DistributedCircuitBreaker has no name,
+	// which would make its keys in SharedDataStore collide with other unnamed breakers.
+	ErrEmptyName = errors.New("empty name")
 )
 
+// SharedStateVersion is the version of the format of SharedState written by this package.
+const SharedStateVersion = 2
+
 // SharedState represents the shared state of DistributedCircuitBreaker.
+// Version is the version of the format in which the state was written.
+// The state written before the format was versioned has Version 0.
+// Buckets, WindowStart and BucketAge hold the closed-state rolling window, if Settings.BucketPeriod is set.
+// StateChangedAt is the time of the last change of the state, read from the Clock of the instance that wrote it.
+// It is zero in the state written by older versions, in which case each instance keeps its own.
+// ExpiresAfter is the expiry of the current state as an offset from StateChangedAt,
+// from which the instances derive the expiry, so that the state holds a single reference time
+// and durations relative to it. It is zero if the state has no expiry.
+// Expiry is the same expiry as an absolute time, which is kept for diagnostics and for older versions,
+// and is used only when ExpiresAfter is zero.
+// Since the reference time is read from the Clock of one instance, the instances sharing the state
+// should use clocks that agree, e.g. synchronized by NTP, or the same fake Clock in tests;
+// a skew between the clocks shifts the transitions of the other instances by the skew.
+// OpenTimeout and Saturated hold the backoff of Settings.SaturationBackoff,
+// so that all instances extend the open state alike whichever of them saw the saturation
+// or ends the half-open state. OpenTimeout is zero in the state written by older versions,
+// in which case each instance keeps its own backoff.
+// FailedProbes is the number of the failed probes counted for Settings.MaxProbeAttempts.
+// Rejections is the number of the requests rejected by all the instances, which is never cleared.
 type SharedState struct {
-	State      State     `json:"state"`
-	Generation uint64    `json:"generation"`
-	Counts     Counts    `json:"counts"`
-	Expiry     time.Time `json:"expiry"`
+	Version        int           `json:"version"`
+	State          State         `json:"state"`
+	Generation     uint64        `json:"generation"`
+	Counts         Counts        `json:"counts"`
+	Expiry         time.Time     `json:"expiry"`
+	Buckets        []Counts      `json:"buckets,omitempty"`
+	WindowStart    time.Time     `json:"windowStart"`
+	BucketAge      uint64        `json:"bucketAge"`
+	StateChangedAt time.Time     `json:"stateChangedAt"`
+	ExpiresAfter   time.Duration `json:"expiresAfter,omitempty"`
+	OpenTimeout    time.Duration `json:"openTimeout,omitempty"`
+	Saturated      bool          `json:"saturated,omitempty"`
+	FailedProbes   uint32        `json:"failedProbes,omitempty"`
+	Rejections     uint64        `json:"rejections,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler, encoding State as a number rather than by its name,
+// so that the instances on the versions that read it as a number can share the state.
+func (s SharedState) MarshalJSON() ([]byte, error) {
+	type sharedState SharedState
+	return json.Marshal(struct {
+		sharedState
+		State int `json:"state"`
+	}{sharedState(s), int(s.State)})
+}
+
+// expiry returns the expiry of the state, derived from StateChangedAt and ExpiresAfter if they are set.
+func (s SharedState) expiry() time.Time {
+	if s.ExpiresAfter > 0 && !s.StateChangedAt.IsZero() {
+		return s.StateChangedAt.Add(s.ExpiresAfter)
+	}
+	return s.Expiry
+}
+
+// migrateSharedState upgrades the state read from the store to the current format.
+// It returns ErrUnsupportedSharedState for the state written in a newer format
+// rather than mis-decoding it.
+func migrateSharedState(state *SharedState) error {
+	if state.Version > SharedStateVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedSharedState, state.Version)
+	}
+
+	// Version 0 has the same fields as version 1.
+	// Version 1 has no rolling window, which inject starts anew from Counts.
+	state.Version = SharedStateVersion
+	return nil
 }
 
 // SharedDataStore stores the shared state of DistributedCircuitBreaker.
@@ -29,14 +101,142 @@ type SharedDataStore interface {
 	SetData(name string, data []byte) error
 }
 
+// StoreUnavailablePolicy determines how DistributedCircuitBreaker.Execute handles a request
+// when SharedDataStore can't be locked or the shared state can't be read from it.
+type StoreUnavailablePolicy int
+
+// These constants are the policies for an unavailable SharedDataStore.
+const (
+	// FailClosed returns the error of SharedDataStore without running the request.
+	FailClosed StoreUnavailablePolicy = iota
+	// FallbackLocal runs the request through the local CircuitBreaker,
+	// which holds the shared state last read by the DistributedCircuitBreaker.
+	// The outcome is not written to SharedDataStore.
+	FallbackLocal
+	// FailOpen runs the request without the CircuitBreaker.
+	FailOpen
+)
+
+const (
+	defaultStoreReadAttempts = 3
+	defaultStoreReadBackoff  = 10 * time.Millisecond
+)
+
+type distributedOptions struct {
+	storeUnavailablePolicy StoreUnavailablePolicy
+	storeReadAttempts      int
+	storeReadBackoff       time.Duration
+	lockTimeout            time.Duration
+	lockWait               time.Duration
+	openStateCache         time.Duration
+	casAttempts            int
+	errorHandler           func(err error)
+}
+
+// DistributedOption configures DistributedCircuitBreaker.
+type DistributedOption func(*distributedOptions)
+
+// WithStoreUnavailablePolicy sets the policy applied when SharedDataStore can't be locked
+// or the shared state can't be read even after retrying. The default is FailClosed.
+func WithStoreUnavailablePolicy(policy StoreUnavailablePolicy) DistributedOption {
+	return func(o *distributedOptions) {
+		o.storeUnavailablePolicy = policy
+	}
+}
+
+// WithStoreReadRetry sets how many times Execute reads the shared state before giving up,
+// including the first attempt, and how long it waits after the first failed attempt.
+// The wait doubles after every failed attempt.
+// If attempts is less than or equal to 0, the shared state is read only once.
+// The default is 3 attempts with a backoff of 10 milliseconds.
+func WithStoreReadRetry(attempts int, backoff time.Duration) DistributedOption {
+	return func(o *distributedOptions) {
+		o.storeReadAttempts = attempts
+		o.storeReadBackoff = backoff
+	}
+}
+
+// WithLockRetry sets how long DistributedCircuitBreaker keeps trying to take the lock of SharedDataStore
+// before giving up, and how long it waits after each failed attempt.
+// If timeout is less than or equal to 0, the lock is tried only once.
+// The default is 5 seconds with a wait of 500 milliseconds.
+func WithLockRetry(timeout, wait time.Duration) DistributedOption {
+	return func(o *distributedOptions) {
+		o.lockTimeout = timeout
+		o.lockWait = wait
+	}
+}
+
+// WithErrorHandler sets the function called with the errors of SharedDataStore that can't be returned,
+// e.g. when writing the failure of a request that panicked, since Execute causes the same panic again.
+// If handler is nil, which is the default, such errors are discarded.
+func WithErrorHandler(handler func(err error)) DistributedOption {
+	return func(o *distributedOptions) {
+		o.errorHandler = handler
+	}
+}
+
+// WithOpenStateCache lets Execute reject requests without a round trip to SharedDataStore
+// while the open state last written by this instance is at most maxAge old
+// and its timeout has not elapsed yet, so that the store is hardly read during an outage.
+// The cached state is replaced by every write of the shared state by this instance,
+// and is not used once the open state may have become half-open.
+// Note that a change of the shared state by another instance during maxAge,
+// e.g. by ResetShared, is not seen by this instance until maxAge elapses.
+// If maxAge is less than or equal to 0, which is the default, the shared state is read on every request.
+func WithOpenStateCache(maxAge time.Duration) DistributedOption {
+	return func(o *distributedOptions) {
+		o.openStateCache = maxAge
+	}
+}
+
+// WatchableStore is a SharedDataStore that pushes the changes of the data,
+// e.g. with Redis keyspace notifications or etcd watches.
+// DistributedCircuitBreaker with WatchableStore reads the shared state pushed by Watch
+// instead of reading it from the store on every request.
+//
+// Watch returns a channel that receives the data of the given name whenever it changes,
+// and a function to stop watching, which closes the channel.
+type WatchableStore interface {
+	SharedDataStore
+	Watch(name string) (<-chan []byte, func(), error)
+}
+
 // DistributedCircuitBreaker extends CircuitBreaker with SharedDataStore.
+// The methods that admit the requests or change the state, e.g. Execute, Guard, ForceOpen and Restore,
+// read and write the shared state. Reset, SwitchToRolling and SwitchToFixed of the embedded CircuitBreaker
+// and the methods that only read the state, e.g. Counts and Metrics, use the local copy of the shared state
+// as of the last of those methods called on this instance.
 type DistributedCircuitBreaker[T any] struct {
 	*CircuitBreaker[T]
-	store SharedDataStore
+	store   SharedDataStore
+	options distributedOptions
+
+	watching  atomic.Bool
+	watched   atomic.Pointer[SharedState]
+	stopWatch func()
+
+	cachedOpen atomic.Pointer[cachedOpenState]
+
+	rejections        uint64
+	pendingRejections atomic.Uint64
+
+	// rmwMutex serializes the reads, modifications and writes of the shared state by this instance,
+	// which all go through the local CircuitBreaker.
+	rmwMutex sync.Mutex
+}
+
+// cachedOpenState is the open state cached by WithOpenStateCache.
+type cachedOpenState struct {
+	expiry    time.Time
+	writtenAt time.Time
 }
 
 // NewDistributedCircuitBreaker returns a new DistributedCircuitBreaker.
-func NewDistributedCircuitBreaker[T any](store SharedDataStore, settings Settings) (dcb *DistributedCircuitBreaker[T], err error) {
+// It returns ErrEmptyName if neither Settings.Name nor Settings.NameFunc gives a name.
+// If store is a WatchableStore, the DistributedCircuitBreaker watches the shared state
+// until Close is called. If Watch fails, the shared state is read on every request instead.
+func NewDistributedCircuitBreaker[T any](store SharedDataStore, settings Settings, opts ...DistributedOption) (dcb *DistributedCircuitBreaker[T], err error) {
 	if store == nil {
 		return nil, ErrNoSharedStore
 	}
@@ -44,6 +244,20 @@ func NewDistributedCircuitBreaker[T any](store SharedDataStore, settings Setting
 	dcb = &DistributedCircuitBreaker[T]{
 		CircuitBreaker: NewCircuitBreaker[T](settings),
 		store:          store,
+		options: distributedOptions{
+			storeReadAttempts: defaultStoreReadAttempts,
+			storeReadBackoff:  defaultStoreReadBackoff,
+			lockTimeout:       mutexTimeout,
+			lockWait:          mutexWaitTime,
+			casAttempts:       defaultCompareAndSwapAttempts,
+		},
+	}
+	for _, opt := range opts {
+		opt(&dcb.options)
+	}
+
+	if dcb.name == "" {
+		return nil, ErrEmptyName
 	}
 
 	err = dcb.lock()
@@ -58,16 +272,53 @@ func NewDistributedCircuitBreaker[T any](store SharedDataStore, settings Setting
 	}()
 
 	_, err = dcb.getSharedState()
-	if err == ErrNoSharedState {
+	if errors.Is(err, ErrNoSharedState) {
 		err = dcb.setSharedState(dcb.extract())
 	}
 	if err != nil {
 		return nil, err
 	}
 
+	if ws, ok := store.(WatchableStore); ok {
+		dcb.watch(ws)
+	}
+
 	return dcb, nil
 }
 
+// watch starts receiving the shared state pushed by ws.
+func (dcb *DistributedCircuitBreaker[T]) watch(ws WatchableStore) {
+	ch, stop, err := ws.Watch(dcb.sharedStateKey())
+	if err != nil {
+		return
+	}
+	dcb.stopWatch = stop
+	dcb.watching.Store(true)
+
+	go func() {
+		for data := range ch {
+			state, err := decodeSharedState(data)
+			if err != nil {
+				// Read the store on the next request.
+				dcb.watched.Store(nil)
+				continue
+			}
+			dcb.watched.Store(&state)
+		}
+		dcb.watching.Store(false)
+		dcb.watched.Store(nil)
+	}()
+}
+
+// Close stops watching the shared state, if the DistributedCircuitBreaker does,
+// and closes the local CircuitBreaker.
+func (dcb *DistributedCircuitBreaker[T]) Close() error {
+	if dcb.stopWatch != nil {
+		dcb.stopWatch()
+	}
+	return dcb.CircuitBreaker.Close()
+}
+
 const (
 	mutexTimeout  = 5 * time.Second
 	mutexWaitTime = 500 * time.Millisecond
@@ -82,17 +333,20 @@ func (dcb *DistributedCircuitBreaker[T]) lock() error {
 		return ErrNoSharedStore
 	}
 
-	var err error
-	expiry := time.Now().Add(mutexTimeout)
-	for time.Now().Before(expiry) {
-		err = dcb.store.Lock(dcb.mutexKey())
+	dcb.rmwMutex.Lock()
+	expiry := time.Now().Add(dcb.options.lockTimeout)
+	for {
+		err := dcb.store.Lock(dcb.mutexKey())
 		if err == nil {
 			return nil
 		}
+		if !time.Now().Add(dcb.options.lockWait).Before(expiry) {
+			dcb.rmwMutex.Unlock()
+			return err
+		}
 
-		time.Sleep(mutexWaitTime)
+		time.Sleep(dcb.options.lockWait)
 	}
-	return err
 }
 
 func (dcb *DistributedCircuitBreaker[T]) unlock() error {
@@ -100,6 +354,7 @@ func (dcb *DistributedCircuitBreaker[T]) unlock() error {
 		return ErrNoSharedStore
 	}
 
+	defer dcb.rmwMutex.Unlock()
 	return dcb.store.Unlock(dcb.mutexKey())
 }
 
@@ -113,59 +368,182 @@ func (dcb *DistributedCircuitBreaker[T]) getSharedState() (SharedState, error) {
 		return state, ErrNoSharedStore
 	}
 
+	_, state, err := dcb.getSharedData()
+	return state, err
+}
+
+// getSharedData is like getSharedState but also returns the data read from the store.
+func (dcb *DistributedCircuitBreaker[T]) getSharedData() ([]byte, SharedState, error) {
+	var state SharedState
 	data, err := dcb.store.GetData(dcb.sharedStateKey())
 	if len(data) == 0 {
-		return state, ErrNoSharedState
+		if err != nil {
+			// The store may report a missing key as an error.
+			return data, state, fmt.Errorf("%w: %w", ErrNoSharedState, err)
+		}
+		return data, state, ErrNoSharedState
 	} else if err != nil {
+		return data, state, err
+	}
+
+	state, err = decodeSharedState(data)
+	return data, state, err
+}
+
+func decodeSharedState(data []byte) (SharedState, error) {
+	var state SharedState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
 		return state, err
 	}
 
-	err = json.Unmarshal(data, &state)
+	err = migrateSharedState(&state)
 	return state, err
 }
 
+// loadSharedState returns the shared state last pushed by WatchableStore, if any,
+// or reads it from the store otherwise.
+func (dcb *DistributedCircuitBreaker[T]) loadSharedState() (SharedState, error) {
+	if state := dcb.watched.Load(); state != nil {
+		return *state, nil
+	}
+	return dcb.getSharedState()
+}
+
+// lockSharedState takes the lock of SharedDataStore and reads the shared state under it
+// like loadSharedState, retrying transient failures of the read with backoff.
+// The lock is released while waiting, so that the backoff of this instance doesn't stall the others.
+// The lock is held on return only if the error is nil.
+func (dcb *DistributedCircuitBreaker[T]) lockSharedState() (SharedState, error) {
+	backoff := dcb.options.storeReadBackoff
+	for attempt := 1; ; attempt++ {
+		err := dcb.lock()
+		if err != nil {
+			return SharedState{}, err
+		}
+
+		state, err := dcb.loadSharedState()
+		if err == nil {
+			return state, nil
+		}
+		dcb.handleError(dcb.unlock())
+		if !storeUnavailable(err) || attempt >= dcb.options.storeReadAttempts {
+			return state, err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// storeUnavailable reports whether err means that the shared state couldn't be read,
+// as opposed to the shared state being unusable.
+func storeUnavailable(err error) bool {
+	return !errors.Is(err, ErrNoSharedStore) && !errors.Is(err, ErrUnsupportedSharedState)
+}
+
 func (dcb *DistributedCircuitBreaker[T]) setSharedState(state SharedState) error {
 	if dcb.store == nil {
 		return ErrNoSharedStore
 	}
 
+	dcb.cachedOpen.Store(nil)
+
 	data, err := json.Marshal(state)
 	if err != nil {
 		return err
 	}
 
-	return dcb.store.SetData(dcb.sharedStateKey(), data)
+	err = dcb.store.SetData(dcb.sharedStateKey(), data)
+	if err != nil {
+		return err
+	}
+
+	dcb.written(state)
+	return nil
+}
+
+// written updates the caches of the shared state with the state written to the store by this instance.
+func (dcb *DistributedCircuitBreaker[T]) written(state SharedState) {
+	if dcb.watching.Load() {
+		// The own write is the latest even if its push has not arrived yet.
+		dcb.watched.Store(&state)
+	}
+	if dcb.options.openStateCache > 0 && state.State == StateOpen {
+		dcb.cachedOpen.Store(&cachedOpenState{expiry: state.expiry(), writtenAt: dcb.clock.Now()})
+	}
+}
+
+// rejectsLocally reports whether the open state cached by WithOpenStateCache rejects a request.
+func (dcb *DistributedCircuitBreaker[T]) rejectsLocally() bool {
+	cached := dcb.cachedOpen.Load()
+	if cached == nil || dcb.observeOnly || CurrentGlobalMode() != GlobalModeNormal {
+		return false
+	}
+
+	now := dcb.clock.Now()
+	// The open state of ManualRecovery has no expiry.
+	return now.Before(cached.writtenAt.Add(dcb.options.openStateCache)) && (cached.expiry.IsZero() || !cached.expiry.Before(now))
 }
 
 func (dcb *DistributedCircuitBreaker[T]) inject(shared SharedState) {
 	dcb.mutex.Lock()
 	defer dcb.mutex.Unlock()
 
+	if dcb.latency != nil && shared.Generation != dcb.generation {
+		// The durations are recorded by each instance and cleared when another one starts a generation.
+		dcb.latency.reset()
+	}
 	dcb.state = shared.State
 	dcb.generation = shared.Generation
 	dcb.counts = shared.Counts
-	dcb.expiry = shared.Expiry
+	dcb.expiry = shared.expiry()
+	if !shared.StateChangedAt.IsZero() {
+		dcb.stateChangedAt = shared.StateChangedAt
+	}
+	if shared.OpenTimeout > 0 {
+		dcb.openTimeout = shared.OpenTimeout
+		dcb.saturated = shared.Saturated
+	}
+	dcb.failedProbes = shared.FailedProbes
+	dcb.rejections = shared.Rejections
+	if dcb.window != nil {
+		dcb.window.load(shared.Buckets, shared.WindowStart, shared.BucketAge, shared.Counts)
+	}
+	// The slots of the half-open state are shared by all the instances.
+	dcb.resetHalfOpenGate(dcb.halfOpenRequests())
 }
 
 func (dcb *DistributedCircuitBreaker[T]) extract() SharedState {
 	dcb.mutex.Lock()
 	defer dcb.mutex.Unlock()
 
-	return SharedState{
-		State:      dcb.state,
-		Generation: dcb.generation,
-		Counts:     dcb.counts,
-		Expiry:     dcb.expiry,
+	shared := SharedState{
+		Version:        SharedStateVersion,
+		State:          dcb.state,
+		Generation:     dcb.generation,
+		Counts:         dcb.counts,
+		Expiry:         dcb.expiry,
+		StateChangedAt: dcb.stateChangedAt,
+		OpenTimeout:    dcb.openTimeout,
+		Saturated:      dcb.saturated,
+		FailedProbes:   dcb.failedProbes,
+	}
+	if !dcb.expiry.IsZero() && dcb.expiry.After(dcb.stateChangedAt) {
+		shared.ExpiresAfter = dcb.expiry.Sub(dcb.stateChangedAt)
+	}
+	dcb.rejections += dcb.pendingRejections.Swap(0)
+	shared.Rejections = dcb.rejections
+	if dcb.window != nil {
+		shared.Buckets = append([]Counts(nil), dcb.window.buckets...)
+		shared.WindowStart = dcb.window.start
+		shared.BucketAge = dcb.window.age
 	}
+	return shared
 }
 
 // State returns the State of DistributedCircuitBreaker.
 func (dcb *DistributedCircuitBreaker[T]) State() (state State, err error) {
-	shared, err := dcb.getSharedState()
-	if err != nil {
-		return shared.State, err
-	}
-
 	err = dcb.lock()
 	if err != nil {
 		return state, err
@@ -177,6 +555,13 @@ func (dcb *DistributedCircuitBreaker[T]) State() (state State, err error) {
 		}
 	}()
 
+	// The shared state is read under the lock so that the write below doesn't lose
+	// a write of another instance made in between.
+	shared, err := dcb.loadSharedState()
+	if err != nil {
+		return state, err
+	}
+
 	dcb.inject(shared)
 	state = dcb.CircuitBreaker.State()
 	shared = dcb.extract()
@@ -185,16 +570,75 @@ func (dcb *DistributedCircuitBreaker[T]) State() (state State, err error) {
 	return state, err
 }
 
-// Execute runs the given request if the DistributedCircuitBreaker accepts it.
-func (dcb *DistributedCircuitBreaker[T]) Execute(req func() (T, error)) (t T, err error) {
-	shared, err := dcb.getSharedState()
+// StateAge returns how long the shared state has been in the current state.
+// Like State, it applies the transition that is due, if any, to the shared state.
+func (dcb *DistributedCircuitBreaker[T]) StateAge() (age time.Duration, err error) {
+	err = dcb.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		e := dcb.unlock()
+		if err == nil {
+			err = e
+		}
+	}()
+
+	shared, err := dcb.loadSharedState()
 	if err != nil {
-		return t, err
+		return 0, err
 	}
 
+	dcb.inject(shared)
+	age = dcb.CircuitBreaker.StateAge()
+	shared = dcb.extract()
+
+	err = dcb.setSharedState(shared)
+	return age, err
+}
+
+// bestEffort calls f, which accesses SharedDataStore while a request is panicking,
+// so that neither an error nor a panic of SharedDataStore replaces the panic of the request.
+func (dcb *DistributedCircuitBreaker[T]) bestEffort(f func() error) {
+	defer func() {
+		if e := recover(); e != nil {
+			dcb.handleError(fmt.Errorf("panic in SharedDataStore: %v", e))
+		}
+	}()
+
+	dcb.handleError(f())
+}
+
+// handleError calls the handler set by WithErrorHandler with err if err is not nil.
+func (dcb *DistributedCircuitBreaker[T]) handleError(err error) {
+	if err != nil && dcb.options.errorHandler != nil {
+		dcb.options.errorHandler(err)
+	}
+}
+
+// Rejections returns the number of the requests rejected by all the instances sharing the state,
+// e.g. to see the load shed by the whole fleet.
+// A rejection is written to the shared state along with the next write by the instance that rejected it,
+// which happens on every request except those rejected by WithOpenStateCache without reading the store.
+// The rejections of this instance not written yet are included.
+// The rejections of a write that fails are lost.
+func (dcb *DistributedCircuitBreaker[T]) Rejections() (uint64, error) {
+	shared, err := dcb.loadSharedState()
+	if err != nil {
+		return 0, err
+	}
+	return shared.Rejections + dcb.pendingRejections.Load(), nil
+}
+
+// ResetShared resets the shared state in SharedDataStore to the closed state with cleared Counts,
+// so that every instance sharing the state picks up the reset on its next read.
+// It also resets the local CircuitBreaker of this instance.
+// Unlike ResetShared, Reset of the embedded CircuitBreaker resets only the local copy of the state,
+// which is overwritten by the shared state on the next request.
+func (dcb *DistributedCircuitBreaker[T]) ResetShared() (err error) {
 	err = dcb.lock()
 	if err != nil {
-		return t, err
+		return err
 	}
 	defer func() {
 		e := dcb.unlock()
@@ -203,8 +647,104 @@ func (dcb *DistributedCircuitBreaker[T]) Execute(req func() (T, error)) (t T, er
 		}
 	}()
 
+	shared, err := dcb.getSharedState()
+	if err == nil {
+		// Keep the generation increasing so that the outcomes of the requests in flight are discarded.
+		dcb.inject(shared)
+	} else if !errors.Is(err, ErrNoSharedState) {
+		return err
+	}
+
+	dcb.CircuitBreaker.Reset()
+	return dcb.setSharedState(dcb.extract())
+}
+
+// AllowProbe places the shared state into the half-open state if it is open,
+// so that the next requests of every instance probe the dependency. See CircuitBreaker.AllowProbe.
+// It returns the error of SharedDataStore if the shared state can't be updated.
+func (dcb *DistributedCircuitBreaker[T]) AllowProbe() error {
+	return dcb.updateShared(dcb.CircuitBreaker.AllowProbe)
+}
+
+// Execute runs the given request if the DistributedCircuitBreaker accepts it.
+// If SharedDataStore can't be locked within the timeout of WithLockRetry
+// or the shared state can't be read from it even after retrying, Execute handles the request according to the StoreUnavailablePolicy.
+// If the request panics, Execute writes the failure to the shared state and causes the same panic again.
+// The errors of SharedDataStore in doing so are passed to the handler set by WithErrorHandler.
+// Execute holds the lock of SharedDataStore while the request runs, unless the store implements
+// CompareAndSwapStore and WithCompareAndSwapAttempts enables it, in which case the shared state
+// is updated optimistically before and after the request.
+func (dcb *DistributedCircuitBreaker[T]) Execute(req func() (T, error)) (T, error) {
+	return dcb.execute(func(Decision) (T, error) { return req() }, dcb.classify)
+}
+
+// ExecuteWithClassifier is like Execute, but the outcome of the request is determined by classify.
+// See CircuitBreaker.ExecuteWithClassifier.
+func (dcb *DistributedCircuitBreaker[T]) ExecuteWithClassifier(req func() (T, error), classify func(result T, err error) Outcome) (T, error) {
+	return dcb.execute(func(Decision) (T, error) { return req() }, classify)
+}
+
+// executeCounted is Execute that also returns the outcome of the request and whether the request ran,
+// which it didn't if it was rejected or the shared state couldn't be read.
+// The request run by FailOpen without counting it is classified all the same.
+func (dcb *DistributedCircuitBreaker[T]) executeCounted(req func() (T, error)) (result T, o Outcome, ran bool, err error) {
+	counted := false
+	result, err = dcb.execute(func(Decision) (T, error) {
+		ran = true
+		return req()
+	}, func(result T, err error) Outcome {
+		counted = true
+		o = dcb.classify(result, err)
+		return o
+	})
+	if ran && !counted {
+		o = dcb.classify(result, err)
+	}
+	return result, o, ran, err
+}
+
+// execute runs req through the shared state, giving it the Decision of its admission,
+// and counts its outcome determined by classify.
+func (dcb *DistributedCircuitBreaker[T]) execute(req func(d Decision) (T, error), classify func(T, error) Outcome) (t T, err error) {
+	if dcb.rejectsLocally() {
+		dcb.pendingRejections.Add(1)
+		return dcb.rejectedValue(), dcb.rejectionError(StateOpen, ErrOpenState)
+	}
+	if cas, ok := dcb.compareAndSwapStore(); ok {
+		return dcb.executeOptimistic(cas, req, classify)
+	}
+
+	// The shared state is read under the lock so that the write of the outcome doesn't lose
+	// a write of another instance made in between.
+	shared, err := dcb.lockSharedState()
+	if err != nil {
+		return dcb.executeUnavailable(req, classify, err)
+	}
+
+	panicked := true
+	defer func() {
+		if panicked {
+			dcb.bestEffort(dcb.unlock)
+			return
+		}
+		e := dcb.unlock()
+		if err == nil {
+			err = e
+		}
+	}()
+
 	dcb.inject(shared)
-	t, err = dcb.CircuitBreaker.Execute(req)
+	defer func() {
+		if panicked {
+			// The local CircuitBreaker has counted the panic as a failure.
+			dcb.bestEffort(func() error { return dcb.setSharedState(dcb.extract()) })
+		}
+	}()
+	t, err = dcb.serve(req, classify)
+	panicked = false
+	if errors.Is(err, ErrOpenState) || errors.Is(err, ErrTooManyRequests) {
+		dcb.pendingRejections.Add(1)
+	}
 	shared = dcb.extract()
 
 	e := dcb.setSharedState(shared)
@@ -214,3 +754,64 @@ func (dcb *DistributedCircuitBreaker[T]) Execute(req func() (T, error)) (t T, er
 
 	return t, err
 }
+
+// serve runs req through the local CircuitBreaker like ExecuteWithClassifier,
+// giving it the Decision of its admission.
+func (dcb *DistributedCircuitBreaker[T]) serve(req func(d Decision) (T, error), classify func(T, error) Outcome) (T, error) {
+	state, generation, age, err := dcb.CircuitBreaker.admit()
+	if err != nil {
+		return dcb.rejectedValue(), dcb.rejectionError(state, err)
+	}
+
+	d := Decision{Name: dcb.name, State: state, Generation: generation}
+	result, o, err := dcb.run(generation, age, func() (T, error) { return req(d) }, classify)
+	return result, dcb.requestError(state, o, err)
+}
+
+// admitShared admits a request through the shared state like Execute but without running it,
+// for the methods whose callers report the outcome later, e.g. Guard.
+// Unlike Execute, it returns the errors of SharedDataStore regardless of the StoreUnavailablePolicy.
+func (dcb *DistributedCircuitBreaker[T]) admitShared() (generation, age uint64, err error) {
+	if dcb.rejectsLocally() {
+		dcb.pendingRejections.Add(1)
+		return 0, 0, ErrOpenState
+	}
+
+	var admitErr error
+	err = dcb.updateShared(func() {
+		generation, age, admitErr = dcb.CircuitBreaker.beforeRequest()
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if errors.Is(admitErr, ErrOpenState) || errors.Is(admitErr, ErrTooManyRequests) {
+		dcb.pendingRejections.Add(1)
+	}
+	return generation, age, admitErr
+}
+
+// recordShared records an outcome by record in the shared state,
+// passing the error of SharedDataStore, if any, to the handler set by WithErrorHandler.
+func (dcb *DistributedCircuitBreaker[T]) recordShared(record func()) {
+	dcb.handleError(dcb.updateShared(record))
+}
+
+// executeUnavailable handles the request according to the StoreUnavailablePolicy
+// when SharedDataStore couldn't be locked or the shared state couldn't be read with err.
+func (dcb *DistributedCircuitBreaker[T]) executeUnavailable(req func(d Decision) (T, error), classify func(T, error) Outcome, err error) (T, error) {
+	if !storeUnavailable(err) {
+		var zero T
+		return zero, err
+	}
+
+	switch dcb.options.storeUnavailablePolicy {
+	case FallbackLocal:
+		return dcb.serve(req, classify)
+	case FailOpen:
+		// The request is neither admitted nor counted, like with GlobalModeDisableAll.
+		return req(Decision{Name: dcb.name, State: StateClosed, Generation: bypassGeneration})
+	default:
+		var zero T
+		return zero, err
+	}
+}
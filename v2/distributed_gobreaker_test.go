@@ -1,11 +1,16 @@
 package gobreaker
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"runtime"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -28,6 +33,7 @@ func setUpDCB() *DistributedCircuitBreaker[any] {
 		ReadyToTrip: func(counts Counts) bool {
 			return counts.ConsecutiveFailures > 5
 		},
+		Clock: newFakeClock(),
 	})
 	if err != nil {
 		panic(err)
@@ -49,21 +55,7 @@ func tearDownDCB(dcb *DistributedCircuitBreaker[any]) {
 }
 
 func dcbPseudoSleep(dcb *DistributedCircuitBreaker[any], period time.Duration) {
-	state, err := dcb.getSharedState()
-	if err != nil {
-		panic(err)
-	}
-
-	state.Expiry = state.Expiry.Add(-period)
-	// Reset counts if the interval has passed
-	if time.Now().After(state.Expiry) {
-		state.Counts = Counts{}
-	}
-
-	err = dcb.setSharedState(state)
-	if err != nil {
-		panic(err)
-	}
+	dcb.clock.(*fakeClock).advance(period)
 }
 
 func successRequest(dcb *DistributedCircuitBreaker[any]) error {
@@ -116,7 +108,7 @@ func TestDistributedCircuitBreakerStateTransitions(t *testing.T) {
 	assert.Equal(t, ErrOpenState, err)
 
 	// Wait for timeout so that the state will move to half-open
-	dcbPseudoSleep(dcb, dcb.timeout)
+	dcbPseudoSleep(dcb, dcb.timeout+time.Millisecond)
 	assertState(t, dcb, StateHalfOpen)
 
 	// StateHalfOpen to StateClosed
@@ -160,12 +152,12 @@ func TestDistributedCircuitBreakerCounts(t *testing.T) {
 	}
 
 	state, err := dcb.getSharedState()
-	assert.Equal(t, Counts{5, 5, 0, 5, 0}, state.Counts)
+	assert.Equal(t, Counts{5, 5, 0, 5, 0, 0, 0}, state.Counts)
 	assert.NoError(t, err)
 
 	assert.Nil(t, failRequest(dcb))
 	state, err = dcb.getSharedState()
-	assert.Equal(t, Counts{6, 5, 1, 0, 1}, state.Counts)
+	assert.Equal(t, Counts{6, 5, 1, 0, 1, 0, 1}, state.Counts)
 	assert.NoError(t, err)
 }
 
@@ -190,6 +182,7 @@ func TestCustomDistributedCircuitBreaker(t *testing.T) {
 			failureRatio := float64(counts.TotalFailures) / float64(numReqs)
 			return numReqs >= 3 && failureRatio >= 0.6
 		},
+		Clock: newFakeClock(),
 	})
 	assert.NoError(t, err)
 
@@ -208,16 +201,16 @@ func TestCustomDistributedCircuitBreaker(t *testing.T) {
 		state, err := customDCB.getSharedState()
 		assert.NoError(t, err)
 		assert.Equal(t, StateClosed, state.State)
-		assert.Equal(t, Counts{10, 5, 5, 0, 1}, state.Counts)
+		assert.Equal(t, Counts{10, 5, 5, 0, 1, 0, 5}, state.Counts)
 
 		// Perform one more successful request
 		assert.NoError(t, successRequest(customDCB))
 		state, err = customDCB.getSharedState()
 		assert.NoError(t, err)
-		assert.Equal(t, Counts{11, 6, 5, 1, 0}, state.Counts)
+		assert.Equal(t, Counts{11, 6, 5, 1, 0, 0, 5}, state.Counts)
 
 		// Simulate time passing to reset counts
-		dcbPseudoSleep(customDCB, time.Second*30)
+		dcbPseudoSleep(customDCB, time.Second*31)
 
 		// Perform requests to trigger StateOpen
 		assert.NoError(t, successRequest(customDCB))
@@ -229,12 +222,12 @@ func TestCustomDistributedCircuitBreaker(t *testing.T) {
 
 		state, err = customDCB.getSharedState()
 		assert.NoError(t, err)
-		assert.Equal(t, Counts{0, 0, 0, 0, 0}, state.Counts)
+		assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, state.Counts)
 	})
 
 	t.Run("Timeout and Half-Open State", func(t *testing.T) {
 		// Simulate timeout to transition to half-open state
-		dcbPseudoSleep(customDCB, time.Second*90)
+		dcbPseudoSleep(customDCB, time.Second*91)
 		assertState(t, customDCB, StateHalfOpen)
 
 		// Successful requests in half-open state should close the circuit
@@ -259,6 +252,7 @@ func TestCustomDistributedCircuitBreakerStateTransitions(t *testing.T) {
 		OnStateChange: func(name string, from State, to State) {
 			stateChange = StateChange{name, from, to}
 		},
+		Clock: newFakeClock(),
 	}
 
 	mr, err := miniredis.Run()
@@ -308,3 +302,852 @@ func TestCustomDistributedCircuitBreakerStateTransitions(t *testing.T) {
 		assert.Equal(t, StateChange{"cb", StateHalfOpen, StateClosed}, stateChange)
 	})
 }
+
+func TestRedisStoreOptions(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer mr.Close()
+
+	store := NewRedisStore(mr.Addr(), WithRedisKeyPrefix("app:"), WithRedisTTL(time.Hour))
+	defer store.Close()
+	dcb, err := NewDistributedCircuitBreaker[any](store, Settings{Name: "prefixed"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, successRequest(dcb))
+	assert.NoError(t, failRequest(dcb))
+	key := "app:" + dcb.sharedStateKey()
+	assert.True(t, mr.Exists(key))
+	assert.False(t, mr.Exists(dcb.sharedStateKey()))
+	assert.Equal(t, time.Hour, mr.TTL(key))
+
+	data, err := store.GetData(dcb.sharedStateKey())
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"state":0`)
+
+	// the state of an abandoned breaker expires
+	mr.FastForward(time.Hour + time.Second)
+	assert.False(t, mr.Exists(key))
+
+	// the same store from a client without options
+	plain := NewRedisStoreFromClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	defer plain.Close()
+	assert.NoError(t, plain.SetData("key", []byte("data")))
+	assert.True(t, mr.Exists("key"))
+	assert.Equal(t, time.Duration(0), mr.TTL("key"))
+}
+
+func TestDistributedCircuitBreakerExpiresAfter(t *testing.T) {
+	dcb := setUpDCB()
+	defer tearDownDCB(dcb)
+
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, failRequest(dcb))
+	}
+	state, err := dcb.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, StateOpen, state.State)
+	assert.Equal(t, 2*time.Second, state.ExpiresAfter)
+	assert.Equal(t, state.StateChangedAt.Add(2*time.Second), state.Expiry)
+
+	// the expiry is derived from StateChangedAt rather than from Expiry
+	state.Expiry = state.StateChangedAt.Add(time.Hour)
+	state.ExpiresAfter = time.Second
+	assert.NoError(t, dcb.setSharedState(state))
+	dcbPseudoSleep(dcb, time.Second+time.Millisecond)
+	assertState(t, dcb, StateHalfOpen)
+
+	// Expiry is used without ExpiresAfter
+	assert.NoError(t, dcb.ResetShared())
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, failRequest(dcb))
+	}
+	state, err = dcb.getSharedState()
+	assert.NoError(t, err)
+	state.ExpiresAfter = 0
+	state.Expiry = state.StateChangedAt.Add(time.Hour)
+	assert.NoError(t, dcb.setSharedState(state))
+	dcbPseudoSleep(dcb, time.Minute)
+	assertState(t, dcb, StateOpen)
+}
+
+func TestDistributedCircuitBreakerSharedStateVersion(t *testing.T) {
+	dcb := setUpDCB()
+	defer tearDownDCB(dcb)
+
+	state, err := dcb.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, SharedStateVersion, state.Version)
+	data, err := dcb.store.GetData(dcb.sharedStateKey())
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"state":0`)
+
+	// the versions that read State as a number can read the state
+	var released struct {
+		State int `json:"state"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &released))
+	assert.Equal(t, int(StateClosed), released.State)
+
+	// the state written before the format was versioned
+	legacy := `{"state":2,"generation":7,"counts":{"Requests":0,"TotalSuccesses":0,"TotalFailures":0,"ConsecutiveSuccesses":0,"ConsecutiveFailures":0},"expiry":"2100-01-01T00:00:00Z"}`
+	assert.NoError(t, dcb.store.SetData(dcb.sharedStateKey(), []byte(legacy)))
+
+	state, err = dcb.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, SharedStateVersion, state.Version)
+	assert.Equal(t, StateOpen, state.State)
+	assert.Equal(t, uint64(7), state.Generation)
+	assertState(t, dcb, StateOpen)
+
+	state, err = dcb.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, SharedStateVersion, state.Version)
+
+	// the state written in a newer format
+	newer := `{"version":99,"state":0}`
+	assert.NoError(t, dcb.store.SetData(dcb.sharedStateKey(), []byte(newer)))
+
+	_, err = dcb.getSharedState()
+	assert.ErrorIs(t, err, ErrUnsupportedSharedState)
+	_, err = dcb.State()
+	assert.ErrorIs(t, err, ErrUnsupportedSharedState)
+}
+
+func TestDistributedCircuitBreakerStateAge(t *testing.T) {
+	cache := newMapCache()
+	clock := newFakeClock()
+	settings := Settings{Name: "age", Clock: clock}
+	dcb1, err := NewDistributedCircuitBreaker[any](NewCacheStore(cache.get, cache.set), settings)
+	assert.NoError(t, err)
+
+	clock.advance(time.Minute)
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, failRequest(dcb1))
+	}
+	clock.advance(time.Second)
+
+	// another instance derives the age from the shared state
+	dcb2, err := NewDistributedCircuitBreaker[any](NewCacheStore(cache.get, cache.set), settings)
+	assert.NoError(t, err)
+	age, err := dcb2.StateAge()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, age)
+
+	state, err := dcb2.getSharedState()
+	assert.NoError(t, err)
+	assert.True(t, clock.Now().Add(-time.Second).Equal(state.StateChangedAt))
+}
+
+func TestDistributedCircuitBreakerSaturationBackoff(t *testing.T) {
+	cache := newMapCache()
+	clock := newFakeClock()
+	settings := Settings{
+		Name:              "backoff",
+		Timeout:           time.Minute,
+		SaturationBackoff: 2,
+		Clock:             clock,
+	}
+	dcb1, err := NewDistributedCircuitBreaker[any](NewCacheStore(cache.get, cache.set), settings)
+	assert.NoError(t, err)
+	dcb2, err := NewDistributedCircuitBreaker[any](NewCacheStore(cache.get, cache.set), settings)
+	assert.NoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, failRequest(dcb1))
+	}
+	clock.advance(time.Minute + time.Second)
+
+	// dcb1 saturates the half-open state and fails the probe
+	_, err = dcb1.Execute(func() (any, error) {
+		_, err := dcb1.CircuitBreaker.Execute(func() (any, error) { return nil, nil })
+		assert.Equal(t, ErrTooManyRequests, err)
+		return nil, errors.New("fail")
+	})
+	assert.Error(t, err)
+	state, err := dcb1.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, StateOpen, state.State)
+	assert.Equal(t, 2*time.Minute, state.OpenTimeout)
+	assert.True(t, clock.Now().Add(2*time.Minute).Equal(state.Expiry))
+
+	// dcb2 keeps the backoff of dcb1 when its probe fails
+	clock.advance(2*time.Minute + time.Second)
+	assert.NoError(t, failRequest(dcb2))
+	state, err = dcb2.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, StateOpen, state.State)
+	assert.True(t, clock.Now().Add(2*time.Minute).Equal(state.Expiry))
+
+	// the backoff is reset by the recovery on either instance
+	clock.advance(2*time.Minute + time.Second)
+	assert.NoError(t, successRequest(dcb1))
+	state, err = dcb2.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, StateClosed, state.State)
+	assert.Equal(t, time.Minute, state.OpenTimeout)
+	assert.False(t, state.Saturated)
+}
+
+func TestDistributedCircuitBreakerRejections(t *testing.T) {
+	cache := newMapCache()
+	clock := newFakeClock()
+	settings := Settings{Name: "rejections", Timeout: time.Minute, Clock: clock}
+	dcb1, err := NewDistributedCircuitBreaker[any](NewCacheStore(cache.get, cache.set), settings)
+	assert.NoError(t, err)
+	dcb2, err := NewDistributedCircuitBreaker[any](NewCacheStore(cache.get, cache.set), settings,
+		WithOpenStateCache(10*time.Second))
+	assert.NoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, failRequest(dcb1))
+	}
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, ErrOpenState, successRequest(dcb1))
+	}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, ErrOpenState, successRequest(dcb2))
+	}
+
+	// the rejections are aggregated in the shared state,
+	// except those by the open state cached by the first rejection of dcb2
+	state, err := dcb1.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), state.Rejections)
+
+	// the rejections by the cached open state are written along with the next write
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, ErrOpenState, successRequest(dcb2))
+	}
+	rejections, err := dcb2.Rejections()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(9), rejections)
+	rejections, err = dcb1.Rejections()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), rejections)
+
+	clock.advance(10 * time.Second)
+	assert.Equal(t, ErrOpenState, successRequest(dcb2))
+	state, err = dcb1.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), state.Rejections)
+
+	// the rejections are never cleared
+	clock.advance(time.Minute)
+	assert.NoError(t, successRequest(dcb1))
+	assertState(t, dcb1, StateClosed)
+	rejections, err = dcb1.Rejections()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), rejections)
+}
+
+func TestDistributedCircuitBreakerBucketPeriod(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	store := NewRedisStore(mr.Addr())
+	defer store.Close()
+
+	dcb, err := NewDistributedCircuitBreaker[any](store, Settings{
+		Name:         "cb",
+		Interval:     3 * time.Second,
+		BucketPeriod: time.Second,
+		Clock:        newFakeClock(),
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, failRequest(dcb))
+	dcbPseudoSleep(dcb, time.Second)
+	assert.NoError(t, successRequest(dcb))
+
+	state, err := dcb.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{2, 1, 1, 1, 0, 0, 1}, state.Counts)
+	assert.Equal(t, uint64(1), state.BucketAge)
+	assert.Equal(t, 3, len(state.Buckets))
+
+	// the first bucket is dropped from the shared state
+	dcbPseudoSleep(dcb, 2*time.Second)
+	assert.NoError(t, successRequest(dcb))
+	state, err = dcb.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{2, 2, 0, 2, 0, 0, 0}, state.Counts)
+	assert.Equal(t, uint64(3), state.BucketAge)
+}
+
+// mockStore is a SharedDataStore whose reads fail while failures is positive
+// and whose Lock fails while lockFailures is positive.
+type mockStore struct {
+	SharedDataStore
+	failures     int
+	reads        int
+	setFailures  int
+	setPanics    bool
+	lockFailures int
+	locks        int
+}
+
+var errStoreUnavailable = errors.New("store unavailable")
+
+func (ms *mockStore) Lock(name string) error {
+	if ms.lockFailures > 0 {
+		ms.lockFailures--
+		return errStoreUnavailable
+	}
+	ms.locks++
+	return ms.SharedDataStore.Lock(name)
+}
+
+func (ms *mockStore) GetData(name string) ([]byte, error) {
+	ms.reads++
+	if ms.failures > 0 {
+		ms.failures--
+		return nil, errStoreUnavailable
+	}
+	return ms.SharedDataStore.GetData(name)
+}
+
+func (ms *mockStore) SetData(name string, data []byte) error {
+	if ms.setPanics {
+		panic("store")
+	}
+	if ms.setFailures > 0 {
+		ms.setFailures--
+		return errStoreUnavailable
+	}
+	return ms.SharedDataStore.SetData(name, data)
+}
+
+func newMockStoreDCB(t *testing.T, opts ...DistributedOption) (*DistributedCircuitBreaker[any], *mockStore) {
+	cache := newMapCache()
+	store := &mockStore{SharedDataStore: NewCacheStore(cache.get, cache.set)}
+	dcb, err := NewDistributedCircuitBreaker[any](store, Settings{Name: "mock"}, opts...)
+	assert.NoError(t, err)
+	store.reads = 0
+	return dcb, store
+}
+
+// blockingLockStore is a SharedDataStore whose Lock waits for the lock to be released.
+// Lock yields to the other goroutines first as a round trip to a remote store would.
+type blockingLockStore struct {
+	SharedDataStore
+	mutex sync.Mutex
+}
+
+func (bs *blockingLockStore) Lock(name string) error {
+	runtime.Gosched()
+	bs.mutex.Lock()
+	return nil
+}
+
+func (bs *blockingLockStore) Unlock(name string) error {
+	bs.mutex.Unlock()
+	return nil
+}
+
+func TestDistributedCircuitBreakerConcurrentWrites(t *testing.T) {
+	cache := newMapCache()
+	store := &blockingLockStore{SharedDataStore: NewCacheStore(cache.get, cache.set)}
+	settings := Settings{Name: "concurrent", Clock: newFakeClock()}
+	dcb1, err := NewDistributedCircuitBreaker[any](store, settings)
+	assert.NoError(t, err)
+	dcb2, err := NewDistributedCircuitBreaker[any](store, settings)
+	assert.NoError(t, err)
+
+	const requests = 1000
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for _, dcb := range []*DistributedCircuitBreaker[any]{dcb1, dcb2} {
+		wg.Add(1)
+		go func(dcb *DistributedCircuitBreaker[any]) {
+			defer wg.Done()
+			<-start
+			for i := 0; i < requests; i++ {
+				assert.NoError(t, successRequest(dcb))
+			}
+		}(dcb)
+	}
+	close(start)
+	wg.Wait()
+
+	// no increment of either instance is lost
+	state, err := dcb1.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2*requests), state.Counts.Requests)
+	assert.Equal(t, uint32(2*requests), state.Counts.TotalSuccesses)
+}
+
+func TestDistributedCircuitBreakerStoreReadRetry(t *testing.T) {
+	dcb, store := newMockStoreDCB(t, WithStoreReadRetry(3, time.Millisecond))
+
+	store.failures = 2
+	assert.NoError(t, successRequest(dcb))
+	assert.Equal(t, 3, store.reads)
+
+	store.reads = 0
+	store.failures = 3
+	assert.ErrorIs(t, successRequest(dcb), errStoreUnavailable)
+	assert.Equal(t, 3, store.reads)
+
+	state, err := dcb.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0, 0}, state.Counts)
+}
+
+func TestDistributedCircuitBreakerStoreUnavailablePolicy(t *testing.T) {
+	ran := false
+	req := func() (any, error) {
+		ran = true
+		return nil, nil
+	}
+
+	dcb, store := newMockStoreDCB(t, WithStoreReadRetry(1, 0))
+	store.failures = 1
+	_, err := dcb.Execute(req)
+	assert.ErrorIs(t, err, errStoreUnavailable)
+	assert.False(t, ran)
+
+	// FallbackLocal counts the request only in the local CircuitBreaker
+	dcb, store = newMockStoreDCB(t, WithStoreReadRetry(1, 0), WithStoreUnavailablePolicy(FallbackLocal))
+	store.failures = 1
+	_, err = dcb.Execute(req)
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0, 0}, dcb.Counts())
+	state, err := dcb.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, state.Counts)
+
+	ran = false
+	dcb, store = newMockStoreDCB(t, WithStoreReadRetry(1, 0), WithStoreUnavailablePolicy(FailOpen))
+	store.failures = 1
+	_, err = dcb.Execute(req)
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, dcb.Counts())
+}
+
+func TestDistributedCircuitBreakerStoreUnavailablePolicyLock(t *testing.T) {
+	ran := false
+	req := func() (any, error) {
+		ran = true
+		return nil, nil
+	}
+
+	// the lock is retried until the timeout
+	dcb, store := newMockStoreDCB(t, WithLockRetry(time.Second, time.Millisecond))
+	store.lockFailures = 2
+	assert.NoError(t, successRequest(dcb))
+	assert.Equal(t, 0, store.lockFailures)
+
+	dcb, store = newMockStoreDCB(t, WithLockRetry(0, 0))
+	store.lockFailures = 1
+	_, err := dcb.Execute(req)
+	assert.ErrorIs(t, err, errStoreUnavailable)
+	assert.False(t, ran)
+	assert.Equal(t, 0, store.reads)
+
+	// the policies apply when the store can't be locked
+	dcb, store = newMockStoreDCB(t, WithLockRetry(0, 0), WithStoreUnavailablePolicy(FallbackLocal))
+	store.lockFailures = 1
+	_, err = dcb.Execute(req)
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0, 0}, dcb.Counts())
+
+	ran = false
+	dcb, store = newMockStoreDCB(t, WithLockRetry(0, 0), WithStoreUnavailablePolicy(FailOpen))
+	store.lockFailures = 1
+	_, err = dcb.Execute(req)
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, dcb.Counts())
+}
+
+func TestDistributedCircuitBreakerStoreReadRetryUnlocked(t *testing.T) {
+	dcb, store := newMockStoreDCB(t, WithStoreReadRetry(3, time.Millisecond))
+	store.failures = 2
+	store.locks = 0
+
+	// the lock is released while waiting for the next read and taken again for it
+	assert.NoError(t, successRequest(dcb))
+	assert.Equal(t, 3, store.reads)
+	assert.Equal(t, 3, store.locks)
+}
+
+func TestDistributedCircuitBreakerExecuteContextDone(t *testing.T) {
+	dcb, store := newMockStoreDCB(t)
+	store.locks = 0
+
+	// the request of a done context doesn't touch the store
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	_, err := dcb.ExecuteContext(ctx, func(ctx context.Context) (any, error) {
+		called = true
+		return nil, nil
+	})
+	assert.False(t, called)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, store.reads)
+	assert.Equal(t, 0, store.locks)
+
+	state, err := dcb.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{}, state.Counts)
+}
+
+func TestDistributedCircuitBreakerPanic(t *testing.T) {
+	var handled []error
+	dcb, store := newMockStoreDCB(t, WithErrorHandler(func(err error) {
+		handled = append(handled, err)
+	}))
+	panicRequest := func() {
+		dcb.Execute(func() (any, error) { panic("request") })
+	}
+
+	// the failure is written to the shared state
+	assert.PanicsWithValue(t, "request", panicRequest)
+	state, err := dcb.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, state.Counts)
+	assert.Empty(t, handled)
+
+	// an error of the store doesn't replace the panic
+	store.setFailures = 1
+	assert.PanicsWithValue(t, "request", panicRequest)
+	assert.Equal(t, []error{errStoreUnavailable}, handled)
+	state, err = dcb.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, state.Counts)
+
+	// neither does a panic of the store
+	store.setPanics = true
+	assert.PanicsWithValue(t, "request", panicRequest)
+	assert.Len(t, handled, 2)
+	assert.EqualError(t, handled[1], "panic in SharedDataStore: store")
+
+	// the store keeps working after the panics
+	store.setPanics = false
+	assert.NoError(t, successRequest(dcb))
+	assert.Len(t, handled, 2)
+}
+
+func TestDistributedCircuitBreakerResetShared(t *testing.T) {
+	cache := newMapCache()
+	settings := Settings{Name: "reset", Clock: newFakeClock()}
+	dcb1, err := NewDistributedCircuitBreaker[any](NewCacheStore(cache.get, cache.set), settings)
+	assert.NoError(t, err)
+	dcb2, err := NewDistributedCircuitBreaker[any](NewCacheStore(cache.get, cache.set), settings)
+	assert.NoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, failRequest(dcb1))
+	}
+	assertState(t, dcb1, StateOpen)
+	assertState(t, dcb2, StateOpen)
+
+	// the local Reset is overwritten by the shared state
+	dcb2.Reset()
+	assert.Equal(t, StateClosed, dcb2.CircuitBreaker.State())
+	assertState(t, dcb2, StateOpen)
+
+	before, err := dcb1.getSharedState()
+	assert.NoError(t, err)
+	assert.NoError(t, dcb2.ResetShared())
+
+	state, err := dcb1.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, StateClosed, state.State)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, state.Counts)
+	assert.Greater(t, state.Generation, before.Generation)
+	assertState(t, dcb1, StateClosed)
+	assertState(t, dcb2, StateClosed)
+
+	assert.NoError(t, successRequest(dcb1))
+	assert.NoError(t, successRequest(dcb2))
+	state, err = dcb1.getSharedState()
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{2, 2, 0, 2, 0, 0, 0}, state.Counts)
+}
+
+func TestDistributedCircuitBreakerName(t *testing.T) {
+	cache := newMapCache()
+	store := NewCacheStore(cache.get, cache.set)
+
+	_, err := NewDistributedCircuitBreaker[any](store, Settings{})
+	assert.ErrorIs(t, err, ErrEmptyName)
+	assert.Empty(t, cache.data)
+
+	hosts := []string{"a.example.com", "b.example.com"}
+	keys := make(map[string]bool)
+	for _, host := range hosts {
+		dcb, err := NewDistributedCircuitBreaker[any](store, Settings{
+			NameFunc: func() string { return "host:" + host },
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "host:"+host, dcb.Name())
+		keys[dcb.sharedStateKey()] = true
+	}
+	assert.Equal(t, len(hosts), len(keys))
+	assert.Equal(t, len(hosts), len(cache.data))
+}
+
+// watchStore is a WatchableStore that pushes every write to its watchers synchronously.
+type watchStore struct {
+	SharedDataStore
+	mutex    sync.Mutex
+	reads    int
+	watchers map[string][]chan []byte
+}
+
+func newWatchStore() *watchStore {
+	cache := newMapCache()
+	return &watchStore{
+		SharedDataStore: NewCacheStore(cache.get, cache.set),
+		watchers:        make(map[string][]chan []byte),
+	}
+}
+
+func (ws *watchStore) GetData(name string) ([]byte, error) {
+	ws.mutex.Lock()
+	ws.reads++
+	ws.mutex.Unlock()
+	return ws.SharedDataStore.GetData(name)
+}
+
+func (ws *watchStore) SetData(name string, data []byte) error {
+	err := ws.SharedDataStore.SetData(name, data)
+	if err != nil {
+		return err
+	}
+
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	for _, ch := range ws.watchers[name] {
+		ch <- data
+	}
+	return nil
+}
+
+func (ws *watchStore) Watch(name string) (<-chan []byte, func(), error) {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	ch := make(chan []byte, 16)
+	ws.watchers[name] = append(ws.watchers[name], ch)
+	return ch, func() {
+		ws.mutex.Lock()
+		defer ws.mutex.Unlock()
+
+		watchers := ws.watchers[name]
+		for i, w := range watchers {
+			if w == ch {
+				ws.watchers[name] = append(watchers[:i], watchers[i+1:]...)
+				close(ch)
+				return
+			}
+		}
+	}, nil
+}
+
+func (ws *watchStore) readCount() int {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	return ws.reads
+}
+
+func TestDistributedCircuitBreakerWatchableStore(t *testing.T) {
+	store := newWatchStore()
+	settings := Settings{Name: "watch", Clock: newFakeClock()}
+	dcb1, err := NewDistributedCircuitBreaker[any](store, settings)
+	assert.NoError(t, err)
+	dcb2, err := NewDistributedCircuitBreaker[any](store, settings)
+	assert.NoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, failRequest(dcb1))
+	}
+	assertState(t, dcb1, StateOpen)
+	reads := store.readCount()
+
+	// the state pushed by dcb1 reaches dcb2 without reading the store
+	assert.Eventually(t, func() bool {
+		state, err := dcb2.State()
+		return err == nil && state == StateOpen
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, ErrOpenState, successRequest(dcb2))
+	assert.Equal(t, reads, store.readCount())
+
+	// after Close, the shared state is read from the store
+	assert.NoError(t, dcb2.Close())
+	assert.Eventually(t, func() bool { return !dcb2.watching.Load() }, time.Second, time.Millisecond)
+	assertState(t, dcb2, StateOpen)
+	assert.Greater(t, store.readCount(), reads)
+	assert.NoError(t, dcb1.Close())
+}
+
+func TestDistributedCircuitBreakerOpenStateCache(t *testing.T) {
+	cache := newMapCache()
+	store := &mockStore{SharedDataStore: NewCacheStore(cache.get, cache.set)}
+	clock := newFakeClock()
+	settings := Settings{Name: "cached", Timeout: time.Minute, Clock: clock}
+	dcb, err := NewDistributedCircuitBreaker[any](store, settings, WithOpenStateCache(10*time.Second))
+	assert.NoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, failRequest(dcb))
+	}
+
+	// the sustained open state is not read from the store
+	store.reads = 0
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, ErrOpenState, successRequest(dcb))
+	}
+	assert.Equal(t, 0, store.reads)
+
+	// the cache expires after maxAge
+	clock.advance(10 * time.Second)
+	assert.Equal(t, ErrOpenState, successRequest(dcb))
+	assert.Equal(t, ErrOpenState, successRequest(dcb))
+	assert.Equal(t, 1, store.reads)
+
+	// the cache is not used once the state may be half-open
+	clock.advance(50*time.Second + time.Millisecond)
+	assert.NoError(t, successRequest(dcb))
+	assert.Equal(t, 2, store.reads)
+	assertState(t, dcb, StateClosed)
+
+	// without the option, every request reads the store
+	other, err := NewDistributedCircuitBreaker[any](store, settings)
+	assert.NoError(t, err)
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, failRequest(other))
+	}
+	store.reads = 0
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, ErrOpenState, successRequest(other))
+	}
+	assert.Equal(t, 10, store.reads)
+}
+
+// sharedStore is a store for the tests of the methods that go through the shared state,
+// with the options of the instances that share it.
+type sharedStore struct {
+	store   SharedDataStore
+	options []DistributedOption
+}
+
+// sharedStores returns the stores for the tests of the methods that go through the shared state,
+// with and without CompareAndSwapStore.
+func sharedStores() map[string]sharedStore {
+	cache := newMapCache()
+	return map[string]sharedStore{
+		"lock":             {store: NewCacheStore(cache.get, cache.set)},
+		"compare-and-swap": {store: newCASStore(), options: []DistributedOption{WithCompareAndSwapAttempts(3)}},
+	}
+}
+
+func TestDistributedCircuitBreakerOverride(t *testing.T) {
+	for name, shared := range sharedStores() {
+		t.Run(name, func(t *testing.T) {
+			settings := Settings{Name: "override", Clock: newFakeClock()}
+			dcb1, err := NewDistributedCircuitBreaker[any](shared.store, settings, shared.options...)
+			assert.NoError(t, err)
+			dcb2, err := NewDistributedCircuitBreaker[any](shared.store, settings, shared.options...)
+			assert.NoError(t, err)
+
+			assert.NoError(t, dcb1.ForceOpen())
+			assert.Equal(t, ErrOpenState, successRequest(dcb2))
+			assertState(t, dcb2, StateForcedOpen)
+
+			assert.NoError(t, dcb2.ClearOverride())
+			assertState(t, dcb1, StateOpen)
+
+			assert.NoError(t, dcb1.AllowProbe())
+			assertState(t, dcb2, StateHalfOpen)
+
+			assert.NoError(t, dcb2.ForceClose())
+			for i := 0; i < 10; i++ {
+				_, err = dcb1.Execute(func() (any, error) { return nil, errors.New("fail") })
+				assert.EqualError(t, err, "fail")
+			}
+			assertState(t, dcb2, StateForcedClosed)
+		})
+	}
+}
+
+func TestDistributedCircuitBreakerSharedRequests(t *testing.T) {
+	for name, shared := range sharedStores() {
+		t.Run(name, func(t *testing.T) {
+			settings := Settings{Name: "requests", Clock: newFakeClock()}
+			dcb1, err := NewDistributedCircuitBreaker[any](shared.store, settings, shared.options...)
+			assert.NoError(t, err)
+			dcb2, err := NewDistributedCircuitBreaker[any](shared.store, settings, shared.options...)
+			assert.NoError(t, err)
+
+			// the attempts of one instance trip the shared state
+			attempts := 0
+			_, err = dcb1.ExecuteWithRetry(context.Background(), RetryPolicy{MaxAttempts: 10}, func(ctx context.Context) (any, error) {
+				attempts++
+				return nil, errors.New("fail")
+			})
+			assert.Equal(t, ErrOpenState, err)
+			assert.Equal(t, 6, attempts)
+
+			// and the other instance rejects the requests of every kind
+			_, err = dcb2.ExecuteContext(context.Background(), func(ctx context.Context) (any, error) { return nil, nil })
+			assert.Equal(t, ErrOpenState, err)
+			_, done, err := dcb2.Guard(context.Background())
+			assert.Nil(t, done)
+			assert.Equal(t, ErrOpenState, err)
+			_, _, _, err = dcb2.StreamAllow()
+			assert.Equal(t, ErrOpenState, err)
+			_, ran, err := dcb2.Probe(func() (any, error) { return nil, nil })
+			assert.False(t, ran)
+			assert.Equal(t, ErrOpenState, err)
+			result, err := dcb2.ExecuteWithFallback(func() (any, error) { return nil, nil }, func(err error) (any, error) {
+				assert.Equal(t, ErrOpenState, err)
+				return "fallback", nil
+			})
+			assert.Equal(t, "fallback", result)
+			assert.NoError(t, err)
+
+			snapshot, err := dcb2.Snapshot()
+			assert.NoError(t, err)
+			assert.Equal(t, StateOpen, snapshot.State)
+
+			// the snapshot restored by one instance replaces the shared state
+			assert.NoError(t, dcb2.ResetShared())
+			closed, err := dcb2.Snapshot()
+			assert.NoError(t, err)
+			assert.NoError(t, dcb1.Restore(snapshot))
+			assertState(t, dcb2, StateOpen)
+			assert.NoError(t, dcb2.Restore(closed))
+			assertState(t, dcb1, StateClosed)
+
+			// the outcomes reported later are written to the shared state
+			ctx, done, err := dcb1.Guard(context.Background())
+			assert.NoError(t, err)
+			onEvent, onDone, _, err := dcb2.StreamAllow()
+			assert.NoError(t, err)
+			onEvent(errors.New("fail"))
+			done(ctx.Err())
+			onDone(nil)
+			assertState(t, dcb1, StateClosed)
+			assert.Equal(t, Counts{3, 2, 1, 2, 0, 0, 1}, dcb1.Counts())
+
+			_, err = dcb2.ExecuteContext(context.Background(), func(ctx context.Context) (any, error) {
+				d, ok := DecisionFromContext(ctx)
+				assert.True(t, ok)
+				assert.Equal(t, Decision{Name: "requests", State: StateClosed, Generation: closed.Generation}, d)
+				return nil, nil
+			})
+			assert.NoError(t, err)
+		})
+	}
+}
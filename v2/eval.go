@@ -0,0 +1,53 @@
+package gobreaker
+
+import "time"
+
+// Close stops the periodic evaluation of ReadyToTrip started by Settings.EvalInterval
+// and the timer of Settings.StateChangeThrottle, if any.
+// The CircuitBreaker keeps working after Close, calling ReadyToTrip only when a request fails.
+// Close is safe to call more than once and on a CircuitBreaker without EvalInterval.
+func (cb *CircuitBreaker[T]) Close() error {
+	cb.closeOnce.Do(func() {
+		if cb.stopEval != nil {
+			close(cb.stopEval)
+		}
+		cb.stopThrottleTimer()
+	})
+	return nil
+}
+
+// Close stops the periodic evaluation of ReadyToTrip. See CircuitBreaker.Close.
+func (tscb *TwoStepCircuitBreaker[T]) Close() error {
+	return tscb.cb.Close()
+}
+
+// startEval calls ReadyToTrip every interval until Close is called.
+func (cb *CircuitBreaker[T]) startEval(interval time.Duration) {
+	cb.stopEval = make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cb.evaluate()
+			case <-cb.stopEval:
+				return
+			}
+		}
+	}()
+}
+
+// evaluate calls ReadyToTrip and ReadyToTripOnLatency, if any, with the current Counts in the closed state
+// and trips the CircuitBreaker if it returns true.
+func (cb *CircuitBreaker[T]) evaluate() {
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	now := cb.clock.Now()
+	state, _, _ := cb.currentState(now)
+	if state == StateClosed && cb.canTrip(now) && (cb.readyToTrip(cb.tripCounts()) || cb.tripsOnLatency()) {
+		cb.setState(StateOpen, now)
+	}
+}
@@ -0,0 +1,84 @@
+package gobreaker
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalInterval(t *testing.T) {
+	var unhealthy atomic.Bool
+	cb := NewCircuitBreaker[bool](Settings{
+		Name:         "eval",
+		EvalInterval: 10 * time.Millisecond,
+		ReadyToTrip: func(counts Counts) bool {
+			return unhealthy.Load()
+		},
+	})
+	defer cb.Close()
+
+	assert.Nil(t, succeed(cb))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, StateClosed, cb.State())
+
+	unhealthy.Store(true)
+	assert.Eventually(t, func() bool { return cb.PeekState() == StateOpen }, time.Second, 5*time.Millisecond)
+}
+
+func TestEvalIntervalDisabled(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{
+		Name:        "eval",
+		ReadyToTrip: func(counts Counts) bool { return true },
+	})
+	defer cb.Close()
+
+	assert.Nil(t, cb.stopEval)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func TestEvalIntervalClose(t *testing.T) {
+	var unhealthy atomic.Bool
+	cb := NewCircuitBreaker[bool](Settings{
+		Name:         "eval",
+		EvalInterval: 5 * time.Millisecond,
+		ReadyToTrip: func(counts Counts) bool {
+			return unhealthy.Load()
+		},
+	})
+
+	assert.NoError(t, cb.Close())
+	assert.NoError(t, cb.Close())
+
+	unhealthy.Store(true)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, StateClosed, cb.State())
+
+	// a failure still calls ReadyToTrip
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestEvalIntervalIgnoreFirstN(t *testing.T) {
+	var unhealthy atomic.Bool
+	unhealthy.Store(true)
+	cb := NewCircuitBreaker[bool](Settings{
+		Name:         "eval",
+		EvalInterval: 5 * time.Millisecond,
+		IgnoreFirstN: 2,
+		ReadyToTrip: func(counts Counts) bool {
+			return unhealthy.Load()
+		},
+	})
+	defer cb.Close()
+
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, succeed(cb))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, StateClosed, cb.State())
+
+	assert.Nil(t, succeed(cb))
+	assert.Eventually(t, func() bool { return cb.PeekState() == StateOpen }, time.Second, 5*time.Millisecond)
+}
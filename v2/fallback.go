@@ -0,0 +1,35 @@
+package gobreaker
+
+// ExecuteWithFallback is like Execute but calls fallback instead of returning an error
+// whenever the CircuitBreaker rejects the request or the request is counted as a failure,
+// e.g. to serve a cached or degraded response in a single place.
+// fallback is called with the error that Execute would return, e.g. ErrOpenState,
+// ErrTooManyRequests or the error of the request, which is nil if the request failed without an error,
+// e.g. by IsSuccessfulResult. The result and the error of fallback are returned as is
+// and never affect the Counts of the CircuitBreaker.
+// The requests counted as a success or excluded return their result and error like Execute,
+// and a panic in the request occurs again without calling fallback.
+func (cb *CircuitBreaker[T]) ExecuteWithFallback(req func() (T, error), fallback func(err error) (T, error)) (T, error) {
+	state, generation, age, err := cb.admit()
+	if err != nil {
+		return fallback(cb.rejectionError(state, err))
+	}
+
+	result, o, err := cb.run(generation, age, req, cb.classify)
+	if o == OutcomeFailure {
+		return fallback(cb.requestError(state, o, err))
+	}
+	return result, cb.requestError(state, o, err)
+}
+
+// ExecuteWithFallback is like Execute of DistributedCircuitBreaker but calls fallback instead of returning an error
+// whenever the request is rejected or counted as a failure. See CircuitBreaker.ExecuteWithFallback.
+// fallback is also called with the error of SharedDataStore if the shared state can't be read
+// and the StoreUnavailablePolicy doesn't run the request.
+func (dcb *DistributedCircuitBreaker[T]) ExecuteWithFallback(req func() (T, error), fallback func(err error) (T, error)) (T, error) {
+	result, o, ran, err := dcb.executeCounted(req)
+	if !ran || o == OutcomeFailure {
+		return fallback(err)
+	}
+	return result, err
+}
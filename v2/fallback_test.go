@@ -0,0 +1,68 @@
+package gobreaker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteWithFallback(t *testing.T) {
+	cb := NewCircuitBreaker[string](Settings{IsExcluded: isExcluded})
+	errFallback := errors.New("fallback failed")
+	var fallbackErrs []error
+	fallback := func(err error) (string, error) {
+		fallbackErrs = append(fallbackErrs, err)
+		if len(fallbackErrs) == 7 {
+			return "", errFallback
+		}
+		return "cached", nil
+	}
+	request := func(result string, err error) (string, error) {
+		return cb.ExecuteWithFallback(func() (string, error) { return result, err }, fallback)
+	}
+
+	result, err := request("fresh", nil)
+	assert.Equal(t, "fresh", result)
+	assert.NoError(t, err)
+
+	result, err = request("", errExcluded)
+	assert.Equal(t, "", result)
+	assert.Equal(t, errExcluded, err)
+	assert.Empty(t, fallbackErrs)
+
+	errFailed := errors.New("failed")
+	for i := 0; i < 6; i++ {
+		result, err = request("", errFailed)
+		assert.Equal(t, "cached", result)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	result, err = request("fresh", nil)
+	assert.Equal(t, "", result)
+	assert.Equal(t, errFallback, err)
+	assert.Equal(t, []error{errFailed, errFailed, errFailed, errFailed, errFailed, errFailed, ErrOpenState}, fallbackErrs)
+
+	// the fallback doesn't affect Counts
+	cb.Reset()
+	result, err = request("", errFailed)
+	assert.Equal(t, "cached", result)
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, cb.Counts())
+}
+
+func TestExecuteWithFallbackWrapErrors(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{WrapErrors: true})
+	var got error
+	_, err := cb.ExecuteWithFallback(func() (int, error) { return 0, errors.New("failed") }, func(err error) (int, error) {
+		got = err
+		return 1, nil
+	})
+	assert.NoError(t, err)
+
+	var be *BreakerError
+	assert.True(t, errors.As(got, &be))
+	assert.Equal(t, OutcomeFailure, be.Outcome)
+	assert.False(t, be.ShortCircuited)
+}
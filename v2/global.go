@@ -0,0 +1,55 @@
+package gobreaker
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+// GlobalMode is a type that represents a process-wide mode of all CircuitBreakers.
+type GlobalMode int32
+
+// These constants are global modes of CircuitBreakers.
+const (
+	// GlobalModeNormal lets every CircuitBreaker work according to its Settings.
+	GlobalModeNormal GlobalMode = iota
+	// GlobalModeForceOpenAll makes every CircuitBreaker reject all requests with ErrOpenState.
+	GlobalModeForceOpenAll
+	// GlobalModeDisableAll makes every CircuitBreaker let all requests through without counting them.
+	GlobalModeDisableAll
+)
+
+// String implements stringer interface.
+func (m GlobalMode) String() string {
+	switch m {
+	case GlobalModeNormal:
+		return "normal"
+	case GlobalModeForceOpenAll:
+		return "force-open-all"
+	case GlobalModeDisableAll:
+		return "disable-all"
+	default:
+		return fmt.Sprintf("unknown global mode: %d", m)
+	}
+}
+
+var globalMode atomic.Int32
+
+// SetGlobalMode sets the global mode consulted by every CircuitBreaker in the process
+// whenever it checks if a request can proceed, as a kill switch in an emergency.
+// While a mode other than GlobalModeNormal is active, it overrides the Settings and the state of
+// every CircuitBreaker, which neither counts the requests nor changes its state.
+// The requests in flight when the mode changes are counted according to the mode they started in.
+// SetGlobalMode is safe for concurrent use.
+func SetGlobalMode(mode GlobalMode) {
+	globalMode.Store(int32(mode))
+}
+
+// CurrentGlobalMode returns the global mode set by SetGlobalMode.
+func CurrentGlobalMode() GlobalMode {
+	return GlobalMode(globalMode.Load())
+}
+
+// bypassGeneration is the generation of the requests let through by GlobalModeDisableAll,
+// whose outcomes are never counted.
+const bypassGeneration uint64 = math.MaxUint64
@@ -0,0 +1,62 @@
+package gobreaker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobalModeConstants(t *testing.T) {
+	assert.Equal(t, GlobalMode(0), GlobalModeNormal)
+	assert.Equal(t, "normal", GlobalModeNormal.String())
+	assert.Equal(t, "force-open-all", GlobalModeForceOpenAll.String())
+	assert.Equal(t, "disable-all", GlobalModeDisableAll.String())
+	assert.Equal(t, "unknown global mode: 100", GlobalMode(100).String())
+}
+
+func TestSetGlobalMode(t *testing.T) {
+	defer SetGlobalMode(GlobalModeNormal)
+
+	cb1 := NewCircuitBreaker[bool](Settings{})
+	cb2 := NewCircuitBreaker[bool](Settings{})
+	tripped := NewCircuitBreaker[bool](Settings{})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(tripped))
+	}
+	assert.Equal(t, GlobalModeNormal, CurrentGlobalMode())
+
+	SetGlobalMode(GlobalModeForceOpenAll)
+	assert.Equal(t, GlobalModeForceOpenAll, CurrentGlobalMode())
+	for _, cb := range []*CircuitBreaker[bool]{cb1, cb2, tripped} {
+		assert.Equal(t, ErrOpenState, succeed(cb))
+		_, ran, err := cb.Probe(func() (bool, error) { return true, nil })
+		assert.False(t, ran)
+		assert.Equal(t, ErrOpenState, err)
+	}
+	assert.Equal(t, StateClosed, cb1.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, cb1.Counts())
+
+	// the requests let through are not counted
+	SetGlobalMode(GlobalModeDisableAll)
+	for _, cb := range []*CircuitBreaker[bool]{cb1, cb2, tripped} {
+		for i := 0; i < 10; i++ {
+			assert.Nil(t, fail(cb))
+		}
+	}
+	assert.Equal(t, StateClosed, cb1.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, cb1.Counts())
+	assert.Equal(t, StateClosed, cb2.State())
+	assert.Equal(t, StateOpen, tripped.State())
+
+	// a request started in a mode is counted according to it
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{})
+	done, err := tscb.Allow()
+	assert.Nil(t, err)
+	SetGlobalMode(GlobalModeNormal)
+	done(false)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, tscb.Counts())
+
+	assert.Nil(t, succeed(cb1))
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0, 0}, cb1.Counts())
+	assert.Equal(t, ErrOpenState, succeed(tripped))
+}
@@ -3,9 +3,13 @@
 package gobreaker
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,6 +21,10 @@ const (
 	StateClosed State = iota
 	StateHalfOpen
 	StateOpen
+	// StateForcedOpen is the state forced by ForceOpen, which rejects all requests.
+	StateForcedOpen
+	// StateForcedClosed is the state forced by ForceClose, which accepts all requests and never trips.
+	StateForcedClosed
 )
 
 var (
@@ -24,6 +32,15 @@ var (
 	ErrTooManyRequests = errors.New("too many requests")
 	// ErrOpenState is returned when the CB state is open
 	ErrOpenState = errors.New("circuit breaker is open")
+	// ErrInvalidWindow is returned when the CB is switched to a window of a negative or zero period
+	ErrInvalidWindow = errors.New("invalid window")
+	// ErrSlowProbe is the error of a success in the half-open state slower than HalfOpenSuccessLatency,
+	// which is counted as a failure
+	ErrSlowProbe = errors.New("probe too slow")
+	// ErrTooManyConcurrentRequests is returned when the requests in flight are as many as MaxConcurrentRequests
+	ErrTooManyConcurrentRequests = errors.New("too many concurrent requests")
+	// ErrRampUpLimited is returned when the CB state is closed and the request is over the fraction of RampUpPeriod
+	ErrRampUpLimited = errors.New("limited by ramp-up")
 )
 
 // String implements stringer interface.
@@ -35,99 +52,753 @@ func (s State) String() string {
 		return "half-open"
 	case StateOpen:
 		return "open"
+	case StateForcedOpen:
+		return "forced-open"
+	case StateForcedClosed:
+		return "forced-closed"
 	default:
 		return fmt.Sprintf("unknown state: %d", s)
 	}
 }
 
-// Counts holds the numbers of requests and their successes/failures.
+// Counts holds the numbers of requests and their successes/failures/exclusions.
 // CircuitBreaker clears the internal Counts either
-// on the change of the state or at the closed-state intervals.
+// on the change of the state or at the closed-state intervals,
+// or drops the oldest bucket of the closed-state rolling window from them.
 // Counts ignores the results of the requests sent before clearing.
+// An exclusion is neither a success nor a failure and doesn't break consecutive successes/failures.
+// Each count saturates at math.MaxUint32 instead of wrapping around,
+// e.g. ConsecutiveSuccesses of a long-lived CircuitBreaker with Interval 0 that never fails.
+// TotalFailureWeight is the sum of the weights of the failures given by Settings.Weight,
+// which equals TotalFailures by default.
 type Counts struct {
 	Requests             uint32
 	TotalSuccesses       uint32
 	TotalFailures        uint32
 	ConsecutiveSuccesses uint32
 	ConsecutiveFailures  uint32
+	TotalExclusions      uint32
+	TotalFailureWeight   float64
 }
 
 func (c *Counts) onRequest() {
-	c.Requests++
+	increment(&c.Requests)
 }
 
 func (c *Counts) onSuccess() {
-	c.TotalSuccesses++
-	c.ConsecutiveSuccesses++
+	increment(&c.TotalSuccesses)
+	increment(&c.ConsecutiveSuccesses)
 	c.ConsecutiveFailures = 0
 }
 
 func (c *Counts) onFailure() {
-	c.TotalFailures++
-	c.ConsecutiveFailures++
+	c.onWeightedFailure(1)
+}
+
+func (c *Counts) onWeightedFailure(weight float64) {
+	c.TotalFailureWeight += weight
+	increment(&c.TotalFailures)
+	increment(&c.ConsecutiveFailures)
 	c.ConsecutiveSuccesses = 0
 }
 
+func (c *Counts) onExclusion() {
+	increment(&c.TotalExclusions)
+}
+
+// increment adds 1 to n unless n is math.MaxUint32.
+func increment(n *uint32) {
+	if *n < math.MaxUint32 {
+		*n++
+	}
+}
+
+// saturatingAdd returns a + b, or math.MaxUint32 if the sum overflows.
+func saturatingAdd(a, b uint32) uint32 {
+	if a > math.MaxUint32-b {
+		return math.MaxUint32
+	}
+	return a + b
+}
+
+// subtract removes the totals of b from c.
+// The consecutive counts are capped by the remaining totals.
+func (c *Counts) subtract(b Counts) {
+	c.Requests -= b.Requests
+	c.TotalSuccesses -= b.TotalSuccesses
+	c.TotalFailures -= b.TotalFailures
+	c.TotalExclusions -= b.TotalExclusions
+	c.TotalFailureWeight -= b.TotalFailureWeight
+	if c.TotalFailures == 0 || c.TotalFailureWeight < 0 {
+		// drop the rounding error of the float sum
+		c.TotalFailureWeight = 0
+	}
+	c.ConsecutiveSuccesses = min(c.ConsecutiveSuccesses, c.TotalSuccesses)
+	c.ConsecutiveFailures = min(c.ConsecutiveFailures, c.TotalFailures)
+}
+
+// add adds the totals of b to c.
+func (c *Counts) add(b Counts) {
+	c.Requests = saturatingAdd(c.Requests, b.Requests)
+	c.TotalSuccesses = saturatingAdd(c.TotalSuccesses, b.TotalSuccesses)
+	c.TotalFailures = saturatingAdd(c.TotalFailures, b.TotalFailures)
+	c.TotalExclusions = saturatingAdd(c.TotalExclusions, b.TotalExclusions)
+	c.TotalFailureWeight += b.TotalFailureWeight
+}
+
 func (c *Counts) clear() {
 	c.Requests = 0
 	c.TotalSuccesses = 0
 	c.TotalFailures = 0
 	c.ConsecutiveSuccesses = 0
 	c.ConsecutiveFailures = 0
+	c.TotalExclusions = 0
+	c.TotalFailureWeight = 0
+}
+
+// EffectiveRequests returns the number of the requests that are not excluded, i.e. Requests minus TotalExclusions.
+// Note that it includes the requests in flight, which are counted in Requests when they are admitted.
+func (c Counts) EffectiveRequests() uint32 {
+	if c.TotalExclusions > c.Requests {
+		return 0
+	}
+	return c.Requests - c.TotalExclusions
+}
+
+// FailureRatio returns TotalFailures divided by EffectiveRequests, or 0 if EffectiveRequests is 0,
+// e.g. for ReadyToTrip to trip on a ratio of failures:
+//
+//	ReadyToTrip: func(counts Counts) bool {
+//		return counts.EffectiveRequests() >= 10 && counts.FailureRatio() >= 0.5
+//	}
+//
+// The ratio is computed the same way from the totals of Counts with or without the rolling window.
+func (c Counts) FailureRatio() float64 {
+	return ratio(c.TotalFailures, c.EffectiveRequests())
+}
+
+// SuccessRatio returns TotalSuccesses divided by EffectiveRequests, or 0 if EffectiveRequests is 0.
+func (c Counts) SuccessRatio() float64 {
+	return ratio(c.TotalSuccesses, c.EffectiveRequests())
+}
+
+func ratio(n, total uint32) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// Outcome is a type that represents how the result of a request is counted.
+type Outcome int
+
+// These constants are outcomes of requests.
+// An excluded request is counted in TotalExclusions of Counts.
+const (
+	OutcomeSuccess Outcome = iota
+	OutcomeFailure
+	OutcomeExcluded
+)
+
+// String implements stringer interface.
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeSuccess:
+		return "success"
+	case OutcomeFailure:
+		return "failure"
+	case OutcomeExcluded:
+		return "excluded"
+	default:
+		return fmt.Sprintf("unknown outcome: %d", o)
+	}
+}
+
+// CircuitOutcome is implemented by the errors that declare how they are counted by CircuitBreaker,
+// e.g. a domain error for rate limiting that is counted as an exclusion.
+// If the error returned from a request, or any error in its chain found by errors.As, implements CircuitOutcome,
+// the request is counted as the Outcome it returns, taking precedence over
+// Classifiers, Classify, IsExcluded, IsSuccessful and IsSuccessfulResult of Settings.
+type CircuitOutcome interface {
+	CircuitOutcome() Outcome
+}
+
+// declaredOutcome returns the Outcome declared by err via CircuitOutcome, if any.
+func declaredOutcome(err error) (Outcome, bool) {
+	var co CircuitOutcome
+	if err != nil && errors.As(err, &co) {
+		return co.CircuitOutcome(), true
+	}
+	return OutcomeSuccess, false
+}
+
+func outcomeOf(success bool) Outcome {
+	if success {
+		return OutcomeSuccess
+	}
+	return OutcomeFailure
+}
+
+// Clock provides the current time to CircuitBreaker.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+// TimerClock is a Clock that can also call f after the duration d, e.g. a fake Clock in tests
+// that calls f once it is advanced past d. AfterFunc returns the function that stops the call
+// and reports whether it did. The system clock is a TimerClock.
+type TimerClock interface {
+	Clock
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
 }
 
 // Settings configures CircuitBreaker:
 //
 // Name is the name of the CircuitBreaker.
 //
+// NameFunc is called once at construction to derive the name of the CircuitBreaker if Name is empty,
+// e.g. to give each of many CircuitBreakers created programmatically a unique name.
+//
 // MaxRequests is the maximum number of requests allowed to pass through
 // when the CircuitBreaker is half-open.
 // If MaxRequests is 0, the CircuitBreaker allows only 1 request.
 //
+// UnlimitedHalfOpenRequests lets all the requests pass through when the CircuitBreaker is half-open,
+// so that the half-open state never rejects a request with ErrTooManyRequests.
+// MaxRequests is then only the number of consecutive successes at which the CircuitBreaker becomes closed,
+// or the number of probes of HalfOpenSuccessThreshold, and HalfOpenProbeRatio and HalfOpenProbeInterval are ignored.
+// The first failure places the CircuitBreaker into the open state again, unless HalfOpenSuccessThreshold tolerates it.
+// Note the risk: the full traffic hits the dependency as soon as the open state ends,
+// which may overload a dependency that is still recovering, and all the requests in flight
+// when the CircuitBreaker becomes open again fail together. MaxConcurrentRequests still applies and can bound it.
+//
+// MaxConcurrentRequests is the maximum number of requests in flight in any state,
+// which bounds the requests piling up against a slow dependency before the CircuitBreaker trips.
+// A request over the limit is rejected with ErrTooManyConcurrentRequests without being counted.
+// A request is in flight from when it is admitted until its outcome is reported,
+// even if it panics, so the callback of TwoStepCircuitBreaker.Allow and its variants must be called.
+// In the half-open state, both MaxRequests and MaxConcurrentRequests apply,
+// and the open state rejects the requests with ErrOpenState regardless of MaxConcurrentRequests.
+// If MaxConcurrentRequests is 0, the requests in flight are not limited.
+//
+// HalfOpenProbeRatio is the fraction of the requests allowed to pass through when the CircuitBreaker is half-open,
+// e.g. 0.1 for every tenth request starting from the first, which suits high-traffic services better than a fixed number.
+// The requests are sampled by a deterministic counter of the requests made in the half-open state,
+// and the rest are rejected with ErrTooManyRequests, which doesn't count as saturation for SaturationBackoff.
+// If HalfOpenProbeRatio is set, it replaces MaxRequests as the limit of the requests allowed to pass through,
+// while the CircuitBreaker still becomes closed and open again by MaxRequests and HalfOpenSuccessThreshold.
+// If HalfOpenProbeRatio is not greater than 0 or greater than 1, it is ignored.
+//
+// HalfOpenProbeInterval is the minimum interval between the requests allowed to pass through
+// when the CircuitBreaker is half-open, so that the probes are spread over time
+// rather than taken by the first burst of requests, which is likely to fail all at once.
+// The first request in the half-open state is always allowed, and the requests within the interval
+// since the last allowed one are rejected with ErrTooManyRequests, which doesn't count as saturation for SaturationBackoff.
+// HalfOpenProbeInterval applies on top of MaxRequests or HalfOpenProbeRatio, and a batch of TwoStepCircuitBreaker.AllowN
+// is spaced as a single request. DistributedCircuitBreaker spaces the requests of each instance on its own.
+// If HalfOpenProbeInterval is less than or equal to 0, the requests are not spaced.
+//
+// HalfOpenSuccessThreshold is the ratio of successes out of MaxRequests probes
+// at which the CircuitBreaker becomes closed from the half-open state, tolerating sporadic failures during recovery.
+// A failure in the half-open state keeps the CircuitBreaker half-open as long as the ratio can still be reached
+// by the remaining probes of MaxRequests, and places it into the open state only once it can't,
+// e.g. with MaxRequests of 10 and HalfOpenSuccessThreshold of 0.8, the CircuitBreaker becomes closed
+// after 8 successes and open again on the third failure.
+// If HalfOpenSuccessThreshold is not greater than 0 or greater than 1, it is ignored,
+// and the CircuitBreaker becomes closed after MaxRequests consecutive successes and open again on any failure.
+//
 // Interval is the cyclic period of the closed state
 // for the CircuitBreaker to clear the internal Counts.
 // If Interval is less than or equal to 0, the CircuitBreaker doesn't clear internal Counts during the closed state.
+// Note that a long-lived CircuitBreaker then accumulates Counts indefinitely, so that
+// ReadyToTrip based on the ratio of failures can hardly trip on a late burst of failures
+// diluted by ancient successes. Use BucketPeriod for a rolling window, or MaxAccumulatedRequests.
+//
+// MaxAccumulatedRequests is the maximum number of requests counted in a generation of the closed state.
+// If MaxAccumulatedRequests is greater than 0, the CircuitBreaker clears Counts before the next request
+// once the requests of the current generation reach MaxAccumulatedRequests, even if Interval is 0,
+// as if the Interval had elapsed.
+// If MaxAccumulatedRequests is 0, the number of requests in a generation is not limited.
 //
 // Timeout is the period of the open state,
 // after which the state of the CircuitBreaker becomes half-open.
 // If Timeout is less than or equal to 0, the timeout value of the CircuitBreaker is set to 60 seconds.
 //
+// ManualRecovery makes the open state last until an explicit action of the operator,
+// e.g. for a dependency under manually-managed maintenance.
+// If ManualRecovery is true, the CircuitBreaker doesn't become half-open when Timeout elapses,
+// but only when AllowProbe is called, or becomes closed when Reset is called.
+//
+// MaxProbeAttempts is the number of the consecutive half-open states ending up open again
+// after which the CircuitBreaker gives up probing the dependency by itself,
+// e.g. for a dependency with a strict quota that can't afford probes all through a long outage.
+// Once MaxProbeAttempts is reached, the open state lasts as if ManualRecovery were true
+// until AllowProbe or Reset is called, and OnProbeBudgetExhausted is called.
+// The attempts are counted anew when the CircuitBreaker becomes closed, but not by AllowProbe,
+// so a failed probe allowed by AllowProbe after the budget is exhausted keeps the CircuitBreaker open.
+// MaxProbeAttempts has no effect with ManualRecovery, which never probes by itself.
+// If MaxProbeAttempts is 0, the CircuitBreaker keeps probing after every Timeout.
+//
+// OnProbeBudgetExhausted is called when the CircuitBreaker gives up probing by MaxProbeAttempts.
+// OnProbeBudgetExhausted is called outside the lock of the CircuitBreaker.
+//
 // ReadyToTrip is called with a copy of Counts whenever a request fails in the closed state.
 // If ReadyToTrip returns true, the CircuitBreaker will be placed into the open state.
 // If ReadyToTrip is nil, default ReadyToTrip is used.
 // Default ReadyToTrip returns true when the number of consecutive failures is more than 5.
 //
+// MinimumRequests and FailureRateThreshold configure default ReadyToTrip declaratively
+// and have no effect if ReadyToTrip is set.
+// If FailureRateThreshold is greater than 0 and less than or equal to 1, default ReadyToTrip returns true
+// when FailureRatio of Counts is greater than or equal to FailureRateThreshold instead of counting consecutive failures.
+// If MinimumRequests is greater than 0, default ReadyToTrip returns false until EffectiveRequests of Counts
+// reaches MinimumRequests, so that e.g. a single failure out of one request never trips.
+//
+// Weight is called with the error of every failed request and returns the weight of the failure
+// added to TotalFailureWeight of Counts, e.g. to let ReadyToTrip trip on the weighted failures
+// where a 503 weighs more than a timeout. The weights are accumulated in the buckets of the rolling window, too.
+// A negative or NaN weight is counted as 0.
+// If Weight is nil, every failure weighs 1.
+//
 // OnStateChange is called whenever the state of the CircuitBreaker changes.
 //
+// StateChangeThrottle limits OnStateChange to at most one call per StateChangeThrottle,
+// e.g. to keep a flapping CircuitBreaker from flooding the logs.
+// The transitions within the throttle window are coalesced into the net transition,
+// from the state before the first one to the state after the last one,
+// which is reported when the window ends. The net transition is dropped if it ends in the state it started from.
+// StateChangeThrottle only affects OnStateChange; the state itself and the other callbacks change as usual.
+// If StateChangeThrottle is less than or equal to 0, OnStateChange is called for every transition.
+//
 // IsSuccessful is called with the error returned from a request.
 // If IsSuccessful returns true, the error is counted as a success.
 // Otherwise the error is counted as a failure.
 // If IsSuccessful is nil, default IsSuccessful is used, which returns false for all non-nil errors.
+//
+// IsExcluded is called with the error returned from a request before IsSuccessful.
+// If IsExcluded returns true, the request is counted as an exclusion,
+// which is neither a success nor a failure, e.g. for errors caused by the caller rather than the dependency.
+// If IsExcluded is nil, no request is excluded.
+//
+// IsExcludedResult is like IsExcluded but is also called with the result returned from a request,
+// e.g. to exclude an HTTP response of status 429 that is returned with a nil error.
+// It is called for every request that IsExcluded doesn't exclude, regardless of ResultMatters.
+// StreamAllow doesn't call IsExcludedResult since a stream has no result.
+// If IsExcludedResult is nil, only IsExcluded excludes requests.
+//
+// ExclusionsConsumeHalfOpenSlots determines whether excluded requests count toward MaxRequests
+// in the half-open state.
+// If ExclusionsConsumeHalfOpenSlots is false, an excluded request frees its slot when it finishes,
+// so that excluded requests are neutral.
+// If ExclusionsConsumeHalfOpenSlots is true, an excluded request keeps its slot as a probe attempt,
+// so that a flood of excluded requests can't mask the probes.
+//
+// Classifiers is a chain of classifiers of the error returned from a request, evaluated in order
+// before Classify, IsExcluded, IsSuccessful and IsSuccessfulResult.
+// The first classifier that returns true as the second value determines the Outcome of the request,
+// and the rest of the chain is not evaluated.
+// If no classifier handles the error, the request is classified by the other classifiers of Settings.
+// Classifiers lets independent rules, e.g. one for context errors and one for HTTP status codes,
+// be composed without nesting them in IsSuccessful.
+// An error that implements CircuitOutcome classifies itself before Classifiers.
+//
+// Classify is called with the error returned from a request that Classifiers doesn't handle
+// and returns its Outcome directly, e.g. OutcomeExcluded for errors caused by the caller,
+// for the users who want full control over the classification in a single function.
+// If Classify is set, IsExcluded, IsExcludedResult, IsSuccessful and IsSuccessfulResult are not called.
+// An Outcome other than OutcomeSuccess and OutcomeExcluded is counted as a failure.
+// If Classify is nil, the request is classified by IsExcluded and IsSuccessful, and their result variants.
+//
+// IsSuccessfulResult is like IsSuccessful but is also called with the result returned from a request,
+// so that the result can influence whether the request is counted as a success or a failure.
+// If IsSuccessfulResult is nil, the result is ignored and IsSuccessful is used.
+//
+// ResultMatters determines how a request that returns both a result and a non-nil error is classified.
+// If ResultMatters is false, such a request is classified by IsSuccessful alone
+// and IsSuccessfulResult is called only for requests that return a nil error.
+// If ResultMatters is true, IsSuccessfulResult is called for every request.
+// In either case, the result and the error are returned to the caller unchanged.
+//
+// IntervalCarryOver determines how the outcome of a request is counted
+// when the closed-state Interval elapses while the request is in flight.
+// If IntervalCarryOver is false, the outcome belongs to the generation in which the request started
+// and is discarded, because the Counts of that generation have already been cleared.
+// If IntervalCarryOver is true, the outcome is counted as a request of the current generation.
+// The outcome of a request that is in flight across a change of the state is always discarded.
+//
+// OnRecover is called whenever the CircuitBreaker becomes closed from the half-open state,
+// with the downtime measured from when the CircuitBreaker became open from the closed state.
+// OnRecover is called outside the lock of the CircuitBreaker.
+//
+// OnTrip is called whenever the CircuitBreaker becomes open, with the error of the last failed request,
+// which is usually the one that tripped the CircuitBreaker, and the Counts of the generation that has just ended.
+// The error is nil if the last failed request reported no error, e.g. by TwoStepCircuitBreaker.Allow.
+// Only the error of the last failed request is kept.
+// OnTrip is called outside the lock of the CircuitBreaker.
+//
+// OnProbeStart is called whenever the CircuitBreaker becomes half-open and starts probing the dependency,
+// e.g. to raise the verbosity of logging only during the probes.
+// OnProbeEnd is called whenever the CircuitBreaker leaves the half-open state,
+// with closed true if it has recovered and false if it has become open again.
+// OnProbeStart and OnProbeEnd are called outside the lock of the CircuitBreaker.
+//
+// OnGenerationEnd is called whenever Counts are cleared, i.e. on every change of the state
+// and at the closed-state intervals, with the final Counts of the generation that has just ended.
+// With BucketPeriod, the totals include the buckets dropped from the rolling window during the generation.
+// Summing the totals delivered by OnGenerationEnd counts every request exactly once.
+// OnGenerationEnd is called outside the lock of the CircuitBreaker.
+//
+// OnIntervalReset is called whenever Counts are cleared at the closed-state intervals,
+// or by MaxAccumulatedRequests, but not on a change of the state, with the final Counts of the generation
+// that has just ended like OnGenerationEnd, e.g. to tell the jumps of the metrics caused by the intervals
+// from those caused by the state changes.
+// The rolling window of BucketPeriod is never cleared at the intervals.
+// OnIntervalReset is called outside the lock of the CircuitBreaker, before OnGenerationEnd.
+//
+// OnOutcome is called whenever the outcome of a request is counted, with the OutcomeInfo of the request,
+// for the observers that need more than the other callbacks tell, e.g. the duration of the request
+// or whether it tripped the CircuitBreaker. It is not called for the outcomes discarded
+// since the request started in another generation.
+// OnOutcome is called outside the lock of the CircuitBreaker.
+//
+// MinClosedDuration is the period after the CircuitBreaker becomes closed from the half-open state
+// during which it doesn't trip again, to avoid rapid flapping.
+// During the period, failures are still counted but ReadyToTrip is not called.
+// If MinClosedDuration is less than or equal to 0, the CircuitBreaker can trip at any time in the closed state.
+//
+// RampUpPeriod is the period of the slow start after the CircuitBreaker becomes closed from the half-open state,
+// so as not to overwhelm the recovering dependency with the full load at once.
+// During the period, the CircuitBreaker admits a fraction of the requests that climbs linearly
+// from RampUpInitialRatio to 1, and rejects the rest with ErrRampUpLimited without counting them.
+// The requests are sampled deterministically, starting from the first request after the recovery.
+// The ramp-up ends when the state changes again.
+// If RampUpPeriod is less than or equal to 0, the CircuitBreaker admits all the requests as soon as it becomes closed.
+//
+// RampUpInitialRatio is the fraction of the requests admitted at the start of RampUpPeriod.
+// If RampUpInitialRatio is not greater than 0 or greater than 1, 0.1 is used.
+//
+// IgnoreFirstN is the number of requests at the beginning of each generation of the closed state
+// that are not enough for the CircuitBreaker to trip, to let the sample stabilize after Counts are cleared.
+// Until more than IgnoreFirstN requests have been made in the generation,
+// failures are still counted but ReadyToTrip is not called.
+//
+// PreserveSuccessesOnReset is an unusual policy that biases the CircuitBreaker toward staying closed.
+// If PreserveSuccessesOnReset is true, whenever Counts are cleared for a new generation of the closed state,
+// i.e. when the CircuitBreaker becomes closed or at the closed-state intervals,
+// TotalSuccesses and ConsecutiveSuccesses of the previous generation are kept, as well as Requests for them,
+// while the failures and the exclusions are zeroed.
+// For example, the recovery from the half-open state starts from the successes of the probes.
+// Note that the kept successes dilute the failures seen by ReadyToTrip,
+// which can make a flaky dependency harder to trip again.
+// Counts are always cleared entirely for the open and half-open states.
+//
+// SaturationBackoff is an advanced option that extends the open state
+// when the half-open state keeps saturating.
+// If SaturationBackoff is greater than 1 and the CircuitBreaker rejected any request with ErrTooManyRequests
+// during a half-open state that ends up open again, the period of that open state is
+// the period of the previous open state multiplied by SaturationBackoff.
+// The period is reset to Timeout when the CircuitBreaker becomes closed.
+// If SaturationBackoff is less than or equal to 1, saturation doesn't affect the period of the open state.
+//
+// MaxSaturationTimeout caps the period of the open state extended by SaturationBackoff.
+// If MaxSaturationTimeout is less than or equal to 0, the period is not capped.
+//
+// GenerateTimeout is called with the period of the previous open state and the Counts of the ending generation
+// whenever the CircuitBreaker becomes open, including from the half-open state, and returns the period of the new open state.
+// The previous period is Timeout when the CircuitBreaker has not been open since it became closed,
+// so that e.g. doubling prevTimeout grows the period from 2 * Timeout over the consecutive open states.
+// GenerateTimeout is called with the lock of the CircuitBreaker held and must not call the CircuitBreaker.
+// If GenerateTimeout returns a value less than or equal to 0, Timeout is used.
+// If GenerateTimeout is nil, the period is Timeout, extended by SaturationBackoff if any.
+// GenerateTimeout takes precedence over SaturationBackoff and MaxSaturationTimeout.
+//
+// Meta is arbitrary data attached to the CircuitBreaker for the convenience of the embedder,
+// e.g. a descriptor of the downstream endpoint. It is opaque to the CircuitBreaker.
+//
+// BucketPeriod is the period of a bucket of the closed-state rolling window.
+// If both BucketPeriod and Interval are greater than 0, the CircuitBreaker doesn't clear Counts at every Interval
+// but counts the requests over a rolling window of Interval that consists of buckets of BucketPeriod,
+// dropping the oldest bucket every BucketPeriod. Interval is rounded up to a multiple of BucketPeriod.
+// The outcome of a request is counted in the bucket in which the request started.
+// If that bucket has already been dropped, the outcome is handled as if the Interval had elapsed,
+// according to IntervalCarryOver.
+// If BucketPeriod is less than or equal to 0, Interval is a fixed window.
+//
+// BucketDecay makes the rolling window of BucketPeriod weigh recent requests more than older ones.
+// If BucketDecay is greater than 0 and less than 1, the Counts given to ReadyToTrip
+// are the sums of the buckets each weighted by BucketDecay to the power of its age,
+// where the newest bucket has age 0, rounded to the nearest integer.
+// For example, with BucketDecay 0.5, a failure in the previous bucket weighs half as much as a failure in the newest one.
+// The consecutive counts are not weighted but capped by the weighted totals.
+// Otherwise, or without the rolling window, every bucket weighs 1.
+// BucketDecay affects only the decision of ReadyToTrip; Counts and OnGenerationEnd report the unweighted Counts.
+//
+// HalfOpenMinBuckets is the number of distinct periods of BucketPeriod,
+// measured from when the CircuitBreaker becomes half-open,
+// in which successes must be counted before the CircuitBreaker becomes closed,
+// so that recovery must hold for some time rather than only for MaxRequests consecutive successes.
+// If HalfOpenMinBuckets is greater than 1, a successful request in the half-open state frees its slot,
+// so that MaxRequests limits the requests in flight rather than all the requests of the half-open state.
+// If HalfOpenMinBuckets is less than or equal to 1 or BucketPeriod is less than or equal to 0,
+// the CircuitBreaker becomes closed after MaxRequests consecutive successes.
+//
+// HalfOpenSuccessLatency is the latency above which a successful request in the half-open state
+// is counted as a failure, since a dependency responding that slowly has not recovered yet.
+// The failure is reported with ErrSlowProbe, e.g. to OnTrip.
+// The latency is measured with Clock from when the request is admitted.
+// If HalfOpenSuccessLatency is less than or equal to 0, any success counts toward recovery.
+//
+// WrapErrors makes Execute, ExecuteWithClassifier, ExecuteContext and the handlers of WrapHandler return *BreakerError,
+// which tells whether the request was rejected or run and how its error was counted,
+// instead of the rejection error or the error of the request itself.
+// BreakerError unwraps to the original error, so errors.Is and errors.As keep working,
+// but the comparisons of the error with == don't.
+// A request that returns a nil error still returns nil.
+//
+// RejectValue is called whenever the CircuitBreaker rejects a request of Execute,
+// to get the value returned along with the error instead of the zero value of the type parameter,
+// e.g. an empty but non-nil slice for the callers that don't check the error first.
+// If RejectValue is nil or returns nil, the zero value is returned.
+// NewCircuitBreaker calls RejectValue once and panics if it returns a value of another type.
+//
+// MeasureTiming enables the timing breakdown of Metrics, which costs two readings of the system clock
+// per request. If MeasureTiming is false, the timing is not measured and Metrics reports zero durations.
+//
+// ApdexTarget enables the Apdex of Metrics, reporting how the latency of the requests run by Execute
+// or its variants meets a target. A successful request is satisfied if it takes ApdexTarget or less,
+// tolerating if it takes ApdexTolerating or less, and frustrated otherwise.
+// A failed request is frustrated regardless of its latency, and an excluded one is not counted.
+// If ApdexTolerating is less than ApdexTarget, four times ApdexTarget is used as usual for Apdex.
+// The latency is measured with Clock. If ApdexTarget is less than or equal to 0, Apdex is not measured.
+//
+// TrackLatency enables recording the durations of the requests counted in Counts in a histogram,
+// whose approximate percentiles are returned by Latencies. The durations follow Counts:
+// they are cleared with Counts and dropped with the buckets of the rolling window of BucketPeriod.
+// Excluded requests are not recorded. The durations are measured with Clock.
+// If TrackLatency is false, the durations are neither measured nor recorded.
+//
+// ReadyToTripOnLatency is called with a copy of Counts and the current Latencies
+// whenever a request succeeds or fails in the closed state, if TrackLatency is true,
+// e.g. to trip on a sustained high latency before the requests start failing:
+//
+//	ReadyToTripOnLatency: func(counts Counts, latencies Latencies) bool {
+//		return latencies.Count >= 20 && latencies.P99 > time.Second
+//	},
+//
+// If ReadyToTripOnLatency returns true, the CircuitBreaker will be placed into the open state
+// as if ReadyToTrip had returned true. MinClosedDuration and IgnoreFirstN apply to it alike.
+// ReadyToTripOnLatency has no effect if TrackLatency is false.
+//
+// ObserveOnly makes the CircuitBreaker run in a shadow mode to validate its tuning before enforcing it.
+// If ObserveOnly is true, the CircuitBreaker changes its state and calls the callbacks as usual,
+// but never rejects a request. The requests that would be rejected call OnWouldReject instead.
+// Such requests in the open state are not counted.
+//
+// OnWouldReject is called with the error that a request would be rejected with,
+// ErrOpenState or ErrTooManyRequests, when ObserveOnly lets the request through.
+// OnWouldReject is called outside the lock of the CircuitBreaker.
+//
+// EvalInterval is the period at which ReadyToTrip is also called with the current Counts
+// in the closed state without waiting for a failure, so that ReadyToTrip depending on an external condition,
+// e.g. a shared health gauge, can trip the CircuitBreaker while requests succeed or none are made.
+// The evaluation is subject to MinClosedDuration and IgnoreFirstN as on a failure.
+// If EvalInterval is greater than 0, NewCircuitBreaker starts a goroutine for the evaluation,
+// which runs until Close is called.
+// If EvalInterval is less than or equal to 0, ReadyToTrip is called only when a request fails.
+//
+// CancelOnOpen makes the CircuitBreaker cancel the contexts of the requests of ExecuteContext in flight
+// when it becomes open, since they are likely pointless to continue against the dependency known to be bad.
+// The context given to such a request is also derived from a context of the CircuitBreaker,
+// which is cancelled with ErrOpenState as the cause whenever the CircuitBreaker becomes open
+// and is replaced for the requests that follow.
+// The request must honor the cancellation of its context for CancelOnOpen to help.
+// The outcomes of the cancelled requests are discarded as usual for the requests finishing in another state.
+//
+// Clock is used to get the current time.
+// If Clock is nil, the system clock is used.
+// If Clock also implements TimerClock, it schedules the report of StateChangeThrottle at the end of the window;
+// otherwise the report waits for the first call of the CircuitBreaker after the window ends.
+// A fake Clock lets tests advance time deterministically.
 type Settings struct {
-	Name          string
-	MaxRequests   uint32
-	Interval      time.Duration
-	Timeout       time.Duration
-	ReadyToTrip   func(counts Counts) bool
-	OnStateChange func(name string, from State, to State)
-	IsSuccessful  func(err error) bool
+	Name                           string
+	NameFunc                       func() string
+	MaxRequests                    uint32
+	UnlimitedHalfOpenRequests      bool
+	MaxConcurrentRequests          uint32
+	HalfOpenProbeRatio             float64
+	HalfOpenProbeInterval          time.Duration
+	HalfOpenSuccessThreshold       float64
+	Interval                       time.Duration
+	MaxAccumulatedRequests         uint32
+	Timeout                        time.Duration
+	ManualRecovery                 bool
+	MaxProbeAttempts               uint32
+	OnProbeBudgetExhausted         func(name string)
+	ReadyToTrip                    func(counts Counts) bool
+	MinimumRequests                uint32
+	FailureRateThreshold           float64
+	Weight                         func(err error) float64
+	OnStateChange                  func(name string, from State, to State)
+	StateChangeThrottle            time.Duration
+	OnRecover                      func(name string, downtime time.Duration)
+	OnTrip                         func(name string, lastErr error, counts Counts)
+	OnProbeStart                   func(name string)
+	OnProbeEnd                     func(name string, closed bool)
+	OnGenerationEnd                func(name string, counts Counts)
+	OnIntervalReset                func(name string, endedCounts Counts)
+	OnOutcome                      func(info OutcomeInfo)
+	IsSuccessful                   func(err error) bool
+	IsSuccessfulResult             func(result any, err error) bool
+	ResultMatters                  bool
+	IsExcluded                     func(err error) bool
+	IsExcludedResult               func(result any, err error) bool
+	Classifiers                    []func(err error) (Outcome, bool)
+	Classify                       func(err error) Outcome
+	ExclusionsConsumeHalfOpenSlots bool
+	IntervalCarryOver              bool
+	MinClosedDuration              time.Duration
+	RampUpPeriod                   time.Duration
+	RampUpInitialRatio             float64
+	IgnoreFirstN                   uint32
+	PreserveSuccessesOnReset       bool
+	SaturationBackoff              float64
+	MaxSaturationTimeout           time.Duration
+	GenerateTimeout                func(prevTimeout time.Duration, counts Counts) time.Duration
+	BucketPeriod                   time.Duration
+	BucketDecay                    float64
+	HalfOpenMinBuckets             uint32
+	HalfOpenSuccessLatency         time.Duration
+	WrapErrors                     bool
+	RejectValue                    func() any
+	MeasureTiming                  bool
+	ApdexTarget                    time.Duration
+	ApdexTolerating                time.Duration
+	TrackLatency                   bool
+	ReadyToTripOnLatency           func(counts Counts, latencies Latencies) bool
+	ObserveOnly                    bool
+	OnWouldReject                  func(name string, err error)
+	EvalInterval                   time.Duration
+	CancelOnOpen                   bool
+	Meta                           any
+	Clock                          Clock
 }
 
 // CircuitBreaker is a state machine to prevent sending requests that are likely to fail.
 type CircuitBreaker[T any] struct {
-	name          string
-	maxRequests   uint32
-	interval      time.Duration
-	timeout       time.Duration
-	readyToTrip   func(counts Counts) bool
-	isSuccessful  func(err error) bool
-	onStateChange func(name string, from State, to State)
+	settings             Settings
+	name                 string
+	maxRequests          uint32
+	unlimitedHalfOpen    bool
+	maxConcurrent        uint32
+	probeRatio           float64
+	probeInterval        time.Duration
+	successThreshold     float64
+	interval             time.Duration
+	maxAccumulated       uint32
+	timeout              time.Duration
+	manualRecovery       bool
+	maxProbeAttempts     uint32
+	onProbeExhausted     func(name string)
+	readyToTrip          func(counts Counts) bool
+	minimumRequests      uint32
+	failureRateThreshold float64
+	isSuccessful         func(err error) bool
+	isSuccessfulResult   func(result any, err error) bool
+	resultMatters        bool
+	isExcluded           func(err error) bool
+	isExcludedResult     func(result any, err error) bool
+	weight               func(err error) float64
+	classifiers          []func(err error) (Outcome, bool)
+	classifyOutcome      func(err error) Outcome
+	exclusionsConsume    bool
+	intervalCarryOver    bool
+	minClosedDuration    time.Duration
+	rampUpPeriod         time.Duration
+	rampUpInitialRatio   float64
+	ignoreFirstN         uint32
+	saturationBackoff    float64
+	maxSaturationTimeout time.Duration
+	generateTimeout      func(prevTimeout time.Duration, counts Counts) time.Duration
+	bucketPeriod         time.Duration
+	bucketDecay          float64
+	halfOpenMinBuckets   uint32
+	halfOpenLatency      time.Duration
+	onStateChange        func(name string, from State, to State)
+	stateChangeThrottle  time.Duration
+	onRecover            func(name string, downtime time.Duration)
+	onTrip               func(name string, lastErr error, counts Counts)
+	onProbeStart         func(name string)
+	onProbeEnd           func(name string, closed bool)
+	onGenerationEnd      func(name string, counts Counts)
+	onIntervalReset      func(name string, endedCounts Counts)
+	onOutcome            func(info OutcomeInfo)
+	preserveSuccesses    bool
+	wrapErrors           bool
+	rejectValue          func() any
+	timing               *timing
+	apdex                *apdex
+	latency              *latencyTracker
+	readyToTripOnLatency func(counts Counts, latencies Latencies) bool
+	retries              retryCounters
+	observeOnly          bool
+	onWouldReject        func(name string, err error)
+	meta                 any
+	clock                Clock
+
+	mutex              sync.RWMutex
+	state              State
+	generation         uint64
+	stateGeneration    uint64
+	counts             Counts
+	preserved          Counts
+	generationRequests uint32
+	expiry             time.Time
+	stateChangedAt     time.Time
+	openTimeout        time.Duration
+	saturated          bool
+	openedAt           time.Time
+	recoveredAt        time.Time
+	window             *rollingCounts
+	halfOpenedAt       time.Time
+	halfOpenBuckets    uint32
+	halfOpenArrivals   uint64
+	lastProbeAt        time.Time
+	rampUpStart        time.Time
+	rampUpUntil        time.Time
+	rampUpCredit       float64
+	halfOpenGate       atomic.Pointer[halfOpenGate]
+	lastSuccessAge     uint64
+	probeCounts        Counts
+	failedProbes       uint32
+	inFlight           uint32
+	lastError          error
+	callbacks          []func()
+	staging            bool
+	staged             []func()
+	openCtx            context.Context
+	cancelOpenCtx      context.CancelCauseFunc
+	openedCh           chan struct{}
+	notifiedAt         time.Time
+	pendingFrom        State
+	pendingTo          State
+	changePending      bool
+	stopThrottle       func() bool
 
-	mutex      sync.Mutex
-	state      State
-	generation uint64
-	counts     Counts
-	expiry     time.Time
+	subscribers      subscribers
+	groupSubscribers *subscribers
+
+	stopEval  chan struct{}
+	closeOnce sync.Once
 }
 
 // TwoStepCircuitBreaker is like CircuitBreaker but instead of surrounding a function
@@ -138,11 +809,39 @@ type TwoStepCircuitBreaker[T any] struct {
 }
 
 // NewCircuitBreaker returns a new CircuitBreaker configured with the given Settings.
+// NewCircuitBreaker panics if Settings.RejectValue returns a value that is not of the type parameter.
 func NewCircuitBreaker[T any](st Settings) *CircuitBreaker[T] {
 	cb := new(CircuitBreaker[T])
 
+	cb.settings = st
 	cb.name = st.Name
+	if cb.name == "" && st.NameFunc != nil {
+		cb.name = st.NameFunc()
+	}
+	cb.meta = st.Meta
 	cb.onStateChange = st.OnStateChange
+	cb.stateChangeThrottle = st.StateChangeThrottle
+	cb.onRecover = st.OnRecover
+	cb.onTrip = st.OnTrip
+	cb.onProbeStart = st.OnProbeStart
+	cb.onProbeEnd = st.OnProbeEnd
+	cb.onGenerationEnd = st.OnGenerationEnd
+	cb.onIntervalReset = st.OnIntervalReset
+	cb.onOutcome = st.OnOutcome
+	cb.preserveSuccesses = st.PreserveSuccessesOnReset
+	cb.wrapErrors = st.WrapErrors
+	cb.rejectValue = st.RejectValue
+	checkRejectValue[T](st.RejectValue)
+	if st.MeasureTiming {
+		cb.timing = new(timing)
+	}
+	cb.apdex = newApdex(st.ApdexTarget, st.ApdexTolerating)
+	if st.TrackLatency {
+		cb.latency = new(latencyTracker)
+		cb.readyToTripOnLatency = st.ReadyToTripOnLatency
+	}
+	cb.observeOnly = st.ObserveOnly
+	cb.onWouldReject = st.OnWouldReject
 
 	if st.MaxRequests == 0 {
 		cb.maxRequests = 1
@@ -156,14 +855,40 @@ func NewCircuitBreaker[T any](st Settings) *CircuitBreaker[T] {
 		cb.interval = st.Interval
 	}
 
+	cb.maxAccumulated = st.MaxAccumulatedRequests
+	cb.maxConcurrent = st.MaxConcurrentRequests
+	cb.unlimitedHalfOpen = st.UnlimitedHalfOpenRequests
+	if st.HalfOpenProbeRatio > 0 && st.HalfOpenProbeRatio <= 1 && !cb.unlimitedHalfOpen {
+		cb.probeRatio = st.HalfOpenProbeRatio
+	}
+	if !cb.unlimitedHalfOpen {
+		cb.probeInterval = max(st.HalfOpenProbeInterval, 0)
+	}
+	if st.HalfOpenSuccessThreshold > 0 && st.HalfOpenSuccessThreshold <= 1 {
+		cb.successThreshold = st.HalfOpenSuccessThreshold
+	}
+
 	if st.Timeout <= 0 {
 		cb.timeout = defaultTimeout
 	} else {
 		cb.timeout = st.Timeout
 	}
+	cb.openTimeout = cb.timeout
+	cb.manualRecovery = st.ManualRecovery
+	if !cb.manualRecovery {
+		cb.maxProbeAttempts = st.MaxProbeAttempts
+	}
+	cb.onProbeExhausted = st.OnProbeBudgetExhausted
 
 	if st.ReadyToTrip == nil {
+		cb.minimumRequests = st.MinimumRequests
+		if st.FailureRateThreshold > 0 && st.FailureRateThreshold <= 1 {
+			cb.failureRateThreshold = st.FailureRateThreshold
+		}
 		cb.readyToTrip = defaultReadyToTrip
+		if cb.minimumRequests > 0 || cb.failureRateThreshold > 0 {
+			cb.readyToTrip = cb.thresholdReadyToTrip
+		}
 	} else {
 		cb.readyToTrip = st.ReadyToTrip
 	}
@@ -174,7 +899,49 @@ func NewCircuitBreaker[T any](st Settings) *CircuitBreaker[T] {
 		cb.isSuccessful = st.IsSuccessful
 	}
 
-	cb.toNewGeneration(time.Now())
+	cb.isSuccessfulResult = st.IsSuccessfulResult
+	cb.resultMatters = st.ResultMatters
+	cb.isExcluded = st.IsExcluded
+	cb.isExcludedResult = st.IsExcludedResult
+	cb.weight = st.Weight
+	cb.classifiers = append([]func(err error) (Outcome, bool)(nil), st.Classifiers...)
+	cb.classifyOutcome = st.Classify
+	cb.exclusionsConsume = st.ExclusionsConsumeHalfOpenSlots
+	cb.intervalCarryOver = st.IntervalCarryOver
+	cb.minClosedDuration = st.MinClosedDuration
+	cb.rampUpPeriod = st.RampUpPeriod
+	cb.rampUpInitialRatio = validRampUpInitialRatio(st.RampUpInitialRatio)
+	cb.ignoreFirstN = st.IgnoreFirstN
+	cb.saturationBackoff = st.SaturationBackoff
+	cb.halfOpenLatency = max(st.HalfOpenSuccessLatency, 0)
+	cb.maxSaturationTimeout = st.MaxSaturationTimeout
+	cb.generateTimeout = st.GenerateTimeout
+
+	if st.BucketPeriod > 0 {
+		cb.bucketPeriod = st.BucketPeriod
+		cb.halfOpenMinBuckets = st.HalfOpenMinBuckets
+		if cb.interval > 0 {
+			cb.window = newRollingCounts(cb.interval, cb.bucketPeriod)
+			cb.bucketDecay = validBucketDecay(st.BucketDecay)
+		}
+	}
+
+	if st.Clock == nil {
+		cb.clock = systemClock{}
+	} else {
+		cb.clock = st.Clock
+	}
+
+	now := cb.clock.Now()
+	cb.stateChangedAt = now
+	if st.CancelOnOpen {
+		cb.openCtx, cb.cancelOpenCtx = context.WithCancelCause(context.Background())
+	}
+	cb.toNewGeneration(now)
+
+	if st.EvalInterval > 0 {
+		cb.startEval(st.EvalInterval)
+	}
 
 	return cb
 }
@@ -186,6 +953,14 @@ func NewTwoStepCircuitBreaker[T any](st Settings) *TwoStepCircuitBreaker[T] {
 	}
 }
 
+// validBucketDecay returns decay if it is a valid BucketDecay, or 0 otherwise.
+func validBucketDecay(decay float64) float64 {
+	if decay > 0 && decay < 1 {
+		return decay
+	}
+	return 0
+}
+
 const defaultInterval = time.Duration(0) * time.Second
 const defaultTimeout = time.Duration(60) * time.Second
 
@@ -193,6 +968,17 @@ func defaultReadyToTrip(counts Counts) bool {
 	return counts.ConsecutiveFailures > 5
 }
 
+// thresholdReadyToTrip is default ReadyToTrip with MinimumRequests and FailureRateThreshold.
+func (cb *CircuitBreaker[T]) thresholdReadyToTrip(counts Counts) bool {
+	if counts.EffectiveRequests() < cb.minimumRequests {
+		return false
+	}
+	if cb.failureRateThreshold > 0 {
+		return counts.FailureRatio() >= cb.failureRateThreshold
+	}
+	return defaultReadyToTrip(counts)
+}
+
 func defaultIsSuccessful(err error) bool {
 	return err == nil
 }
@@ -202,47 +988,308 @@ func (cb *CircuitBreaker[T]) Name() string {
 	return cb.name
 }
 
+// Meta returns the data attached to the CircuitBreaker by Settings.Meta.
+// The data is fixed at construction; Meta returns the same value for the lifetime of the CircuitBreaker.
+func (cb *CircuitBreaker[T]) Meta() any {
+	return cb.meta
+}
+
 // State returns the current state of the CircuitBreaker.
 func (cb *CircuitBreaker[T]) State() State {
 	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
+	defer cb.unlock()
 
-	now := time.Now()
-	state, _ := cb.currentState(now)
+	now := cb.clock.Now()
+	state, _, _ := cb.currentState(now)
 	return state
 }
 
+// PeekState returns the current state of the CircuitBreaker like State,
+// but without applying the transition that is due, if any.
+// PeekState takes only a read lock, so that observers calling it frequently
+// don't block requests as much as State does.
+func (cb *CircuitBreaker[T]) PeekState() State {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	if cb.state == StateOpen && !cb.expiry.IsZero() && cb.expiry.Before(cb.clock.Now()) {
+		return StateHalfOpen
+	}
+	return cb.state
+}
+
+// StateAge returns how long the CircuitBreaker has been in the current state,
+// e.g. for dashboards showing "open for 4m".
+// Like State, it applies the transition that is due, if any.
+// The clearing of Counts at the closed-state intervals doesn't change the state.
+func (cb *CircuitBreaker[T]) StateAge() time.Duration {
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	now := cb.clock.Now()
+	cb.currentState(now)
+	return now.Sub(cb.stateChangedAt)
+}
+
+// ExpiresIn returns the time left until the current expiry of the CircuitBreaker,
+// e.g. for dashboards showing "half-open in 42s".
+// In the open state, it is the time until the transition to the half-open state,
+// and in the closed state with a positive Interval and no rolling window, the time until Counts are cleared.
+// ExpiresIn returns 0 if there is no expiry, e.g. in the half-open state, in the open state with ManualRecovery
+// or after MaxProbeAttempts, and in the forced states.
+// Like State, it applies the transition that is due, if any.
+func (cb *CircuitBreaker[T]) ExpiresIn() time.Duration {
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	now := cb.clock.Now()
+	cb.currentState(now)
+	if cb.expiry.IsZero() {
+		return 0
+	}
+	return max(cb.expiry.Sub(now), 0)
+}
+
+// OpenedChan returns a channel that is closed the next time the CircuitBreaker becomes open,
+// e.g. to select on it along with a context to stop or back off a loop of requests.
+// It is edge-triggered: the channel is closed once per transition to the open state,
+// and OpenedChan returns a new channel for the next transition after that,
+// including while the CircuitBreaker is still open.
+func (cb *CircuitBreaker[T]) OpenedChan() <-chan struct{} {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.openedCh == nil {
+		cb.openedCh = make(chan struct{})
+	}
+	return cb.openedCh
+}
+
 // Counts returns internal counters
 func (cb *CircuitBreaker[T]) Counts() Counts {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	counts := cb.counts
+	if cb.state == StateClosed && cb.window != nil {
+		cb.window.peek(cb.clock.Now(), &counts)
+	}
+	return counts
+}
+
+// WindowInfo returns the state of the closed-state rolling window for diagnostics,
+// e.g. to find out why a long-closed CircuitBreaker discarded old data.
+// The window is reported as of now without being rotated.
+// If the CircuitBreaker has no rolling window, i.e. without both Settings.BucketPeriod and Settings.Interval,
+// WindowInfo returns the zero value.
+func (cb *CircuitBreaker[T]) WindowInfo() WindowInfo {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	if cb.window == nil {
+		return WindowInfo{}
+	}
+	return cb.window.info(cb.clock.Now())
+}
+
+// SwitchToRolling switches the closed state of the CircuitBreaker to a rolling window of interval
+// that consists of buckets of bucketPeriod, as if Settings.Interval and Settings.BucketPeriod were so,
+// without recreating the CircuitBreaker.
+// In the closed state, the totals of the current Counts are kept in the newest bucket of the new window,
+// so that they are dropped together after interval, and the consecutive counts are kept as they are.
+// In the other states, the new window is used from the next closed state.
+// HalfOpenMinBuckets keeps using Settings.BucketPeriod.
+// SwitchToRolling returns ErrInvalidWindow if interval or bucketPeriod is less than or equal to 0.
+func (cb *CircuitBreaker[T]) SwitchToRolling(interval, bucketPeriod time.Duration) error {
+	if interval <= 0 || bucketPeriod <= 0 {
+		return ErrInvalidWindow
+	}
+
 	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
+	defer cb.unlock()
+
+	now := cb.clock.Now()
+	state, _, _ := cb.currentState(now)
+
+	var dropped Counts
+	if cb.window != nil {
+		dropped = cb.window.dropped
+	}
+	cb.interval = interval
+	cb.window = newRollingCounts(interval, bucketPeriod)
+	cb.window.reset(now)
+	cb.bucketDecay = validBucketDecay(cb.settings.BucketDecay)
+
+	if state == StateClosed {
+		cb.window.dropped = dropped
+		cb.window.bucket(0).add(cb.counts)
+		cb.expiry = time.Time{}
+	}
+	return nil
+}
+
+// SwitchToFixed switches the closed state of the CircuitBreaker to a fixed window of interval,
+// as if Settings.Interval were so without Settings.BucketPeriod, without recreating the CircuitBreaker.
+// In the closed state, the current Counts are kept and the first interval starts now.
+// If interval is 0, Counts are not cleared during the closed state.
+// Note that the Counts reported by OnGenerationEnd for the current generation don't include
+// the buckets dropped from the rolling window before the switch.
+// In the other states, the new window is used from the next closed state.
+// SwitchToFixed returns ErrInvalidWindow if interval is negative.
+func (cb *CircuitBreaker[T]) SwitchToFixed(interval time.Duration) error {
+	if interval < 0 {
+		return ErrInvalidWindow
+	}
+
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	now := cb.clock.Now()
+	state, _, _ := cb.currentState(now)
+
+	cb.interval = interval
+	cb.window = nil
+	cb.bucketDecay = 0
+
+	if state == StateClosed {
+		if interval == 0 {
+			cb.expiry = time.Time{}
+		} else {
+			cb.expiry = now.Add(interval)
+		}
+	}
+	return nil
+}
+
+// CurrentTimeout returns the period of the open state that is in use,
+// or that will be used the next time the CircuitBreaker becomes open.
+func (cb *CircuitBreaker[T]) CurrentTimeout() time.Duration {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	return cb.openTimeout
+}
+
+// Reset places the CircuitBreaker into the closed state with cleared Counts, starting a new generation,
+// as if it had just been created. The outcomes of the requests in flight are discarded.
+// OnStateChange is called if the state changes.
+func (cb *CircuitBreaker[T]) Reset() {
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	now := cb.clock.Now()
+	if cb.state == StateClosed {
+		cb.toNewGeneration(now)
+		cb.stateGeneration = cb.generation
+		cb.dropPreserved()
+	} else {
+		cb.setState(StateClosed, now)
+	}
+}
+
+// AllowProbe places the CircuitBreaker into the half-open state if it is open,
+// so that the next requests probe the dependency.
+// It is the way to recover the CircuitBreaker with ManualRecovery short of Reset,
+// but it also ends the open state early without ManualRecovery.
+// OnStateChange is called if the state changes.
+func (cb *CircuitBreaker[T]) AllowProbe() {
+	cb.mutex.Lock()
+	defer cb.unlock()
 
-	return cb.counts
+	now := cb.clock.Now()
+	if state, _, _ := cb.currentState(now); state == StateOpen {
+		cb.setState(StateHalfOpen, now)
+	}
 }
 
 // Execute runs the given request if the CircuitBreaker accepts it.
-// Execute returns an error instantly if the CircuitBreaker rejects the request.
+// Execute returns an error instantly if the CircuitBreaker rejects the request,
+// along with the value given by RejectValue.
 // Otherwise, Execute returns the result of the request.
 // If a panic occurs in the request, the CircuitBreaker handles it as an error
 // and causes the same panic again.
 func (cb *CircuitBreaker[T]) Execute(req func() (T, error)) (T, error) {
-	generation, err := cb.beforeRequest()
+	state, generation, age, err := cb.admit()
+	if err != nil {
+		return cb.rejectedValue(), cb.rejectionError(state, err)
+	}
+
+	result, o, err := cb.run(generation, age, req, cb.classify)
+	return result, cb.requestError(state, o, err)
+}
+
+// checkRejectValue panics if rejectValue returns a non-nil value that is not a T,
+// which the rejected requests would otherwise turn into the zero value silently.
+func checkRejectValue[T any](rejectValue func() any) {
+	if rejectValue == nil {
+		return
+	}
+	if v := rejectValue(); v != nil {
+		if _, ok := v.(T); !ok {
+			panic(fmt.Sprintf("gobreaker: RejectValue returns %T, not %v", v, reflect.TypeFor[T]()))
+		}
+	}
+}
+
+// rejectedValue returns the result of a rejected request.
+func (cb *CircuitBreaker[T]) rejectedValue() T {
+	if cb.rejectValue != nil {
+		if v, ok := cb.rejectValue().(T); ok {
+			return v
+		}
+	}
+
+	var defaultValue T
+	return defaultValue
+}
+
+// ExecuteWithClassifier is like Execute, but the outcome of the request is determined by classify
+// instead of the classifiers of Settings, e.g. by an adapter that knows its results better.
+// If a panic occurs in the request, it is counted as a failure.
+func (cb *CircuitBreaker[T]) ExecuteWithClassifier(req func() (T, error), classify func(result T, err error) Outcome) (T, error) {
+	state, generation, age, err := cb.admit()
 	if err != nil {
-		var defaultValue T
-		return defaultValue, err
+		return cb.rejectedValue(), cb.rejectionError(state, err)
 	}
 
+	result, o, err := cb.run(generation, age, req, classify)
+	return result, cb.requestError(state, o, err)
+}
+
+// run runs the request accepted in the given generation and bucket age
+// and records its outcome determined by classify.
+// It also returns the outcome.
+func (cb *CircuitBreaker[T]) run(generation, age uint64, req func() (T, error), classify func(T, error) Outcome) (T, Outcome, error) {
+	return cb.runWith(req, classify, func(o Outcome, err error, began time.Time) {
+		cb.afterRequestSince(generation, age, o, err, began)
+	})
+}
+
+// runWith is like run but records the outcome of the request with record.
+func (cb *CircuitBreaker[T]) runWith(req func() (T, error), classify func(T, error) Outcome, record func(o Outcome, err error, began time.Time)) (T, Outcome, error) {
+	began := cb.startTime()
 	defer func() {
 		e := recover()
 		if e != nil {
-			cb.afterRequest(generation, false)
+			record(OutcomeFailure, fmt.Errorf("panic: %v", e), began)
 			panic(e)
 		}
 	}()
 
+	var start time.Time
+	if cb.timing != nil {
+		start = time.Now()
+	}
 	result, err := req()
-	cb.afterRequest(generation, cb.isSuccessful(err))
-	return result, err
+	if cb.timing != nil {
+		cb.timing.observeExecution(time.Since(start))
+	}
+	o := classify(result, err)
+	if cb.apdex != nil {
+		cb.apdex.observe(o, cb.clock.Now().Sub(began))
+	}
+	record(o, err, began)
+	return result, o, err
 }
 
 // Name returns the name of the TwoStepCircuitBreaker.
@@ -250,100 +1297,564 @@ func (tscb *TwoStepCircuitBreaker[T]) Name() string {
 	return tscb.cb.Name()
 }
 
+// Meta returns the data attached to the TwoStepCircuitBreaker by Settings.Meta.
+func (tscb *TwoStepCircuitBreaker[T]) Meta() any {
+	return tscb.cb.Meta()
+}
+
 // State returns the current state of the TwoStepCircuitBreaker.
 func (tscb *TwoStepCircuitBreaker[T]) State() State {
 	return tscb.cb.State()
 }
 
+// PeekState returns the current state of the TwoStepCircuitBreaker
+// without applying the transition that is due, if any.
+func (tscb *TwoStepCircuitBreaker[T]) PeekState() State {
+	return tscb.cb.PeekState()
+}
+
+// StateAge returns how long the TwoStepCircuitBreaker has been in the current state.
+func (tscb *TwoStepCircuitBreaker[T]) StateAge() time.Duration {
+	return tscb.cb.StateAge()
+}
+
+// ExpiresIn returns the time left until the current expiry of the TwoStepCircuitBreaker.
+func (tscb *TwoStepCircuitBreaker[T]) ExpiresIn() time.Duration {
+	return tscb.cb.ExpiresIn()
+}
+
 // Counts returns internal counters
 func (tscb *TwoStepCircuitBreaker[T]) Counts() Counts {
 	return tscb.cb.Counts()
 }
 
+// CurrentTimeout returns the period of the open state that is in use,
+// or that will be used the next time the TwoStepCircuitBreaker becomes open.
+func (tscb *TwoStepCircuitBreaker[T]) CurrentTimeout() time.Duration {
+	return tscb.cb.CurrentTimeout()
+}
+
+// Reset places the TwoStepCircuitBreaker into the closed state with cleared Counts.
+// See CircuitBreaker.Reset.
+func (tscb *TwoStepCircuitBreaker[T]) Reset() {
+	tscb.cb.Reset()
+}
+
+// AllowProbe places the TwoStepCircuitBreaker into the half-open state if it is open.
+// See CircuitBreaker.AllowProbe.
+func (tscb *TwoStepCircuitBreaker[T]) AllowProbe() {
+	tscb.cb.AllowProbe()
+}
+
 // Allow checks if a new request can proceed. It returns a callback that should be used to
 // register the success or failure in a separate step. If the circuit breaker doesn't allow
 // requests, it returns an error.
 func (tscb *TwoStepCircuitBreaker[T]) Allow() (done func(success bool), err error) {
-	generation, err := tscb.cb.beforeRequest()
+	generation, age, err := tscb.cb.beforeRequest()
 	if err != nil {
 		return nil, err
 	}
 
+	start := tscb.cb.startTime()
 	return func(success bool) {
-		tscb.cb.afterRequest(generation, success)
+		tscb.cb.afterRequestSince(generation, age, outcomeOf(success), nil, start)
 	}, nil
 }
 
-func (cb *CircuitBreaker[T]) beforeRequest() (uint64, error) {
-	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
+// AllowResult is like Allow, but the returned callback takes the result and the error of the request
+// and classifies them in the same way as Execute does.
+func (tscb *TwoStepCircuitBreaker[T]) AllowResult() (done func(result T, err error), err error) {
+	generation, age, err := tscb.cb.beforeRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	start := tscb.cb.startTime()
+	return func(result T, err error) {
+		tscb.cb.afterRequestSince(generation, age, tscb.cb.classify(result, err), err, start)
+	}, nil
+}
+
+// AllowOutcome is like Allow, but the returned callback takes the Outcome of the request,
+// for the callers that classify their own results, e.g. from a value they computed,
+// rather than from an error. OutcomeExcluded counts the request as an exclusion.
+func (tscb *TwoStepCircuitBreaker[T]) AllowOutcome() (done func(o Outcome), err error) {
+	generation, age, err := tscb.cb.beforeRequest()
+	if err != nil {
+		return nil, err
+	}
 
-	now := time.Now()
-	state, generation := cb.currentState(now)
+	start := tscb.cb.startTime()
+	return func(o Outcome) {
+		tscb.cb.afterRequestSince(generation, age, o, nil, start)
+	}, nil
+}
 
+func (cb *CircuitBreaker[T]) classify(result T, err error) Outcome {
+	if o, ok := cb.classifyByChain(err); ok {
+		return o
+	}
+	if cb.classifyOutcome != nil {
+		return cb.classifyByFunc(err)
+	}
+	if cb.isExcluded != nil && cb.isExcluded(err) {
+		return OutcomeExcluded
+	}
+	if cb.isExcludedResult != nil && cb.isExcludedResult(result, err) {
+		return OutcomeExcluded
+	}
+	if cb.isSuccessfulResult != nil && (err == nil || cb.resultMatters) {
+		return outcomeOf(cb.isSuccessfulResult(result, err))
+	}
+	return outcomeOf(cb.isSuccessful(err))
+}
+
+// classifyByFunc classifies the error by Classify, counting an unknown Outcome as a failure.
+func (cb *CircuitBreaker[T]) classifyByFunc(err error) Outcome {
+	switch o := cb.classifyOutcome(err); o {
+	case OutcomeSuccess, OutcomeExcluded:
+		return o
+	default:
+		return OutcomeFailure
+	}
+}
+
+// classifyByChain classifies the error by CircuitOutcome or Classifiers, if any of them handles it.
+func (cb *CircuitBreaker[T]) classifyByChain(err error) (Outcome, bool) {
+	if o, ok := declaredOutcome(err); ok {
+		return o, true
+	}
+	for _, classify := range cb.classifiers {
+		if o, ok := classify(err); ok {
+			return o, true
+		}
+	}
+	return OutcomeSuccess, false
+}
+
+func (cb *CircuitBreaker[T]) beforeRequest() (uint64, uint64, error) {
+	_, generation, age, err := cb.admit()
+	return generation, age, err
+}
+
+// admit is like beforeRequest but also returns the state in which the request is admitted or rejected.
+func (cb *CircuitBreaker[T]) admit() (State, uint64, uint64, error) {
+	return cb.admitN(1)
+}
+
+// admitN admits or rejects a batch of n requests as a whole, like admit for a single request.
+func (cb *CircuitBreaker[T]) admitN(n int) (State, uint64, uint64, error) {
+	switch CurrentGlobalMode() {
+	case GlobalModeForceOpenAll:
+		return StateOpen, bypassGeneration, 0, ErrOpenState
+	case GlobalModeDisableAll:
+		return StateClosed, bypassGeneration, 0, nil
+	}
+
+	// A single request takes a slot of the half-open state before the lock,
+	// so that the requests over MaxRequests are rejected without contending for it.
+	var slot *halfOpenGate
+	if gate := cb.halfOpenGate.Load(); gate != nil && n == 1 {
+		if gate.tryAcquire() {
+			slot = gate
+		} else if gate.sheds() && !cb.observeOnly {
+			return StateHalfOpen, 0, 0, ErrTooManyRequests
+		}
+	}
+
+	if cb.timing != nil {
+		start := time.Now()
+		cb.mutex.Lock()
+		cb.timing.observeQueue(time.Since(start))
+	} else {
+		cb.mutex.Lock()
+	}
+	defer cb.unlock()
+
+	now := cb.clock.Now()
+	if n == 1 {
+		return cb.admitAt(now, slot)
+	}
+	return cb.admitBatchAt(now, n)
+}
+
+// admitAt admits or rejects a request at the given time.
+// slot is the gate of the half-open state from which the request has taken a slot before the lock, if any;
+// the slot is kept only if the request is admitted in the half-open state of the gate.
+// It must be called with the write lock held.
+func (cb *CircuitBreaker[T]) admitAt(now time.Time, slot *halfOpenGate) (State, uint64, uint64, error) {
+	kept := false
+	defer func() {
+		if slot != nil && !kept {
+			slot.release()
+		}
+	}()
+
+	state, generation, age := cb.currentState(now)
+	if state == StateClosed && cb.maxAccumulated > 0 && cb.generationRequests >= cb.maxAccumulated {
+		cb.toNextInterval(now)
+		state, generation, age = cb.currentState(now)
+	}
+
+	if state == StateForcedOpen {
+		return state, generation, age, ErrOpenState
+	}
 	if state == StateOpen {
-		return generation, ErrOpenState
-	} else if state == StateHalfOpen && cb.counts.Requests >= cb.maxRequests {
-		return generation, ErrTooManyRequests
+		if !cb.observeOnly {
+			return state, generation, age, ErrOpenState
+		}
+		cb.wouldReject(ErrOpenState)
+		cb.inFlight++
+		return state, generation, age, nil
+	}
+
+	if state == StateClosed && !cb.rampUpAdmits(now) {
+		if !cb.observeOnly {
+			return state, generation, age, ErrRampUpLimited
+		}
+		cb.wouldReject(ErrRampUpLimited)
+	}
+	if cb.maxConcurrent > 0 && cb.inFlight >= cb.maxConcurrent && state != StateForcedClosed {
+		if !cb.observeOnly {
+			return state, generation, age, ErrTooManyConcurrentRequests
+		}
+		cb.wouldReject(ErrTooManyConcurrentRequests)
+	}
+	if state == StateHalfOpen && !cb.probeSpaced(now) {
+		if !cb.observeOnly {
+			return state, generation, age, ErrTooManyRequests
+		}
+		cb.wouldReject(ErrTooManyRequests)
+	}
+	if state == StateHalfOpen && cb.probeRatio > 0 {
+		if !cb.sampleProbe() {
+			if !cb.observeOnly {
+				return state, generation, age, ErrTooManyRequests
+			}
+			cb.wouldReject(ErrTooManyRequests)
+		}
+	} else if state == StateHalfOpen && cb.probeGated() {
+		gate := cb.halfOpenGate.Load()
+		if slot == gate {
+			kept = true
+		} else if !gate.tryAcquire() {
+			cb.saturated = true
+			gate.shed()
+			if !cb.observeOnly {
+				return state, generation, age, ErrTooManyRequests
+			}
+			cb.wouldReject(ErrTooManyRequests)
+			gate.occupy()
+		}
 	}
 
+	if state == StateHalfOpen {
+		cb.lastProbeAt = now
+	}
+	cb.countAdmission(state, age)
+	return state, generation, age, nil
+}
+
+// countAdmission counts a request admitted in the given state and bucket age.
+func (cb *CircuitBreaker[T]) countAdmission(state State, age uint64) {
 	cb.counts.onRequest()
-	return generation, nil
+	if bucket := cb.bucket(state, age); bucket != nil {
+		bucket.onRequest()
+	}
+	if cb.generationRequests < math.MaxUint32 {
+		cb.generationRequests++
+	}
+	cb.inFlight++
 }
 
-func (cb *CircuitBreaker[T]) afterRequest(before uint64, success bool) {
-	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
+// wouldReject schedules OnWouldReject for a request admitted only because of ObserveOnly.
+func (cb *CircuitBreaker[T]) wouldReject(err error) {
+	if cb.onWouldReject != nil {
+		name := cb.name
+		cb.callback(func() { cb.onWouldReject(name, err) })
+	}
+}
+
+// resetHalfOpenGate installs a new gate of the half-open state with the given number of the slots taken
+// if the CircuitBreaker is half-open and its requests take the slots, or removes the gate otherwise.
+// It must be called with the write lock held whenever the state is replaced.
+func (cb *CircuitBreaker[T]) resetHalfOpenGate(taken uint32) {
+	if cb.state == StateHalfOpen && cb.probeGated() {
+		cb.halfOpenGate.Store(newHalfOpenGate(cb.maxRequests, taken))
+	} else {
+		cb.halfOpenGate.Store(nil)
+	}
+}
+
+// probeGated reports whether the requests of the half-open state take the slots of MaxRequests,
+// which is the case unless HalfOpenProbeRatio or UnlimitedHalfOpenRequests is set.
+func (cb *CircuitBreaker[T]) probeGated() bool {
+	return cb.probeRatio == 0 && !cb.unlimitedHalfOpen
+}
+
+// probeSpaced reports whether a request made in the half-open state at the given time
+// is at least HalfOpenProbeInterval after the last request allowed in the state.
+func (cb *CircuitBreaker[T]) probeSpaced(now time.Time) bool {
+	return cb.probeInterval <= 0 || cb.lastProbeAt.IsZero() || !now.Before(cb.lastProbeAt.Add(cb.probeInterval))
+}
+
+// sampleProbe counts a request made in the half-open state and reports whether it is sampled by HalfOpenProbeRatio.
+// The n-th request is sampled if the number of the sampled requests, rounded up from n * HalfOpenProbeRatio,
+// grows with it, so that the first request is always sampled.
+func (cb *CircuitBreaker[T]) sampleProbe() bool {
+	cb.halfOpenArrivals++
+	n := float64(cb.halfOpenArrivals)
+	return math.Ceil(n*cb.probeRatio) > math.Ceil((n-1)*cb.probeRatio)
+}
+
+// halfOpenRequests returns the number of requests that occupy the slots of the half-open state
+// according to Counts.
+func (cb *CircuitBreaker[T]) halfOpenRequests() uint32 {
+	requests := cb.counts.Requests
+	if !cb.exclusionsConsume {
+		requests -= cb.counts.TotalExclusions
+	}
+	if cb.halfOpenMinBuckets > 1 {
+		requests -= cb.counts.TotalSuccesses
+	}
+	return requests
+}
+
+// bucket returns the bucket of the rolling window for the request started at the given age,
+// or nil if the requests in the given state are not counted per bucket.
+func (cb *CircuitBreaker[T]) bucket(state State, age uint64) *Counts {
+	if state != StateClosed || cb.window == nil {
+		return nil
+	}
+	return cb.window.bucket(age)
+}
+
+// afterRequest records the outcome of the request started in the given generation and bucket age.
+// err is the error of the request, if any, kept as the last error for OnTrip if the request failed.
+func (cb *CircuitBreaker[T]) afterRequest(before, age uint64, o Outcome, err error) {
+	cb.afterRequestSince(before, age, o, err, time.Time{})
+}
 
-	now := time.Now()
-	state, generation := cb.currentState(now)
-	if generation != before {
+// afterRequestSince is like afterRequest for the request started at the given time,
+// which is zero if unknown.
+func (cb *CircuitBreaker[T]) afterRequestSince(before, age uint64, o Outcome, err error, start time.Time) {
+	if before == bypassGeneration {
 		return
 	}
 
-	if success {
+	var freed *halfOpenGate
+	defer func() {
+		// The slot of the half-open state is freed after the lock, like it is taken before it.
+		if freed != nil {
+			freed.release()
+		}
+	}()
+
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	freed = cb.recordOutcome(before, age, o, err, start)
+}
+
+// recordOutcome records the outcome of a request like afterRequestSince.
+// It returns the gate of the half-open state whose slot the outcome frees, if any,
+// for the caller to release after the lock.
+// It must be called with the write lock held.
+func (cb *CircuitBreaker[T]) recordOutcome(before, age uint64, o Outcome, err error, start time.Time) *halfOpenGate {
+	if cb.inFlight > 0 {
+		cb.inFlight--
+	}
+
+	now := cb.clock.Now()
+	state, generation, current := cb.currentState(now)
+	if state == StateOpen {
+		// Only the requests admitted by ObserveOnly can finish in the generation of the open state.
+		return nil
+	}
+	bucket := cb.bucket(state, age)
+	dropped := state == StateClosed && cb.window != nil && bucket == nil
+	if generation != before || dropped {
+		if !cb.carriesOver(state, before) {
+			return nil
+		}
+		cb.counts.onRequest()
+		age = current
+		bucket = cb.bucket(state, current)
+		if bucket != nil {
+			bucket.onRequest()
+		}
+	}
+
+	if state == StateHalfOpen && o == OutcomeSuccess && cb.tooSlow(start, now) {
+		o, err = OutcomeFailure, ErrSlowProbe
+	}
+	var freed *halfOpenGate
+	if state == StateHalfOpen && cb.probeGated() && cb.freesSlot(o) {
+		freed = cb.halfOpenGate.Load()
+	}
+	cb.observeLatency(o, start, now, state, age)
+
+	switch o {
+	case OutcomeSuccess:
+		if bucket != nil {
+			bucket.onSuccess()
+		}
 		cb.onSuccess(state, now)
-	} else {
-		cb.onFailure(state, now)
+	case OutcomeFailure:
+		weight := cb.failureWeight(err)
+		if bucket != nil {
+			bucket.onWeightedFailure(weight)
+		}
+		cb.lastError = err
+		cb.onFailure(state, now, weight)
+	case OutcomeExcluded:
+		if bucket != nil {
+			bucket.onExclusion()
+		}
+		cb.counts.onExclusion()
+	}
+	cb.notifyOutcome(o, start, now, generation, state)
+	return freed
+}
+
+// freesSlot reports whether a request of the given outcome frees its slot of the half-open state.
+func (cb *CircuitBreaker[T]) freesSlot(o Outcome) bool {
+	switch o {
+	case OutcomeExcluded:
+		return !cb.exclusionsConsume
+	case OutcomeSuccess:
+		return cb.halfOpenMinBuckets > 1
+	default:
+		return false
 	}
 }
 
+// carriesOver reports whether the outcome of a request started in the generation before
+// is counted in the current generation.
+// It is the case only when the closed-state interval has elapsed without any change of the state.
+func (cb *CircuitBreaker[T]) carriesOver(state State, before uint64) bool {
+	return cb.intervalCarryOver && state == StateClosed && before >= cb.stateGeneration
+}
+
 func (cb *CircuitBreaker[T]) onSuccess(state State, now time.Time) {
 	switch state {
 	case StateClosed:
 		cb.counts.onSuccess()
+		if cb.canTrip(now) && cb.tripsOnLatency() {
+			cb.setState(StateOpen, now)
+		}
+	case StateForcedClosed:
+		cb.counts.onSuccess()
 	case StateHalfOpen:
 		cb.counts.onSuccess()
-		if cb.counts.ConsecutiveSuccesses >= cb.maxRequests {
+		cb.countHalfOpenBucket(now)
+		if cb.recovered() && cb.halfOpenBuckets >= cb.halfOpenMinBuckets {
 			cb.setState(StateClosed, now)
 		}
 	}
 }
 
-func (cb *CircuitBreaker[T]) onFailure(state State, now time.Time) {
+// recovered reports whether the successes counted in the half-open state are enough to become closed.
+func (cb *CircuitBreaker[T]) recovered() bool {
+	if cb.successThreshold == 0 {
+		return cb.counts.ConsecutiveSuccesses >= cb.maxRequests
+	}
+	return float64(cb.counts.TotalSuccesses)/float64(cb.maxRequests) >= cb.successThreshold
+}
+
+// toleratesFailure reports whether the CircuitBreaker stays half-open on one more failure,
+// which is the case if HalfOpenSuccessThreshold can still be reached by the remaining probes.
+func (cb *CircuitBreaker[T]) toleratesFailure() bool {
+	if cb.successThreshold == 0 || cb.counts.TotalFailures >= cb.maxRequests {
+		return false
+	}
+	return float64(cb.maxRequests-cb.counts.TotalFailures-1)/float64(cb.maxRequests) >= cb.successThreshold
+}
+
+// countHalfOpenBucket counts the period of BucketPeriod in the half-open state
+// in which a success is counted at the given time, if no success has been counted in it yet.
+func (cb *CircuitBreaker[T]) countHalfOpenBucket(now time.Time) {
+	if cb.bucketPeriod <= 0 {
+		return
+	}
+
+	age := bucketAge(cb.halfOpenedAt, now, cb.bucketPeriod)
+	if cb.halfOpenBuckets == 0 || age != cb.lastSuccessAge {
+		cb.halfOpenBuckets++
+		cb.lastSuccessAge = age
+	}
+}
+
+func (cb *CircuitBreaker[T]) onFailure(state State, now time.Time, weight float64) {
 	switch state {
 	case StateClosed:
-		cb.counts.onFailure()
-		if cb.readyToTrip(cb.counts) {
+		cb.counts.onWeightedFailure(weight)
+		if cb.canTrip(now) && (cb.readyToTrip(cb.tripCounts()) || cb.tripsOnLatency()) {
 			cb.setState(StateOpen, now)
 		}
+	case StateForcedClosed:
+		cb.counts.onWeightedFailure(weight)
 	case StateHalfOpen:
+		if cb.toleratesFailure() {
+			cb.counts.onWeightedFailure(weight)
+			return
+		}
 		cb.setState(StateOpen, now)
 	}
 }
 
-func (cb *CircuitBreaker[T]) currentState(now time.Time) (State, uint64) {
+// failureWeight returns the weight of a failure of the given error given by Settings.Weight.
+func (cb *CircuitBreaker[T]) failureWeight(err error) float64 {
+	if cb.weight == nil {
+		return 1
+	}
+	if weight := cb.weight(err); weight > 0 {
+		return weight
+	}
+	return 0
+}
+
+// tripCounts returns the Counts given to ReadyToTrip in the closed state,
+// which are weighted by BucketDecay if any.
+func (cb *CircuitBreaker[T]) tripCounts() Counts {
+	if cb.window == nil || cb.bucketDecay == 0 {
+		return cb.counts
+	}
+	return cb.window.weighted(cb.counts, cb.bucketDecay)
+}
+
+// canTrip reports whether the CircuitBreaker in the closed state may trip at the given time.
+func (cb *CircuitBreaker[T]) canTrip(now time.Time) bool {
+	if cb.ignoreFirstN > 0 && cb.generationRequests <= cb.ignoreFirstN {
+		return false
+	}
+	return cb.minClosedDuration <= 0 || !now.Before(cb.recoveredAt.Add(cb.minClosedDuration))
+}
+
+// currentState applies the transition that is due at the given time, if any,
+// and returns the state, the generation and the age of the newest bucket of the rolling window.
+// It must be called with the write lock held. Since the transition changes cb.state before the lock
+// is released, each transition happens exactly once however many goroutines reach the boundary.
+func (cb *CircuitBreaker[T]) currentState(now time.Time) (State, uint64, uint64) {
+	cb.flushDueStateChange(now)
+
 	switch cb.state {
 	case StateClosed:
 		if !cb.expiry.IsZero() && cb.expiry.Before(now) {
-			cb.toNewGeneration(now)
+			cb.toNextInterval(now)
 		}
 	case StateOpen:
-		if cb.expiry.Before(now) {
+		if !cb.expiry.IsZero() && cb.expiry.Before(now) {
 			cb.setState(StateHalfOpen, now)
 		}
 	}
-	return cb.state, cb.generation
+
+	var age uint64
+	if cb.state == StateClosed && cb.window != nil {
+		cb.window.rotate(now, &cb.counts)
+		age = cb.window.age
+	}
+	return cb.state, cb.generation, age
 }
 
 func (cb *CircuitBreaker[T]) setState(state State, now time.Time) {
@@ -352,30 +1863,229 @@ func (cb *CircuitBreaker[T]) setState(state State, now time.Time) {
 	}
 
 	prev := cb.state
+	if state == StateOpen && cb.onTrip != nil {
+		name, lastErr, counts := cb.name, cb.lastError, cb.counts
+		cb.callback(func() { cb.onTrip(name, lastErr, counts) })
+	}
 	cb.state = state
+	cb.stateChangedAt = now
+	cb.countProbe(prev, state)
+	cb.publishStateChange(prev, state, now)
+	cb.stopRampUp()
 
+	cb.updateOpenTimeout(prev, state)
 	cb.toNewGeneration(now)
+	cb.stateGeneration = cb.generation
+	cb.resetHalfOpenGate(0)
+
+	cb.notifyStateChange(prev, state, now)
+	cb.probeTransition(prev, state)
+
+	if (state == StateOpen || state == StateForcedOpen) && cb.cancelOpenCtx != nil {
+		cb.cancelOpenCtx(ErrOpenState)
+		cb.openCtx, cb.cancelOpenCtx = context.WithCancelCause(context.Background())
+	}
+	if (state == StateOpen || state == StateForcedOpen) && cb.openedCh != nil {
+		close(cb.openedCh)
+		cb.openedCh = nil
+	}
+
+	switch {
+	case prev == StateClosed && state == StateOpen:
+		cb.openedAt = now
+	case state == StateHalfOpen:
+		cb.halfOpenedAt = now
+		cb.halfOpenBuckets = 0
+		cb.halfOpenArrivals = 0
+		cb.lastProbeAt = time.Time{}
+	case prev == StateHalfOpen && state == StateClosed:
+		cb.recoveredAt = now
+		cb.startRampUp(now)
+		if cb.onRecover != nil {
+			name, downtime := cb.name, now.Sub(cb.openedAt)
+			cb.callback(func() { cb.onRecover(name, downtime) })
+		}
+	}
+}
+
+// probeTransition schedules OnProbeStart or OnProbeEnd for the transition from prev to state, if any.
+func (cb *CircuitBreaker[T]) probeTransition(prev State, state State) {
+	name := cb.name
+	switch {
+	case state == StateHalfOpen && cb.onProbeStart != nil:
+		cb.callback(func() { cb.onProbeStart(name) })
+	case prev == StateHalfOpen && cb.onProbeEnd != nil:
+		closed := state == StateClosed
+		cb.callback(func() { cb.onProbeEnd(name, closed) })
+	}
+}
+
+// countProbe counts the failed probe for MaxProbeAttempts on the transition from prev to state, if any.
+func (cb *CircuitBreaker[T]) countProbe(prev State, state State) {
+	switch {
+	case state == StateClosed:
+		cb.failedProbes = 0
+	case prev == StateHalfOpen && state == StateOpen:
+		if cb.failedProbes < math.MaxUint32 {
+			cb.failedProbes++
+		}
+		if cb.maxProbeAttempts > 0 && cb.failedProbes == cb.maxProbeAttempts && cb.onProbeExhausted != nil {
+			name := cb.name
+			cb.callback(func() { cb.onProbeExhausted(name) })
+		}
+	}
+}
+
+// probeBudgetExhausted reports whether the CircuitBreaker has given up probing by MaxProbeAttempts.
+func (cb *CircuitBreaker[T]) probeBudgetExhausted() bool {
+	return cb.maxProbeAttempts > 0 && cb.failedProbes >= cb.maxProbeAttempts
+}
+
+// preserveSuccessesOf carries the successes of the previous generation over to the current one
+// for PreserveSuccessesOnReset.
+func (cb *CircuitBreaker[T]) preserveSuccessesOf(prev Counts) {
+	cb.preserved = Counts{
+		Requests:       prev.TotalSuccesses,
+		TotalSuccesses: prev.TotalSuccesses,
+	}
+	cb.counts.add(cb.preserved)
+	cb.counts.ConsecutiveSuccesses = prev.ConsecutiveSuccesses
+	if cb.window != nil {
+		cb.window.bucket(cb.window.age).add(cb.preserved)
+	}
+}
+
+// dropPreserved clears the successes kept by PreserveSuccessesOnReset from the current generation.
+func (cb *CircuitBreaker[T]) dropPreserved() {
+	cb.counts.clear()
+	cb.preserved.clear()
+	if cb.window != nil {
+		cb.window.bucket(cb.window.age).clear()
+	}
+}
+
+// callback schedules f to be called after the lock of the CircuitBreaker is released.
+func (cb *CircuitBreaker[T]) callback(f func()) {
+	cb.callbacks = append(cb.callbacks, f)
+}
+
+// stage holds the callbacks scheduled from now on, OnStateChange included, until unstage,
+// e.g. while DistributedCircuitBreaker tries a change of the shared state that may not be written.
+func (cb *CircuitBreaker[T]) stage() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.staging = true
+	cb.staged = nil
+}
+
+// unstage stops holding the callbacks and returns those held since stage,
+// which the caller calls only if the change they report is kept.
+func (cb *CircuitBreaker[T]) unstage() []func() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	staged := cb.staged
+	cb.staging = false
+	cb.staged = nil
+	return staged
+}
+
+// unlock releases the lock of the CircuitBreaker and then calls the scheduled callbacks,
+// or keeps them for unstage if they are staged.
+func (cb *CircuitBreaker[T]) unlock() {
+	callbacks := cb.callbacks
+	cb.callbacks = nil
+	if cb.staging {
+		cb.staged = append(cb.staged, callbacks...)
+		callbacks = nil
+	}
+	cb.mutex.Unlock()
+
+	for _, f := range callbacks {
+		f()
+	}
+}
+
+func (cb *CircuitBreaker[T]) updateOpenTimeout(prev State, state State) {
+	switch {
+	case state == StateClosed:
+		cb.openTimeout = cb.timeout
+	case state == StateOpen && cb.generateTimeout != nil:
+		cb.openTimeout = cb.generateTimeout(cb.openTimeout, cb.counts)
+		if cb.openTimeout <= 0 {
+			cb.openTimeout = cb.timeout
+		}
+	case prev == StateHalfOpen && state == StateOpen && cb.saturated && cb.saturationBackoff > 1:
+		timeout := float64(cb.openTimeout) * cb.saturationBackoff
+		if timeout >= math.MaxInt64 {
+			cb.openTimeout = math.MaxInt64
+		} else {
+			cb.openTimeout = time.Duration(timeout)
+		}
+		if cb.maxSaturationTimeout > 0 && cb.openTimeout > cb.maxSaturationTimeout {
+			cb.openTimeout = cb.maxSaturationTimeout
+		}
+	}
+	cb.saturated = false
+}
 
-	if cb.onStateChange != nil {
-		cb.onStateChange(cb.name, prev, state)
+// endedCounts returns the Counts of the current generation reported when it ends.
+func (cb *CircuitBreaker[T]) endedCounts() Counts {
+	counts := cb.counts
+	if cb.window != nil {
+		counts.add(cb.window.dropped)
 	}
+	counts.subtract(cb.preserved)
+	return counts
+}
+
+// toNextInterval starts a new generation of the closed state without a change of the state.
+func (cb *CircuitBreaker[T]) toNextInterval(now time.Time) {
+	if cb.onIntervalReset != nil {
+		name, counts := cb.name, cb.endedCounts()
+		cb.callback(func() { cb.onIntervalReset(name, counts) })
+	}
+	cb.toNewGeneration(now)
 }
 
 func (cb *CircuitBreaker[T]) toNewGeneration(now time.Time) {
+	if cb.onGenerationEnd != nil && cb.generation > 0 {
+		name, counts := cb.name, cb.endedCounts()
+		cb.callback(func() { cb.onGenerationEnd(name, counts) })
+	}
+
+	prev := cb.counts
 	cb.generation++
 	cb.counts.clear()
+	cb.preserved.clear()
+	if cb.latency != nil {
+		cb.latency.reset()
+	}
+	cb.generationRequests = 0
+	if cb.window != nil {
+		cb.window.reset(now)
+	}
+	if cb.preserveSuccesses && cb.state == StateClosed {
+		cb.preserveSuccessesOf(prev)
+	}
 
 	var zero time.Time
 	switch cb.state {
 	case StateClosed:
-		if cb.interval == 0 {
+		if cb.interval == 0 || cb.window != nil {
 			cb.expiry = zero
 		} else {
 			cb.expiry = now.Add(cb.interval)
 		}
 	case StateOpen:
-		cb.expiry = now.Add(cb.timeout)
-	default: // StateHalfOpen
+		if cb.manualRecovery || cb.probeBudgetExhausted() {
+			cb.expiry = zero
+		} else {
+			cb.expiry = now.Add(cb.openTimeout)
+		}
+	case StateHalfOpen, StateForcedOpen, StateForcedClosed:
+		// These states end only by requests or by a manual change, never by time.
 		cb.expiry = zero
 	}
 }
@@ -1,8 +1,12 @@
 package gobreaker
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"math"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -20,6 +24,29 @@ type StateChange struct {
 
 var stateChange StateChange
 
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) advance(period time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(period)
+}
+
 func pseudoSleep(cb *CircuitBreaker[bool], period time.Duration) {
 	if !cb.expiry.IsZero() {
 		cb.expiry = cb.expiry.Add(-period)
@@ -120,9 +147,22 @@ func TestStateConstants(t *testing.T) {
 	assert.Equal(t, StateClosed.String(), "closed")
 	assert.Equal(t, StateHalfOpen.String(), "half-open")
 	assert.Equal(t, StateOpen.String(), "open")
+	assert.Equal(t, StateForcedOpen.String(), "forced-open")
+	assert.Equal(t, StateForcedClosed.String(), "forced-closed")
 	assert.Equal(t, State(100).String(), "unknown state: 100")
 }
 
+func TestOutcomeConstants(t *testing.T) {
+	assert.Equal(t, Outcome(0), OutcomeSuccess)
+	assert.Equal(t, Outcome(1), OutcomeFailure)
+	assert.Equal(t, Outcome(2), OutcomeExcluded)
+
+	assert.Equal(t, OutcomeSuccess.String(), "success")
+	assert.Equal(t, OutcomeFailure.String(), "failure")
+	assert.Equal(t, OutcomeExcluded.String(), "excluded")
+	assert.Equal(t, Outcome(100).String(), "unknown outcome: 100")
+}
+
 func TestNewCircuitBreaker(t *testing.T) {
 	defaultCB := NewCircuitBreaker[bool](Settings{})
 	assert.Equal(t, "", defaultCB.name)
@@ -132,7 +172,7 @@ func TestNewCircuitBreaker(t *testing.T) {
 	assert.NotNil(t, defaultCB.readyToTrip)
 	assert.Nil(t, defaultCB.onStateChange)
 	assert.Equal(t, StateClosed, defaultCB.state)
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, defaultCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, defaultCB.counts)
 	assert.True(t, defaultCB.expiry.IsZero())
 
 	customCB := newCustom()
@@ -143,7 +183,7 @@ func TestNewCircuitBreaker(t *testing.T) {
 	assert.NotNil(t, customCB.readyToTrip)
 	assert.NotNil(t, customCB.onStateChange)
 	assert.Equal(t, StateClosed, customCB.state)
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, customCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, customCB.counts)
 	assert.False(t, customCB.expiry.IsZero())
 
 	negativeDurationCB := newNegativeDurationCB()
@@ -154,10 +194,39 @@ func TestNewCircuitBreaker(t *testing.T) {
 	assert.NotNil(t, negativeDurationCB.readyToTrip)
 	assert.Nil(t, negativeDurationCB.onStateChange)
 	assert.Equal(t, StateClosed, negativeDurationCB.state)
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, negativeDurationCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, negativeDurationCB.counts)
 	assert.True(t, negativeDurationCB.expiry.IsZero())
 }
 
+func TestNameFunc(t *testing.T) {
+	calls := 0
+	nameFunc := func() string {
+		calls++
+		return "derived"
+	}
+
+	cb := NewCircuitBreaker[bool](Settings{NameFunc: nameFunc})
+	assert.Equal(t, "derived", cb.Name())
+	assert.Equal(t, "derived", cb.Name())
+	assert.Equal(t, 1, calls)
+
+	// Name takes precedence
+	cb = NewCircuitBreaker[bool](Settings{Name: "explicit", NameFunc: nameFunc})
+	assert.Equal(t, "explicit", cb.Name())
+	assert.Equal(t, 1, calls)
+}
+
+func TestMeta(t *testing.T) {
+	assert.Nil(t, NewCircuitBreaker[bool](Settings{}).Meta())
+
+	type endpoint struct{ host string }
+	cb := NewCircuitBreaker[bool](Settings{Meta: &endpoint{"example.com"}})
+	assert.Equal(t, &endpoint{"example.com"}, cb.Meta())
+
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{Meta: "meta"})
+	assert.Equal(t, "meta", tscb.Meta())
+}
+
 func TestDefaultCircuitBreaker(t *testing.T) {
 	assert.Equal(t, "", defaultCB.Name())
 
@@ -165,27 +234,27 @@ func TestDefaultCircuitBreaker(t *testing.T) {
 		assert.Nil(t, fail(defaultCB))
 	}
 	assert.Equal(t, StateClosed, defaultCB.State())
-	assert.Equal(t, Counts{5, 0, 5, 0, 5}, defaultCB.counts)
+	assert.Equal(t, Counts{5, 0, 5, 0, 5, 0, 5}, defaultCB.counts)
 
 	assert.Nil(t, succeed(defaultCB))
 	assert.Equal(t, StateClosed, defaultCB.State())
-	assert.Equal(t, Counts{6, 1, 5, 1, 0}, defaultCB.counts)
+	assert.Equal(t, Counts{6, 1, 5, 1, 0, 0, 5}, defaultCB.counts)
 
 	assert.Nil(t, fail(defaultCB))
 	assert.Equal(t, StateClosed, defaultCB.State())
-	assert.Equal(t, Counts{7, 1, 6, 0, 1}, defaultCB.counts)
+	assert.Equal(t, Counts{7, 1, 6, 0, 1, 0, 6}, defaultCB.counts)
 
 	// StateClosed to StateOpen
 	for i := 0; i < 5; i++ {
 		assert.Nil(t, fail(defaultCB)) // 6 consecutive failures
 	}
 	assert.Equal(t, StateOpen, defaultCB.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, defaultCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, defaultCB.counts)
 	assert.False(t, defaultCB.expiry.IsZero())
 
 	assert.Error(t, succeed(defaultCB))
 	assert.Error(t, fail(defaultCB))
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, defaultCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, defaultCB.counts)
 
 	pseudoSleep(defaultCB, time.Duration(59)*time.Second)
 	assert.Equal(t, StateOpen, defaultCB.State())
@@ -198,7 +267,7 @@ func TestDefaultCircuitBreaker(t *testing.T) {
 	// StateHalfOpen to StateOpen
 	assert.Nil(t, fail(defaultCB))
 	assert.Equal(t, StateOpen, defaultCB.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, defaultCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, defaultCB.counts)
 	assert.False(t, defaultCB.expiry.IsZero())
 
 	// StateOpen to StateHalfOpen
@@ -209,7 +278,7 @@ func TestDefaultCircuitBreaker(t *testing.T) {
 	// StateHalfOpen to StateClosed
 	assert.Nil(t, succeed(defaultCB))
 	assert.Equal(t, StateClosed, defaultCB.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, defaultCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, defaultCB.counts)
 	assert.True(t, defaultCB.expiry.IsZero())
 }
 
@@ -221,23 +290,23 @@ func TestCustomCircuitBreaker(t *testing.T) {
 		assert.Nil(t, fail(customCB))
 	}
 	assert.Equal(t, StateClosed, customCB.State())
-	assert.Equal(t, Counts{10, 5, 5, 0, 1}, customCB.counts)
+	assert.Equal(t, Counts{10, 5, 5, 0, 1, 0, 5}, customCB.counts)
 
 	pseudoSleep(customCB, time.Duration(29)*time.Second)
 	assert.Nil(t, succeed(customCB))
 	assert.Equal(t, StateClosed, customCB.State())
-	assert.Equal(t, Counts{11, 6, 5, 1, 0}, customCB.counts)
+	assert.Equal(t, Counts{11, 6, 5, 1, 0, 0, 5}, customCB.counts)
 
 	pseudoSleep(customCB, time.Duration(1)*time.Second) // over Interval
 	assert.Nil(t, fail(customCB))
 	assert.Equal(t, StateClosed, customCB.State())
-	assert.Equal(t, Counts{1, 0, 1, 0, 1}, customCB.counts)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, customCB.counts)
 
 	// StateClosed to StateOpen
 	assert.Nil(t, succeed(customCB))
 	assert.Nil(t, fail(customCB)) // failure ratio: 2/3 >= 0.6
 	assert.Equal(t, StateOpen, customCB.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, customCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, customCB.counts)
 	assert.False(t, customCB.expiry.IsZero())
 	assert.Equal(t, StateChange{"cb", StateClosed, StateOpen}, stateChange)
 
@@ -250,16 +319,16 @@ func TestCustomCircuitBreaker(t *testing.T) {
 	assert.Nil(t, succeed(customCB))
 	assert.Nil(t, succeed(customCB))
 	assert.Equal(t, StateHalfOpen, customCB.State())
-	assert.Equal(t, Counts{2, 2, 0, 2, 0}, customCB.counts)
+	assert.Equal(t, Counts{2, 2, 0, 2, 0, 0, 0}, customCB.counts)
 
 	// StateHalfOpen to StateClosed
 	ch := succeedLater(customCB, time.Duration(100)*time.Millisecond) // 3 consecutive successes
 	time.Sleep(time.Duration(50) * time.Millisecond)
-	assert.Equal(t, Counts{3, 2, 0, 2, 0}, customCB.counts)
+	assert.Equal(t, Counts{3, 2, 0, 2, 0, 0, 0}, customCB.counts)
 	assert.Error(t, succeed(customCB)) // over MaxRequests
 	assert.Nil(t, <-ch)
 	assert.Equal(t, StateClosed, customCB.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, customCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, customCB.counts)
 	assert.False(t, customCB.expiry.IsZero())
 	assert.Equal(t, StateChange{"cb", StateHalfOpen, StateClosed}, stateChange)
 }
@@ -273,27 +342,27 @@ func TestTwoStepCircuitBreaker(t *testing.T) {
 	}
 
 	assert.Equal(t, StateClosed, tscb.State())
-	assert.Equal(t, Counts{5, 0, 5, 0, 5}, tscb.cb.counts)
+	assert.Equal(t, Counts{5, 0, 5, 0, 5, 0, 5}, tscb.cb.counts)
 
 	assert.Nil(t, succeed2Step(tscb))
 	assert.Equal(t, StateClosed, tscb.State())
-	assert.Equal(t, Counts{6, 1, 5, 1, 0}, tscb.cb.counts)
+	assert.Equal(t, Counts{6, 1, 5, 1, 0, 0, 5}, tscb.cb.counts)
 
 	assert.Nil(t, fail2Step(tscb))
 	assert.Equal(t, StateClosed, tscb.State())
-	assert.Equal(t, Counts{7, 1, 6, 0, 1}, tscb.cb.counts)
+	assert.Equal(t, Counts{7, 1, 6, 0, 1, 0, 6}, tscb.cb.counts)
 
 	// StateClosed to StateOpen
 	for i := 0; i < 5; i++ {
 		assert.Nil(t, fail2Step(tscb)) // 6 consecutive failures
 	}
 	assert.Equal(t, StateOpen, tscb.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, tscb.cb.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, tscb.cb.counts)
 	assert.False(t, tscb.cb.expiry.IsZero())
 
 	assert.Error(t, succeed2Step(tscb))
 	assert.Error(t, fail2Step(tscb))
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, tscb.cb.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, tscb.cb.counts)
 
 	pseudoSleep(tscb.cb, time.Duration(59)*time.Second)
 	assert.Equal(t, StateOpen, tscb.State())
@@ -306,7 +375,7 @@ func TestTwoStepCircuitBreaker(t *testing.T) {
 	// StateHalfOpen to StateOpen
 	assert.Nil(t, fail2Step(tscb))
 	assert.Equal(t, StateOpen, tscb.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, tscb.cb.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, tscb.cb.counts)
 	assert.False(t, tscb.cb.expiry.IsZero())
 
 	// StateOpen to StateHalfOpen
@@ -317,13 +386,13 @@ func TestTwoStepCircuitBreaker(t *testing.T) {
 	// StateHalfOpen to StateClosed
 	assert.Nil(t, succeed2Step(tscb))
 	assert.Equal(t, StateClosed, tscb.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, tscb.cb.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, tscb.cb.counts)
 	assert.True(t, tscb.cb.expiry.IsZero())
 }
 
 func TestPanicInRequest(t *testing.T) {
 	assert.Panics(t, func() { _ = causePanic(defaultCB) })
-	assert.Equal(t, Counts{1, 0, 1, 0, 1}, defaultCB.counts)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, defaultCB.counts)
 }
 
 func TestGeneration(t *testing.T) {
@@ -331,15 +400,288 @@ func TestGeneration(t *testing.T) {
 	assert.Nil(t, succeed(customCB))
 	ch := succeedLater(customCB, time.Duration(1500)*time.Millisecond)
 	time.Sleep(time.Duration(500) * time.Millisecond)
-	assert.Equal(t, Counts{2, 1, 0, 1, 0}, customCB.counts)
+	assert.Equal(t, Counts{2, 1, 0, 1, 0, 0, 0}, customCB.counts)
 
 	time.Sleep(time.Duration(500) * time.Millisecond) // over Interval
 	assert.Equal(t, StateClosed, customCB.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, customCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, customCB.counts)
 
 	// the request from the previous generation has no effect on customCB.counts
 	assert.Nil(t, <-ch)
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, customCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, customCB.counts)
+}
+
+func TestCountsRatio(t *testing.T) {
+	var counts Counts
+	assert.Equal(t, uint32(0), counts.EffectiveRequests())
+	assert.Equal(t, 0.0, counts.FailureRatio())
+	assert.Equal(t, 0.0, counts.SuccessRatio())
+
+	counts = Counts{Requests: 10, TotalSuccesses: 3, TotalFailures: 5, TotalExclusions: 2}
+	assert.Equal(t, uint32(8), counts.EffectiveRequests())
+	assert.Equal(t, 0.625, counts.FailureRatio())
+	assert.Equal(t, 0.375, counts.SuccessRatio())
+
+	counts = Counts{Requests: 2, TotalExclusions: 2}
+	assert.Equal(t, uint32(0), counts.EffectiveRequests())
+	assert.Equal(t, 0.0, counts.FailureRatio())
+
+	// the rolling window reports the same ratios from its totals
+	clock := newFakeClock()
+	var tripped Counts
+	cb := NewCircuitBreaker[bool](Settings{
+		Interval:     2 * time.Second,
+		BucketPeriod: time.Second,
+		IsExcluded:   isExcluded,
+		ReadyToTrip: func(counts Counts) bool {
+			tripped = counts
+			return counts.EffectiveRequests() >= 4 && counts.FailureRatio() >= 0.5
+		},
+		Clock: clock,
+	})
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, fail(cb))
+	clock.advance(time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, exclude(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, 0.75, tripped.FailureRatio())
+}
+
+func TestCountsSaturation(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{IsExcluded: isExcluded})
+	cb.counts = Counts{math.MaxUint32, math.MaxUint32, 0, math.MaxUint32, 0, 0, 0}
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, Counts{math.MaxUint32, math.MaxUint32, 0, math.MaxUint32, 0, 0, 0}, cb.Counts())
+
+	cb.counts = Counts{math.MaxUint32 - 1, 0, math.MaxUint32, 0, 1, math.MaxUint32, math.MaxUint32}
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, exclude(cb))
+	assert.Equal(t, Counts{math.MaxUint32, 0, math.MaxUint32, 0, 2, math.MaxUint32, math.MaxUint32 + 1}, cb.Counts()) // the weight doesn't saturate
+
+	counts := Counts{Requests: math.MaxUint32 - 1, TotalSuccesses: 1}
+	counts.add(Counts{Requests: 2, TotalSuccesses: 2})
+	assert.Equal(t, Counts{Requests: math.MaxUint32, TotalSuccesses: 3}, counts)
+}
+
+func TestFailureRateThreshold(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{MinimumRequests: 4, FailureRateThreshold: 0.5})
+
+	// a failure out of one request doesn't trip before MinimumRequests
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+
+	// exclusions don't count toward MinimumRequests
+	cb = NewCircuitBreaker[bool](Settings{MinimumRequests: 3, FailureRateThreshold: 0.5, IsExcluded: isExcluded})
+	assert.Nil(t, exclude(cb))
+	assert.Nil(t, exclude(cb))
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+
+	// MinimumRequests alone guards the consecutive failures of default ReadyToTrip
+	cb = NewCircuitBreaker[bool](Settings{MinimumRequests: 10})
+	for i := 0; i < 9; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+
+	// ReadyToTrip overrides them
+	cb = NewCircuitBreaker[bool](Settings{
+		MinimumRequests:      1,
+		FailureRateThreshold: 0.1,
+		ReadyToTrip:          func(counts Counts) bool { return false },
+	})
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, uint32(0), cb.Settings().MinimumRequests)
+	assert.Equal(t, 0.0, cb.Settings().FailureRateThreshold)
+}
+
+func TestWeight(t *testing.T) {
+	clock := newFakeClock()
+	errUnavailable, errTimeout := errors.New("unavailable"), errors.New("timeout")
+	var tripped Counts
+	cb := NewCircuitBreaker[bool](Settings{
+		Interval:     3 * time.Second,
+		BucketPeriod: time.Second,
+		Weight: func(err error) float64 {
+			switch err {
+			case errUnavailable:
+				return 2.5
+			case errTimeout:
+				return 1
+			default:
+				return -1
+			}
+		},
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.TotalFailureWeight >= 6
+		},
+		OnTrip: func(name string, lastErr error, counts Counts) {
+			tripped = counts
+		},
+		Clock: clock,
+	})
+	failWith := func(err error) {
+		_, _ = cb.Execute(func() (bool, error) { return false, err })
+	}
+
+	failWith(errUnavailable)
+	failWith(errTimeout)
+	failWith(errors.New("other")) // a negative weight counts as 0
+	assert.Equal(t, Counts{3, 0, 3, 0, 3, 0, 3.5}, cb.Counts())
+
+	// the weight of the dropped bucket is dropped, too
+	clock.advance(time.Second)
+	failWith(errTimeout)
+	clock.advance(2 * time.Second)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, cb.Counts())
+	assert.Equal(t, 1.0, cb.WindowInfo().Buckets[1].TotalFailureWeight)
+
+	failWith(errUnavailable)
+	assert.Equal(t, StateClosed, cb.State())
+	failWith(errUnavailable)
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, 6.0, tripped.TotalFailureWeight)
+}
+
+func TestIntervalCarryOver(t *testing.T) {
+	for _, carryOver := range []bool{false, true} {
+		clock := newFakeClock()
+		tscb := NewTwoStepCircuitBreaker[bool](Settings{
+			Interval:          10 * time.Second,
+			IntervalCarryOver: carryOver,
+			Clock:             clock,
+		})
+
+		done, err := tscb.Allow()
+		assert.NoError(t, err)
+		assert.Equal(t, Counts{1, 0, 0, 0, 0, 0, 0}, tscb.Counts())
+
+		clock.advance(11 * time.Second) // over Interval while the request is in flight
+		assert.Equal(t, StateClosed, tscb.State())
+		assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, tscb.Counts())
+
+		done(false)
+		if carryOver {
+			assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, tscb.Counts())
+		} else {
+			assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, tscb.Counts())
+		}
+
+		// the outcome of a request in flight across a change of the state is always discarded
+		clock.advance(11 * time.Second)
+		done, err = tscb.Allow()
+		assert.NoError(t, err)
+		for i := 0; i < 6; i++ {
+			assert.Nil(t, fail2Step(tscb))
+		}
+		assert.Equal(t, StateOpen, tscb.State())
+		clock.advance(61 * time.Second)
+		assert.Nil(t, succeed2Step(tscb))
+		assert.Equal(t, StateClosed, tscb.State())
+
+		done(false)
+		assert.Equal(t, StateClosed, tscb.State())
+		assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, tscb.Counts())
+	}
+}
+
+var errExcluded = errors.New("excluded")
+
+func exclude(cb *CircuitBreaker[bool]) error {
+	_, err := cb.Execute(func() (bool, error) { return false, errExcluded })
+	if err == errExcluded {
+		return nil
+	}
+	return err
+}
+
+func isExcluded(err error) bool {
+	return err == errExcluded
+}
+
+func TestIsExcluded(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{IsExcluded: isExcluded})
+
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, exclude(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, Counts{3, 0, 2, 0, 2, 1, 2}, cb.counts)
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, exclude(cb))
+	}
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{13, 0, 2, 0, 2, 11, 2}, cb.counts)
+
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestExclusionsConsumeHalfOpenSlots(t *testing.T) {
+	for _, consume := range []bool{false, true} {
+		clock := newFakeClock()
+		cb := NewCircuitBreaker[bool](Settings{
+			MaxRequests:                    2,
+			Timeout:                        10 * time.Second,
+			IsExcluded:                     isExcluded,
+			ExclusionsConsumeHalfOpenSlots: consume,
+			Clock:                          clock,
+		})
+
+		for i := 0; i < 6; i++ {
+			assert.Nil(t, fail(cb))
+		}
+		clock.advance(11 * time.Second)
+		assert.Equal(t, StateHalfOpen, cb.State())
+
+		assert.Nil(t, exclude(cb))
+		assert.Nil(t, exclude(cb))
+		assert.Equal(t, Counts{2, 0, 0, 0, 0, 2, 0}, cb.counts)
+
+		if consume {
+			assert.Equal(t, ErrTooManyRequests, succeed(cb))
+			assert.Equal(t, StateHalfOpen, cb.State())
+		} else {
+			assert.Nil(t, succeed(cb))
+			assert.Nil(t, succeed(cb))
+			assert.Equal(t, StateClosed, cb.State())
+		}
+	}
+}
+
+func TestExecuteWithClassifier(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{})
+	classify := func(result int, err error) Outcome {
+		return Outcome(result)
+	}
+
+	for _, o := range []Outcome{OutcomeFailure, OutcomeExcluded, OutcomeSuccess} {
+		result, err := cb.ExecuteWithClassifier(func() (int, error) { return int(o), nil }, classify)
+		assert.NoError(t, err)
+		assert.Equal(t, int(o), result)
+	}
+	assert.Equal(t, Counts{3, 1, 1, 1, 0, 1, 1}, cb.Counts())
+
+	assert.Panics(t, func() {
+		_, _ = cb.ExecuteWithClassifier(func() (int, error) { panic("oops") }, classify)
+	})
+	assert.Equal(t, Counts{4, 1, 2, 0, 1, 1, 2}, cb.Counts())
 }
 
 func TestCustomIsSuccessful(t *testing.T) {
@@ -352,7 +694,7 @@ func TestCustomIsSuccessful(t *testing.T) {
 		assert.Nil(t, fail(cb))
 	}
 	assert.Equal(t, StateClosed, cb.State())
-	assert.Equal(t, Counts{5, 5, 0, 5, 0}, cb.counts)
+	assert.Equal(t, Counts{5, 5, 0, 5, 0, 0, 0}, cb.counts)
 
 	cb.counts.clear()
 
@@ -366,27 +708,2016 @@ func TestCustomIsSuccessful(t *testing.T) {
 
 }
 
-func TestCircuitBreakerInParallel(t *testing.T) {
-	runtime.GOMAXPROCS(runtime.NumCPU())
+type declaredError struct {
+	outcome Outcome
+}
 
-	ch := make(chan error)
+func (e declaredError) Error() string {
+	return "declared " + e.outcome.String()
+}
 
-	const numReqs = 10000
-	routine := func() {
-		for i := 0; i < numReqs; i++ {
-			ch <- succeed(customCB)
-		}
+func (e declaredError) CircuitOutcome() Outcome {
+	return e.outcome
+}
+
+func TestCircuitOutcome(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{
+		IsSuccessful: func(err error) bool { return false },
+		IsExcluded:   func(err error) bool { return err != nil },
+		Classifiers: []func(err error) (Outcome, bool){
+			func(err error) (Outcome, bool) { return OutcomeFailure, err != nil },
+		},
+	})
+
+	for _, c := range []struct {
+		err    error
+		counts Counts
+	}{
+		{declaredError{OutcomeSuccess}, Counts{1, 1, 0, 1, 0, 0, 0}},
+		{declaredError{OutcomeFailure}, Counts{2, 1, 1, 0, 1, 0, 1}},
+		{declaredError{OutcomeExcluded}, Counts{3, 1, 1, 0, 1, 1, 1}},
+		// the declaration is found in the chain of wrapped errors
+		{fmt.Errorf("wrapped: %w", declaredError{OutcomeSuccess}), Counts{4, 2, 1, 1, 0, 1, 1}},
+		// the other errors are classified by Settings
+		{errors.New("plain"), Counts{5, 2, 2, 0, 1, 1, 2}},
+	} {
+		_, err := cb.Execute(func() (bool, error) { return false, c.err })
+		assert.Equal(t, c.err, err)
+		assert.Equal(t, c.counts, cb.Counts(), "%v", c.err)
 	}
 
-	const numRoutines = 10
-	for i := 0; i < numRoutines; i++ {
-		go routine()
+	onEvent, onDone, release, err := cb.StreamAllow()
+	assert.NoError(t, err)
+	onEvent(declaredError{OutcomeExcluded})
+	onDone(declaredError{OutcomeSuccess})
+	release()
+	assert.Equal(t, Counts{6, 3, 2, 1, 0, 1, 2}, cb.Counts())
+}
+
+func TestClassifiers(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	errNotFound := errors.New("not found")
+	var calls []string
+	cb := NewCircuitBreaker[bool](Settings{
+		Classifiers: []func(err error) (Outcome, bool){
+			func(err error) (Outcome, bool) {
+				calls = append(calls, "context")
+				if errors.Is(err, context.Canceled) {
+					return OutcomeExcluded, true
+				}
+				return OutcomeSuccess, false
+			},
+			func(err error) (Outcome, bool) {
+				calls = append(calls, "not found")
+				if errors.Is(err, errNotFound) {
+					return OutcomeSuccess, true
+				}
+				return OutcomeSuccess, false
+			},
+			func(err error) (Outcome, bool) {
+				calls = append(calls, "timeout")
+				if errors.Is(err, errTimeout) || errors.Is(err, context.Canceled) {
+					return OutcomeFailure, true
+				}
+				return OutcomeSuccess, false
+			},
+		},
+		IsExcluded: isExcluded,
+	})
+	run := func(err error) {
+		_, _ = cb.Execute(func() (bool, error) { return false, err })
 	}
 
-	total := uint32(numReqs * numRoutines)
-	for i := uint32(0); i < total; i++ {
-		err := <-ch
+	// the first classifier that handles the error wins
+	run(context.Canceled)
+	assert.Equal(t, []string{"context"}, calls)
+	assert.Equal(t, Counts{1, 0, 0, 0, 0, 1, 0}, cb.Counts())
+
+	calls = nil
+	run(errNotFound)
+	assert.Equal(t, []string{"context", "not found"}, calls)
+	assert.Equal(t, Counts{2, 1, 0, 1, 0, 1, 0}, cb.Counts())
+
+	run(errTimeout)
+	assert.Equal(t, Counts{3, 1, 1, 0, 1, 1, 1}, cb.Counts())
+
+	// the other classifiers of Settings are the fallback
+	calls = nil
+	run(errExcluded)
+	assert.Equal(t, []string{"context", "not found", "timeout"}, calls)
+	assert.Equal(t, Counts{4, 1, 1, 0, 1, 2, 1}, cb.Counts())
+	run(nil)
+	run(errors.New("other"))
+	assert.Equal(t, Counts{6, 2, 2, 0, 1, 2, 2}, cb.Counts())
+}
+
+func TestClassify(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	cb := NewCircuitBreaker[bool](Settings{
+		Classify: func(err error) Outcome {
+			switch {
+			case err == nil:
+				return OutcomeSuccess
+			case errors.Is(err, errExcluded):
+				return OutcomeExcluded
+			case errors.Is(err, errTimeout):
+				return OutcomeFailure
+			default:
+				return Outcome(-1)
+			}
+		},
+		// Classify supersedes the other classifiers of Settings
+		IsExcluded:   func(err error) bool { return true },
+		IsSuccessful: func(err error) bool { return true },
+	})
+	run := func(err error) {
+		_, _ = cb.Execute(func() (bool, error) { return false, err })
+	}
+
+	run(nil)
+	run(errExcluded)
+	run(errTimeout)
+	assert.Equal(t, Counts{3, 1, 1, 0, 1, 1, 1}, cb.Counts())
+
+	// an unknown Outcome is counted as a failure
+	run(errors.New("other"))
+	assert.Equal(t, Counts{4, 1, 2, 0, 2, 1, 2}, cb.Counts())
+
+	// CircuitOutcome still takes precedence
+	run(declaredError{OutcomeSuccess})
+	assert.Equal(t, Counts{5, 2, 2, 1, 0, 1, 2}, cb.Counts())
+}
+
+func TestResultMatters(t *testing.T) {
+	partial := []byte("partial")
+	errTruncated := errors.New("truncated")
+	isSuccessfulResult := func(result any, err error) bool {
+		return len(result.([]byte)) > 0
+	}
+
+	cb := NewCircuitBreaker[[]byte](Settings{IsSuccessfulResult: isSuccessfulResult})
+
+	// the result is ignored when the request returns an error
+	result, err := cb.Execute(func() ([]byte, error) { return partial, errTruncated })
+	assert.Equal(t, partial, result)
+	assert.Equal(t, errTruncated, err)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, cb.counts)
+
+	// the result is classified when the request returns no error
+	result, err = cb.Execute(func() ([]byte, error) { return nil, nil })
+	assert.Nil(t, result)
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{2, 0, 2, 0, 2, 0, 2}, cb.counts)
+
+	_, err = cb.Execute(func() ([]byte, error) { return partial, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{3, 1, 2, 1, 0, 0, 2}, cb.counts)
+
+	cb = NewCircuitBreaker[[]byte](Settings{IsSuccessfulResult: isSuccessfulResult, ResultMatters: true})
+
+	// the result is classified even when the request returns an error
+	result, err = cb.Execute(func() ([]byte, error) { return partial, errTruncated })
+	assert.Equal(t, partial, result)
+	assert.Equal(t, errTruncated, err)
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0, 0}, cb.counts)
+
+	_, err = cb.Execute(func() ([]byte, error) { return nil, errTruncated })
+	assert.Equal(t, errTruncated, err)
+	assert.Equal(t, Counts{2, 1, 1, 0, 1, 0, 1}, cb.counts)
+
+	// ResultMatters has no effect without IsSuccessfulResult
+	cb = NewCircuitBreaker[[]byte](Settings{ResultMatters: true})
+	_, err = cb.Execute(func() ([]byte, error) { return partial, errTruncated })
+	assert.Equal(t, errTruncated, err)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, cb.counts)
+}
+
+func TestIsExcludedResult(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{
+		IsExcluded: isExcluded,
+		IsExcludedResult: func(result any, err error) bool {
+			return result.(int) == 429
+		},
+		IsSuccessfulResult: func(result any, err error) bool {
+			return result.(int) < 500
+		},
+	})
+	run := func(status int, err error) {
+		_, _ = cb.Execute(func() (int, error) { return status, err })
+	}
+
+	run(429, nil)
+	assert.Equal(t, Counts{1, 0, 0, 0, 0, 1, 0}, cb.Counts())
+	run(503, nil)
+	assert.Equal(t, Counts{2, 0, 1, 0, 1, 1, 1}, cb.Counts())
+	run(200, nil)
+	assert.Equal(t, Counts{3, 1, 1, 1, 0, 1, 1}, cb.Counts())
+
+	// the result is checked even when the request returns an error
+	run(429, errors.New("throttled"))
+	assert.Equal(t, Counts{4, 1, 1, 1, 0, 2, 1}, cb.Counts())
+	run(0, errExcluded)
+	assert.Equal(t, Counts{5, 1, 1, 1, 0, 3, 1}, cb.Counts())
+	run(0, errors.New("fail"))
+	assert.Equal(t, Counts{6, 1, 2, 0, 1, 3, 2}, cb.Counts())
+}
+
+func TestTwoStepAllowOutcome(t *testing.T) {
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{})
+
+	for _, o := range []Outcome{OutcomeSuccess, OutcomeExcluded, OutcomeFailure} {
+		done, err := tscb.AllowOutcome()
+		assert.Nil(t, err)
+		done(o)
+	}
+	assert.Equal(t, Counts{3, 1, 1, 0, 1, 1, 1}, tscb.Counts())
+
+	// the error-based callback keeps working
+	assert.Nil(t, succeed2Step(tscb))
+	assert.Equal(t, Counts{4, 2, 1, 1, 0, 1, 1}, tscb.Counts())
+
+	for i := 0; i < 6; i++ {
+		done, err := tscb.AllowOutcome()
 		assert.Nil(t, err)
+		done(OutcomeFailure)
+	}
+	assert.Equal(t, StateOpen, tscb.State())
+
+	done, err := tscb.AllowOutcome()
+	assert.Nil(t, done)
+	assert.Equal(t, ErrOpenState, err)
+}
+
+func TestTwoStepResultMatters(t *testing.T) {
+	partial := []byte("partial")
+	errTruncated := errors.New("truncated")
+	isSuccessfulResult := func(result any, err error) bool {
+		return len(result.([]byte)) > 0
+	}
+
+	tscb := NewTwoStepCircuitBreaker[[]byte](Settings{IsSuccessfulResult: isSuccessfulResult})
+
+	done, err := tscb.AllowResult()
+	assert.NoError(t, err)
+	done(partial, errTruncated)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, tscb.Counts())
+
+	done, err = tscb.AllowResult()
+	assert.NoError(t, err)
+	done(partial, nil)
+	assert.Equal(t, Counts{2, 1, 1, 1, 0, 0, 1}, tscb.Counts())
+
+	tscb = NewTwoStepCircuitBreaker[[]byte](Settings{IsSuccessfulResult: isSuccessfulResult, ResultMatters: true})
+
+	done, err = tscb.AllowResult()
+	assert.NoError(t, err)
+	done(partial, errTruncated)
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0, 0}, tscb.Counts())
+
+	done, err = tscb.AllowResult()
+	assert.NoError(t, err)
+	done(nil, errTruncated)
+	assert.Equal(t, Counts{2, 1, 1, 0, 1, 0, 1}, tscb.Counts())
+}
+
+func TestClock(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{Interval: 10 * time.Second, Timeout: 30 * time.Second, Clock: clock})
+	assert.Equal(t, clock.Now().Add(10*time.Second), cb.expiry)
+
+	assert.Nil(t, fail(cb))
+	clock.advance(9 * time.Second)
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, cb.counts)
+
+	clock.advance(2 * time.Second) // over Interval
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, cb.counts)
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	clock.advance(29 * time.Second)
+	assert.Equal(t, StateOpen, cb.State())
+
+	clock.advance(2 * time.Second) // over Timeout
+	assert.Equal(t, StateHalfOpen, cb.State())
+}
+
+func TestCurrentTimeout(t *testing.T) {
+	assert.Equal(t, defaultTimeout, NewCircuitBreaker[bool](Settings{}).CurrentTimeout())
+
+	cb := NewCircuitBreaker[bool](Settings{Timeout: 5 * time.Second})
+	assert.Equal(t, 5*time.Second, cb.CurrentTimeout())
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, 5*time.Second, cb.CurrentTimeout())
+
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{Timeout: 7 * time.Second})
+	assert.Equal(t, 7*time.Second, tscb.CurrentTimeout())
+}
+
+func TestSaturationBackoff(t *testing.T) {
+	clock := newFakeClock()
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{
+		Timeout:              10 * time.Second,
+		SaturationBackoff:    2,
+		MaxSaturationTimeout: 30 * time.Second,
+		Clock:                clock,
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail2Step(tscb))
+	}
+	assert.Equal(t, StateOpen, tscb.State())
+	assert.Equal(t, 10*time.Second, tscb.CurrentTimeout())
+
+	// the half-open state fails without saturation
+	clock.advance(11 * time.Second)
+	assert.Nil(t, fail2Step(tscb))
+	assert.Equal(t, StateOpen, tscb.State())
+	assert.Equal(t, 10*time.Second, tscb.CurrentTimeout())
+
+	saturateAndFail := func() {
+		clock.advance(tscb.CurrentTimeout() + time.Second)
+		done, err := tscb.Allow()
+		assert.NoError(t, err)
+		assert.Equal(t, ErrTooManyRequests, succeed2Step(tscb))
+		done(false)
+		assert.Equal(t, StateOpen, tscb.State())
+	}
+
+	saturateAndFail()
+	assert.Equal(t, 20*time.Second, tscb.CurrentTimeout())
+	clock.advance(19 * time.Second)
+	assert.Equal(t, StateOpen, tscb.State())
+	clock.advance(2 * time.Second)
+	assert.Equal(t, StateHalfOpen, tscb.State())
+	assert.Nil(t, fail2Step(tscb))
+
+	saturateAndFail()
+	assert.Equal(t, 30*time.Second, tscb.CurrentTimeout()) // capped by MaxSaturationTimeout
+
+	// the period is reset when the breaker becomes closed
+	clock.advance(31 * time.Second)
+	assert.Nil(t, succeed2Step(tscb))
+	assert.Equal(t, StateClosed, tscb.State())
+	assert.Equal(t, 10*time.Second, tscb.CurrentTimeout())
+}
+
+func TestGenerateTimeout(t *testing.T) {
+	clock := newFakeClock()
+	var prevTimeouts []time.Duration
+	var failures []uint32
+	cb := NewCircuitBreaker[bool](Settings{
+		Timeout:           time.Minute,
+		SaturationBackoff: 3,
+		GenerateTimeout: func(prevTimeout time.Duration, counts Counts) time.Duration {
+			prevTimeouts = append(prevTimeouts, prevTimeout)
+			failures = append(failures, counts.ConsecutiveFailures)
+			return 2 * prevTimeout
+		},
+		Clock: clock,
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, 2*time.Minute, cb.CurrentTimeout())
+
+	// the half-open state trips again with the grown period
+	clock.advance(2*time.Minute + time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, 4*time.Minute, cb.CurrentTimeout())
+
+	clock.advance(3 * time.Minute)
+	assert.Equal(t, StateOpen, cb.State())
+	clock.advance(time.Minute + time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, 8*time.Minute, cb.CurrentTimeout())
+
+	// the period is reset when the breaker becomes closed
+	clock.advance(8*time.Minute + time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, time.Minute, cb.CurrentTimeout())
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, 2*time.Minute, cb.CurrentTimeout())
+	assert.Equal(t, []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, time.Minute}, prevTimeouts)
+	assert.Equal(t, []uint32{6, 0, 0, 6}, failures) // a failed probe trips before it is counted
+
+	// a non-positive period falls back to Timeout
+	cb = NewCircuitBreaker[bool](Settings{
+		Timeout:         time.Minute,
+		GenerateTimeout: func(time.Duration, Counts) time.Duration { return 0 },
+	})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, time.Minute, cb.CurrentTimeout())
+}
+
+func TestOnRecover(t *testing.T) {
+	clock := newFakeClock()
+
+	var recovered []time.Duration
+	var cb *CircuitBreaker[bool]
+	cb = NewCircuitBreaker[bool](Settings{
+		Name:    "cb",
+		Timeout: 10 * time.Second,
+		OnRecover: func(name string, downtime time.Duration) {
+			assert.Equal(t, "cb", name)
+			assert.Equal(t, StateClosed, cb.State()) // called outside the lock
+			recovered = append(recovered, downtime)
+		},
+		Clock: clock,
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	// HalfOpen to Open doesn't trigger OnRecover
+	clock.advance(11 * time.Second)
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Empty(t, recovered)
+
+	clock.advance(11 * time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, []time.Duration{22 * time.Second}, recovered)
+}
+
+func TestManualRecovery(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{
+		Timeout:        10 * time.Second,
+		ManualRecovery: true,
+		Clock:          clock,
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	// the open state outlasts the timeout
+	clock.advance(time.Hour)
+	assert.Equal(t, StateOpen, cb.PeekState())
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, ErrOpenState, succeed(cb))
+
+	cb.AllowProbe()
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+
+	// Reset recovers the CircuitBreaker, too
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	clock.advance(time.Hour)
+	cb.Reset()
+	assert.Equal(t, StateClosed, cb.State())
+
+	// AllowProbe has no effect on a closed CircuitBreaker
+	cb.AllowProbe()
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func TestMaxProbeAttempts(t *testing.T) {
+	clock := newFakeClock()
+	exhausted := 0
+	cb := NewCircuitBreaker[bool](Settings{
+		Name:             "cb",
+		Timeout:          10 * time.Second,
+		MaxProbeAttempts: 2,
+		OnProbeBudgetExhausted: func(name string) {
+			assert.Equal(t, "cb", name)
+			exhausted++
+		},
+		Clock: clock,
+	})
+
+	trip := func() {
+		for i := 0; i < 6; i++ {
+			assert.Nil(t, fail(cb))
+		}
+		assert.Equal(t, StateOpen, cb.State())
+	}
+	probe := func(req func(*CircuitBreaker[bool]) error) {
+		clock.advance(11 * time.Second)
+		assert.Equal(t, StateHalfOpen, cb.State())
+		assert.Nil(t, req(cb))
 	}
-	assert.Equal(t, Counts{total, total, 0, total, 0}, customCB.counts)
+
+	// a recovery counts the attempts anew
+	trip()
+	probe(fail)
+	probe(succeed)
+	assert.Equal(t, StateClosed, cb.State())
+
+	trip()
+	probe(fail)
+	assert.Equal(t, 0, exhausted)
+	probe(fail)
+	assert.Equal(t, 1, exhausted)
+
+	// the CircuitBreaker stops probing by itself
+	clock.advance(time.Hour)
+	assert.Equal(t, StateOpen, cb.PeekState())
+	assert.Equal(t, StateOpen, cb.State())
+
+	// a failed probe allowed by AllowProbe keeps the CircuitBreaker open
+	cb.AllowProbe()
+	assert.Nil(t, fail(cb))
+	clock.advance(time.Hour)
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, 1, exhausted)
+
+	cb.AllowProbe()
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+
+	// the budget is restored after the recovery
+	trip()
+	probe(fail)
+	clock.advance(11 * time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	// Reset restores the budget, too
+	assert.Nil(t, fail(cb))
+	cb.Reset()
+	trip()
+	clock.advance(11 * time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Equal(t, 2, exhausted)
+}
+
+func TestHalfOpenSuccessLatency(t *testing.T) {
+	clock := newFakeClock()
+	var tripErrs []error
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxRequests:            2,
+		Timeout:                10 * time.Second,
+		HalfOpenSuccessLatency: time.Second,
+		OnTrip: func(name string, lastErr error, counts Counts) {
+			tripErrs = append(tripErrs, lastErr)
+		},
+		Clock: clock,
+	})
+	request := func(d time.Duration) error {
+		_, err := cb.Execute(func() (bool, error) {
+			clock.advance(d)
+			return true, nil
+		})
+		return err
+	}
+
+	// a slow success counts in the closed state
+	assert.NoError(t, request(time.Minute))
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0, 0}, cb.Counts())
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	clock.advance(11 * time.Second)
+	assert.NoError(t, request(time.Second))
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0, 0}, cb.Counts())
+
+	// a slow success in the half-open state reopens the CircuitBreaker
+	assert.NoError(t, request(time.Second+time.Millisecond))
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, ErrSlowProbe, tripErrs[1])
+
+	// the latency of TwoStepCircuitBreaker is measured from Allow
+	clock.advance(11 * time.Second)
+	tscb := &TwoStepCircuitBreaker[bool]{cb: cb}
+	done, err := tscb.Allow()
+	assert.NoError(t, err)
+	assert.NoError(t, request(0))
+	clock.advance(500 * time.Millisecond)
+	done(true)
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	clock := newFakeClock()
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{
+		MaxRequests:           3,
+		MaxConcurrentRequests: 2,
+		Timeout:               10 * time.Second,
+		Clock:                 clock,
+	})
+
+	done1, err := tscb.Allow()
+	assert.NoError(t, err)
+	done2, err := tscb.Allow()
+	assert.NoError(t, err)
+	_, err = tscb.Allow()
+	assert.Equal(t, ErrTooManyConcurrentRequests, err)
+	assert.Equal(t, Counts{2, 0, 0, 0, 0, 0, 0}, tscb.Counts())
+
+	done1(true)
+	done3, err := tscb.Allow()
+	assert.NoError(t, err)
+	done2(true)
+	done3(true)
+
+	// a panic releases the slot
+	cb := tscb.cb
+	for i := 0; i < 2; i++ {
+		assert.Panics(t, func() { cb.Execute(func() (bool, error) { panic("oops") }) })
+	}
+	assert.Nil(t, succeed(cb))
+
+	// the open state rejects the requests with ErrOpenState
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	done1, err = tscb.Allow()
+	assert.Equal(t, ErrOpenState, err)
+
+	// both limits apply in the half-open state
+	clock.advance(11 * time.Second)
+	done1, err = tscb.Allow()
+	assert.NoError(t, err)
+	done2, err = tscb.Allow()
+	assert.NoError(t, err)
+	_, err = tscb.Allow()
+	assert.Equal(t, ErrTooManyConcurrentRequests, err)
+	done1(true)
+	done3, err = tscb.Allow()
+	assert.NoError(t, err)
+	done2(true)
+	_, err = tscb.Allow()
+	assert.Equal(t, ErrTooManyRequests, err)
+	done3(true)
+	assert.Equal(t, StateClosed, tscb.State())
+}
+
+func TestHalfOpenProbeRatio(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxRequests:        3,
+		HalfOpenProbeRatio: 0.25,
+		SaturationBackoff:  2,
+		Timeout:            10 * time.Second,
+		Clock:              clock,
+	})
+	trip := func() {
+		for i := 0; i < 6; i++ {
+			assert.Nil(t, fail(cb))
+		}
+		clock.advance(cb.CurrentTimeout() + time.Second)
+		assert.Equal(t, StateHalfOpen, cb.State())
+	}
+
+	// every fourth request passes through regardless of MaxRequests
+	trip()
+	var admitted []int
+	for i := 1; i <= 9; i++ {
+		if err := succeed(cb); err == nil {
+			admitted = append(admitted, i)
+		} else {
+			assert.Equal(t, ErrTooManyRequests, err)
+		}
+	}
+	assert.Equal(t, []int{1, 5, 9}, admitted)
+	assert.Equal(t, StateClosed, cb.State())
+
+	// a failure opens the CircuitBreaker again, and the rejections are not saturation
+	trip()
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, ErrTooManyRequests, succeed(cb))
+	assert.Equal(t, ErrTooManyRequests, fail(cb))
+	assert.Equal(t, ErrTooManyRequests, fail(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, 10*time.Second, cb.CurrentTimeout())
+
+	// the counter starts anew in each half-open state
+	clock.advance(11 * time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, ErrTooManyRequests, succeed(cb))
+}
+
+func TestHalfOpenSuccessThreshold(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{MaxRequests: 10, HalfOpenSuccessThreshold: 0.7, Clock: clock})
+	trip := func() {
+		for i := 0; i < 6; i++ {
+			assert.Nil(t, fail(cb))
+		}
+		assert.Equal(t, StateOpen, cb.State())
+		clock.advance(defaultTimeout + time.Second)
+	}
+
+	// sporadic failures are tolerated while 7 successes out of 10 are still possible
+	trip()
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, fail(cb))
+		assert.Nil(t, succeed(cb))
+	}
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Equal(t, Counts{6, 3, 3, 1, 0, 0, 3}, cb.Counts())
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, succeed(cb))
+	}
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+
+	// the failure that makes the ratio unreachable opens the CircuitBreaker
+	trip()
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+
+	// the strict behavior is the default
+	cb = NewCircuitBreaker[bool](Settings{MaxRequests: 10, Clock: clock})
+	trip()
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestHalfOpenProbeInterval(t *testing.T) {
+	clock := newFakeClock()
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{
+		MaxRequests:           3,
+		HalfOpenProbeInterval: time.Second,
+		Clock:                 clock,
+	})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail2Step(tscb))
+	}
+	clock.advance(defaultTimeout + time.Second)
+
+	// the first probe is allowed at once and the next ones one second apart
+	var probes []func(bool)
+	done, err := tscb.Allow()
+	assert.NoError(t, err)
+	probes = append(probes, done)
+	_, err = tscb.Allow()
+	assert.Equal(t, ErrTooManyRequests, err)
+	clock.advance(500 * time.Millisecond)
+	_, err = tscb.Allow()
+	assert.Equal(t, ErrTooManyRequests, err)
+	for i := 0; i < 2; i++ {
+		clock.advance(time.Second)
+		done, err = tscb.Allow()
+		assert.NoError(t, err)
+		probes = append(probes, done)
+	}
+	assert.Equal(t, StateHalfOpen, tscb.State())
+	assert.False(t, tscb.cb.saturated)
+
+	for _, done := range probes {
+		done(true)
+	}
+	assert.Equal(t, StateClosed, tscb.State())
+
+	// the interval starts anew in the next half-open state
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail2Step(tscb))
+	}
+	clock.advance(defaultTimeout + time.Second)
+	assert.Nil(t, fail2Step(tscb))
+	assert.Equal(t, StateOpen, tscb.State())
+	clock.advance(defaultTimeout + time.Second)
+	assert.Nil(t, succeed2Step(tscb))
+	assert.Equal(t, ErrTooManyRequests, succeed2Step(tscb))
+}
+
+func TestUnlimitedHalfOpenRequests(t *testing.T) {
+	clock := newFakeClock()
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{
+		MaxRequests:               3,
+		UnlimitedHalfOpenRequests: true,
+		HalfOpenProbeInterval:     time.Second,
+		Clock:                     clock,
+	})
+	trip := func() {
+		for i := 0; i < 6; i++ {
+			assert.Nil(t, fail2Step(tscb))
+		}
+		assert.Equal(t, StateOpen, tscb.State())
+		clock.advance(defaultTimeout + time.Second)
+	}
+
+	// all the requests pass through and MaxRequests successes close the CircuitBreaker
+	trip()
+	var probes []func(bool)
+	for i := 0; i < 10; i++ {
+		done, err := tscb.Allow()
+		assert.NoError(t, err)
+		probes = append(probes, done)
+	}
+	batch, err := tscb.AllowN(5)
+	assert.NoError(t, err)
+	probes[0](true)
+	probes[1](true)
+	assert.Equal(t, StateHalfOpen, tscb.State())
+	probes[2](true)
+	assert.Equal(t, StateClosed, tscb.State())
+	for _, done := range probes[3:] {
+		done(true)
+	}
+	batch(make([]error, 5))
+	assert.False(t, tscb.cb.saturated)
+
+	// the first failure opens the CircuitBreaker again
+	trip()
+	assert.Nil(t, succeed2Step(tscb))
+	assert.Nil(t, succeed2Step(tscb))
+	assert.Nil(t, fail2Step(tscb))
+	assert.Equal(t, StateOpen, tscb.State())
+
+	v := tscb.Settings()
+	assert.True(t, v.UnlimitedHalfOpenRequests)
+	assert.Equal(t, time.Duration(0), v.HalfOpenProbeInterval)
+}
+
+func TestRampUpPeriod(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{
+		Timeout:            10 * time.Second,
+		RampUpPeriod:       10 * time.Second,
+		RampUpInitialRatio: 0.25,
+		Clock:              clock,
+	})
+	admitted := func(n int) int {
+		count := 0
+		for i := 0; i < n; i++ {
+			if err := succeed(cb); err == nil {
+				count++
+			} else {
+				assert.Equal(t, ErrRampUpLimited, err)
+			}
+		}
+		return count
+	}
+
+	// no ramp-up before the first recovery
+	assert.Equal(t, 8, admitted(8))
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	clock.advance(11 * time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+
+	// the rejected requests are not counted
+	assert.Equal(t, 3, admitted(8))
+	assert.Equal(t, Counts{3, 3, 0, 3, 0, 0, 0}, cb.Counts())
+
+	clock.advance(5 * time.Second)
+	assert.Equal(t, 5, admitted(8))
+
+	clock.advance(5 * time.Second)
+	assert.Equal(t, 8, admitted(8))
+
+	// a trip during the ramp-up ends it
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	clock.advance(11 * time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, 1, admitted(3))
+	for i := 0; i < 6; {
+		if err := fail(cb); err == nil {
+			i++
+		}
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	cb.Reset()
+	assert.Equal(t, 8, admitted(8))
+}
+
+func TestAllowProbe(t *testing.T) {
+	clock := newFakeClock()
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{Timeout: 10 * time.Second, Clock: clock})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail2Step(tscb))
+	}
+	assert.Equal(t, StateOpen, tscb.State())
+
+	// the open state ends early
+	tscb.AllowProbe()
+	assert.Equal(t, StateHalfOpen, tscb.State())
+	assert.Nil(t, succeed2Step(tscb))
+	assert.Equal(t, StateClosed, tscb.State())
+}
+
+func TestOnTrip(t *testing.T) {
+	clock := newFakeClock()
+
+	type trip struct {
+		err    error
+		counts Counts
+	}
+	var trips []trip
+	var cb *CircuitBreaker[bool]
+	cb = NewCircuitBreaker[bool](Settings{
+		Name:    "cb",
+		Timeout: 10 * time.Second,
+		OnTrip: func(name string, lastErr error, counts Counts) {
+			assert.Equal(t, "cb", name)
+			assert.Equal(t, StateOpen, cb.State()) // called outside the lock
+			trips = append(trips, trip{lastErr, counts})
+		},
+		Clock: clock,
+	})
+
+	errs := make([]error, 6)
+	for i := range errs {
+		errs[i] = fmt.Errorf("fail %d", i)
+		_, err := cb.Execute(func() (bool, error) { return false, errs[i] })
+		assert.Equal(t, errs[i], err)
+	}
+	assert.Equal(t, []trip{{errs[5], Counts{6, 0, 6, 0, 6, 0, 6}}}, trips)
+
+	// a failed probe trips the CircuitBreaker again
+	clock.advance(11 * time.Second)
+	errProbe := errors.New("probe")
+	_, err := cb.Execute(func() (bool, error) { return false, errProbe })
+	assert.Equal(t, errProbe, err)
+	assert.Equal(t, trip{errProbe, Counts{1, 0, 0, 0, 0, 0, 0}}, trips[1]) // the failure trips before it is counted
+
+	// the recovery doesn't call OnTrip
+	clock.advance(11 * time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, 2, len(trips))
+
+	// a panic is reported as an error
+	assert.Panics(t, func() {
+		cb.Execute(func() (bool, error) { panic("oops") })
+	})
+	for i := 0; i < 5; i++ {
+		assert.Panics(t, func() {
+			cb.Execute(func() (bool, error) { panic("oops") })
+		})
+	}
+	assert.EqualError(t, trips[2].err, "panic: oops")
+}
+
+func TestOnProbe(t *testing.T) {
+	clock := newFakeClock()
+
+	var events []string
+	var cb *CircuitBreaker[bool]
+	cb = NewCircuitBreaker[bool](Settings{
+		Name:    "cb",
+		Timeout: 10 * time.Second,
+		OnProbeStart: func(name string) {
+			assert.Equal(t, "cb", name)
+			assert.Equal(t, StateHalfOpen, cb.PeekState()) // called outside the lock
+			events = append(events, "start")
+		},
+		OnProbeEnd: func(name string, closed bool) {
+			assert.Equal(t, "cb", name)
+			events = append(events, fmt.Sprintf("end closed=%v", closed))
+		},
+		Clock: clock,
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Empty(t, events)
+
+	// the probe fails
+	clock.advance(11 * time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, []string{"start", "end closed=false"}, events)
+
+	// the probe succeeds
+	clock.advance(11 * time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, []string{"start", "end closed=false", "start", "end closed=true"}, events)
+
+	// Reset from the half-open state ends the probes, too
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	clock.advance(11 * time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	cb.Reset()
+	assert.Equal(t, "end closed=true", events[len(events)-1])
+
+	// nil callbacks are fine
+	cb = NewCircuitBreaker[bool](Settings{Timeout: 10 * time.Second, Clock: clock})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	clock.advance(11 * time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func TestOnGenerationEnd(t *testing.T) {
+	for _, bucketPeriod := range []time.Duration{0, time.Second} {
+		clock := newFakeClock()
+		var total Counts
+		var generations int
+		cb := NewCircuitBreaker[bool](Settings{
+			Interval:     5 * time.Second,
+			Timeout:      10 * time.Second,
+			BucketPeriod: bucketPeriod,
+			ReadyToTrip: func(counts Counts) bool {
+				return counts.ConsecutiveFailures >= 3
+			},
+			IsExcluded: isExcluded,
+			OnGenerationEnd: func(name string, counts Counts) {
+				total.add(counts)
+				generations++
+			},
+			Clock: clock,
+		})
+
+		assert.Nil(t, succeed(cb))
+		assert.Nil(t, exclude(cb))
+		clock.advance(6 * time.Second)
+		assert.Nil(t, succeed(cb))
+		for i := 0; i < 3; i++ {
+			assert.Nil(t, fail(cb))
+		}
+		assert.Equal(t, StateOpen, cb.State())
+
+		clock.advance(11 * time.Second)
+		assert.Nil(t, succeed(cb))
+		assert.Equal(t, StateClosed, cb.State())
+		assert.Nil(t, fail(cb))
+
+		total.add(cb.Counts())
+		assert.Equal(t, Counts{8, 3, 4, 0, 0, 1, 4}, total)
+		if bucketPeriod == 0 {
+			assert.Equal(t, 4, generations)
+		} else {
+			assert.Equal(t, 3, generations)
+		}
+	}
+}
+
+func TestMinClosedDuration(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{
+		Timeout:           10 * time.Second,
+		MinClosedDuration: 30 * time.Second,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 1
+		},
+		Clock: clock,
+	})
+
+	// MinClosedDuration doesn't apply before the first recovery
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+
+	clock.advance(11 * time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+
+	// failures right after the recovery are counted but don't trip the breaker
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{3, 0, 3, 0, 3, 0, 3}, cb.counts)
+
+	clock.advance(29 * time.Second)
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateClosed, cb.State())
+
+	clock.advance(time.Second)
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestIgnoreFirstN(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{
+		Interval:     10 * time.Second,
+		IgnoreFirstN: 3,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.TotalFailures >= 1
+		},
+		Clock: clock,
+	})
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{3, 0, 3, 0, 3, 0, 3}, cb.counts)
+
+	// each generation ignores its first requests again
+	clock.advance(11 * time.Second)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{3, 0, 3, 0, 3, 0, 3}, cb.counts)
+
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestMaxAccumulatedRequests(t *testing.T) {
+	for _, c := range []struct {
+		max   uint32
+		state State
+	}{
+		{0, StateClosed},
+		{100, StateOpen},
+	} {
+		cb := NewCircuitBreaker[bool](Settings{
+			MaxAccumulatedRequests: c.max,
+			ReadyToTrip: func(counts Counts) bool {
+				return counts.Requests >= 10 && counts.TotalFailures*2 >= counts.Requests
+			},
+		})
+
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, succeed(cb))
+		}
+		assert.Equal(t, Counts{100, 100, 0, 100, 0, 0, 0}, cb.Counts())
+
+		// a late burst of failures is diluted by the accumulated successes without the cap
+		for i := 0; i < 10; i++ {
+			assert.Nil(t, fail(cb))
+		}
+		assert.Equal(t, c.state, cb.State(), "max %d", c.max)
+	}
+}
+
+func TestOpenedChan(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{})
+	ch := cb.OpenedChan()
+	assert.Equal(t, ch, cb.OpenedChan())
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	select {
+	case <-ch:
+		assert.Fail(t, "closed before the trip")
+	default:
+	}
+
+	assert.Nil(t, fail(cb))
+	select {
+	case <-ch:
+	default:
+		assert.Fail(t, "not closed on the trip")
+	}
+
+	// the channel is re-armed for the next transition to the open state
+	next := cb.OpenedChan()
+	assert.NotEqual(t, ch, next)
+	pseudoSleep(cb, defaultTimeout+time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	select {
+	case <-next:
+		assert.Fail(t, "closed without a trip")
+	default:
+	}
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	<-next
+}
+
+func TestStateAge(t *testing.T) {
+	clock := newFakeClock()
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{Interval: time.Second, Timeout: 10 * time.Second, Clock: clock})
+	assert.Equal(t, time.Duration(0), tscb.StateAge())
+
+	// the intervals of the closed state don't change the state
+	clock.advance(5 * time.Second)
+	assert.Nil(t, succeed2Step(tscb))
+	assert.Equal(t, 5*time.Second, tscb.StateAge())
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail2Step(tscb))
+	}
+	assert.Equal(t, StateOpen, tscb.State())
+	assert.Equal(t, time.Duration(0), tscb.StateAge())
+
+	clock.advance(4 * time.Second)
+	assert.Equal(t, 4*time.Second, tscb.StateAge())
+
+	// the age of the half-open state starts at the transition
+	clock.advance(7 * time.Second)
+	assert.Equal(t, StateHalfOpen, tscb.State())
+	assert.Equal(t, time.Duration(0), tscb.StateAge())
+}
+
+func TestExpiresIn(t *testing.T) {
+	clock := newFakeClock()
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{Interval: 5 * time.Second, Timeout: 10 * time.Second, Clock: clock})
+	assert.Equal(t, 5*time.Second, tscb.ExpiresIn())
+
+	clock.advance(2 * time.Second)
+	assert.Equal(t, 3*time.Second, tscb.ExpiresIn())
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail2Step(tscb))
+	}
+	assert.Equal(t, 10*time.Second, tscb.ExpiresIn())
+
+	clock.advance(4 * time.Second)
+	assert.Equal(t, 6*time.Second, tscb.ExpiresIn())
+
+	// the half-open state has no expiry
+	clock.advance(7 * time.Second)
+	assert.Equal(t, time.Duration(0), tscb.ExpiresIn())
+	assert.Equal(t, StateHalfOpen, tscb.State())
+
+	// neither have the forced states nor the open state with ManualRecovery
+	tscb.ForceOpen()
+	assert.Equal(t, time.Duration(0), tscb.ExpiresIn())
+
+	cb := NewCircuitBreaker[bool](Settings{ManualRecovery: true, Clock: clock})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, time.Duration(0), cb.ExpiresIn())
+}
+
+func TestWindowInfo(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+	cb := NewCircuitBreaker[bool](Settings{
+		Interval:     3 * time.Second,
+		BucketPeriod: time.Second,
+		IsExcluded:   isExcluded,
+		Clock:        clock,
+	})
+	assert.Equal(t, WindowInfo{
+		BucketPeriod: time.Second,
+		Start:        start,
+		Buckets:      []Counts{{}, {}, {}},
+	}, cb.WindowInfo())
+
+	assert.Nil(t, succeed(cb))
+	clock.advance(time.Second)
+	assert.Nil(t, fail(cb))
+	clock.advance(time.Second)
+	assert.Nil(t, exclude(cb))
+	assert.Equal(t, WindowInfo{
+		BucketPeriod: time.Second,
+		Start:        start,
+		Age:          2,
+		Index:        2,
+		Buckets:      []Counts{{1, 1, 0, 1, 0, 0, 0}, {1, 0, 1, 0, 1, 0, 1}, {1, 0, 0, 0, 0, 1, 0}},
+	}, cb.WindowInfo())
+
+	// the buckets to be dropped are reported empty without rotating the window
+	clock.advance(2 * time.Second)
+	info := cb.WindowInfo()
+	assert.Equal(t, uint64(4), info.Age)
+	assert.Equal(t, 1, info.Index)
+	assert.Equal(t, []Counts{{}, {}, {1, 0, 0, 0, 0, 1, 0}}, info.Buckets)
+	assert.Equal(t, uint64(2), cb.window.age)
+	assert.Equal(t, cb.Counts(), info.Buckets[2])
+
+	// the rolling window is started anew on a change of the generation
+	cb.Reset()
+	assert.Equal(t, WindowInfo{
+		BucketPeriod: time.Second,
+		Start:        clock.Now(),
+		Buckets:      []Counts{{}, {}, {}},
+	}, cb.WindowInfo())
+
+	assert.Equal(t, WindowInfo{}, NewCircuitBreaker[bool](Settings{BucketPeriod: time.Second}).WindowInfo())
+}
+
+func TestSwitchToRolling(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{
+		Interval: 10 * time.Second,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.TotalFailures >= 4
+		},
+		Clock: clock,
+	})
+
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, ErrInvalidWindow, cb.SwitchToRolling(0, time.Second))
+	assert.Equal(t, ErrInvalidWindow, cb.SwitchToRolling(3*time.Second, 0))
+
+	// the totals are kept in the newest bucket
+	assert.NoError(t, cb.SwitchToRolling(3*time.Second, time.Second))
+	assert.Equal(t, Counts{3, 1, 2, 0, 2, 0, 2}, cb.Counts())
+	assert.Equal(t, []Counts{{3, 1, 2, 0, 0, 0, 2}, {}, {}}, cb.WindowInfo().Buckets)
+
+	clock.advance(2 * time.Second)
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, Counts{4, 1, 3, 0, 3, 0, 3}, cb.Counts())
+
+	// and dropped together after the interval, past the fixed interval that would have cleared them
+	clock.advance(time.Second)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, cb.Counts())
+	clock.advance(10 * time.Second)
+	assert.Equal(t, Counts{}, cb.Counts())
+
+	// the window is resized
+	assert.Nil(t, fail(cb))
+	assert.NoError(t, cb.SwitchToRolling(2*time.Second, 500*time.Millisecond))
+	assert.Equal(t, 4, len(cb.WindowInfo().Buckets))
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, cb.Counts())
+
+	// the new window is used from the next closed state
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	assert.NoError(t, cb.SwitchToRolling(time.Second, time.Second))
+	assert.Equal(t, Counts{}, cb.Counts())
+	clock.advance(defaultTimeout + time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, 1, len(cb.WindowInfo().Buckets))
+}
+
+func TestSwitchToFixed(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{
+		Interval:     3 * time.Second,
+		BucketPeriod: time.Second,
+		Clock:        clock,
+	})
+
+	assert.Nil(t, fail(cb))
+	clock.advance(time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, ErrInvalidWindow, cb.SwitchToFixed(-time.Second))
+
+	// the counts are kept and the first interval starts now
+	assert.NoError(t, cb.SwitchToFixed(5*time.Second))
+	assert.Equal(t, WindowInfo{}, cb.WindowInfo())
+	assert.Equal(t, Counts{2, 1, 1, 1, 0, 0, 1}, cb.Counts())
+	clock.advance(3 * time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, Counts{3, 2, 1, 2, 0, 0, 1}, cb.Counts())
+	clock.advance(2*time.Second + time.Millisecond)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0, 0}, cb.Counts())
+
+	// an interval of 0 never clears the counts
+	assert.NoError(t, cb.SwitchToFixed(0))
+	clock.advance(time.Hour)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, Counts{2, 2, 0, 2, 0, 0, 0}, cb.Counts())
+}
+
+func TestBucketPeriod(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{
+		Interval:     3 * time.Second,
+		BucketPeriod: time.Second,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.TotalFailures >= 3
+		},
+		Clock: clock,
+	})
+
+	assert.Nil(t, fail(cb))
+	clock.advance(time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, Counts{3, 1, 2, 0, 1, 0, 2}, cb.Counts())
+
+	// the first bucket is dropped, not the whole window
+	clock.advance(2 * time.Second)
+	assert.Equal(t, Counts{2, 1, 1, 0, 1, 0, 1}, cb.Counts())
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, Counts{3, 1, 2, 0, 2, 0, 2}, cb.counts)
+
+	clock.advance(time.Second)
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{2, 0, 2, 0, 2, 0, 2}, cb.counts)
+
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+
+	// the outcome of a request whose bucket has been dropped is discarded
+	clock.advance(defaultTimeout + time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	generation, age, err := cb.beforeRequest()
+	assert.Nil(t, err)
+	clock.advance(4 * time.Second)
+	cb.afterRequest(generation, age, OutcomeSuccess, nil)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, cb.Counts())
+}
+
+func TestBucketDecay(t *testing.T) {
+	for _, c := range []struct {
+		decay    float64
+		failures uint32
+		state    State
+	}{
+		{0, 5, StateOpen},
+		{1, 5, StateOpen},
+		{0.9, 4, StateClosed},
+		{0.5, 2, StateClosed},
+	} {
+		clock := newFakeClock()
+		var seen Counts
+		cb := NewCircuitBreaker[bool](Settings{
+			Interval:     10 * time.Second,
+			BucketPeriod: time.Second,
+			BucketDecay:  c.decay,
+			ReadyToTrip: func(counts Counts) bool {
+				seen = counts
+				return counts.TotalFailures >= 5
+			},
+			Clock: clock,
+		})
+
+		// the same failures are recent enough to trip only a flat window
+		for i := 0; i < 3; i++ {
+			assert.Nil(t, fail(cb))
+		}
+		clock.advance(5 * time.Second)
+		assert.Nil(t, fail(cb))
+		assert.Nil(t, fail(cb))
+
+		assert.Equal(t, c.failures, seen.TotalFailures, "decay %v", c.decay)
+		assert.Equal(t, c.state, cb.State(), "decay %v", c.decay)
+		if c.state == StateClosed {
+			assert.Equal(t, Counts{5, 0, 5, 0, 5, 0, 5}, cb.Counts(), "decay %v", c.decay)
+		}
+	}
+}
+
+func TestHalfOpenMinBuckets(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxRequests:        2,
+		Timeout:            10 * time.Second,
+		BucketPeriod:       time.Second,
+		HalfOpenMinBuckets: 3,
+		Clock:              clock,
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	clock.advance(11 * time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	// successes within one bucket don't close the breaker, and free their slots
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, succeed(cb))
+	}
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	clock.advance(time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	clock.advance(time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+
+	// a failure in the half-open state starts over
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	clock.advance(11 * time.Second)
+	assert.Nil(t, succeed(cb))
+	clock.advance(time.Second)
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+
+	clock.advance(11 * time.Second)
+	assert.Nil(t, succeed(cb))
+	clock.advance(time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateHalfOpen, cb.State())
+	clock.advance(time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func TestHalfOpenMinBucketsDefault(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxRequests:  2,
+		Timeout:      10 * time.Second,
+		BucketPeriod: time.Second,
+		Clock:        clock,
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	clock.advance(11 * time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func TestReset(t *testing.T) {
+	var stateChange StateChange
+	cb := NewCircuitBreaker[bool](Settings{
+		OnStateChange: func(name string, from State, to State) {
+			stateChange = StateChange{name, from, to}
+		},
+	})
+
+	assert.Nil(t, fail(cb))
+	generation := cb.generation
+	cb.Reset()
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, cb.Counts())
+	assert.Greater(t, cb.generation, generation)
+	assert.Equal(t, StateChange{}, stateChange)
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	cb.Reset()
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, StateChange{"", StateOpen, StateClosed}, stateChange)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0, 0}, cb.Counts())
+}
+
+func TestObserveOnly(t *testing.T) {
+	clock := newFakeClock()
+	var stateChange StateChange
+	var rejections []error
+	cb := NewCircuitBreaker[bool](Settings{
+		Name:    "observe",
+		Timeout: 10 * time.Second,
+		OnStateChange: func(name string, from State, to State) {
+			stateChange = StateChange{name, from, to}
+		},
+		ObserveOnly: true,
+		OnWouldReject: func(name string, err error) {
+			assert.Equal(t, "observe", name)
+			rejections = append(rejections, err)
+		},
+		Clock: clock,
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, StateChange{"observe", StateClosed, StateOpen}, stateChange)
+
+	// the open state lets the requests through without counting them
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, []error{ErrOpenState, ErrOpenState}, rejections)
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, cb.Counts())
+
+	clock.advance(11 * time.Second)
+	generation, age, err := cb.beforeRequest()
+	assert.Nil(t, err)
+	generation2, age2, err := cb.beforeRequest()
+	assert.Nil(t, err)
+	assert.Equal(t, []error{ErrOpenState, ErrOpenState, ErrTooManyRequests}, rejections)
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	cb.afterRequest(generation, age, OutcomeSuccess, nil)
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, StateChange{"observe", StateHalfOpen, StateClosed}, stateChange)
+	cb.afterRequest(generation2, age2, OutcomeFailure, nil)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, cb.Counts())
+}
+
+func TestOnIntervalReset(t *testing.T) {
+	clock := newFakeClock()
+
+	var resets []Counts
+	var generations int
+	cb := NewCircuitBreaker[bool](Settings{
+		Interval: time.Second,
+		Timeout:  time.Second,
+		OnIntervalReset: func(name string, endedCounts Counts) {
+			resets = append(resets, endedCounts)
+		},
+		OnGenerationEnd: func(name string, counts Counts) {
+			generations++
+		},
+		Clock: clock,
+	})
+
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, fail(cb))
+	clock.advance(time.Second + time.Millisecond)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, []Counts{{2, 1, 1, 0, 1, 0, 1}}, resets)
+	assert.Equal(t, 1, generations)
+
+	// the changes of the state don't call OnIntervalReset
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	clock.advance(time.Second + time.Millisecond)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	cb.Reset()
+	assert.Equal(t, 1, len(resets))
+	assert.Equal(t, 5, generations)
+
+	// MaxAccumulatedRequests clears Counts like an interval
+	cb = NewCircuitBreaker[bool](Settings{
+		MaxAccumulatedRequests: 2,
+		OnIntervalReset: func(name string, endedCounts Counts) {
+			resets = append(resets, endedCounts)
+		},
+	})
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, succeed(cb))
+	}
+	assert.Equal(t, Counts{2, 2, 0, 2, 0, 0, 0}, resets[1])
+}
+
+func TestPreserveSuccessesOnReset(t *testing.T) {
+	clock := newFakeClock()
+	var total Counts
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxRequests: 2,
+		Interval:    10 * time.Second,
+		Timeout:     10 * time.Second,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 2
+		},
+		IsExcluded:               isExcluded,
+		PreserveSuccessesOnReset: true,
+		OnGenerationEnd: func(name string, counts Counts) {
+			total.add(counts)
+		},
+		Clock: clock,
+	})
+
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, exclude(cb))
+
+	// the interval keeps the successes only
+	clock.advance(11 * time.Second)
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{1, 1, 0, 0, 0, 0, 0}, cb.Counts())
+
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, cb.Counts())
+
+	clock.advance(11 * time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0, 0}, cb.Counts())
+	assert.Nil(t, succeed(cb))
+
+	// the recovery starts from the successes of the probes
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{2, 2, 0, 2, 0, 0, 0}, cb.Counts())
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, Counts{3, 2, 1, 0, 1, 0, 1}, cb.Counts())
+
+	// the kept successes are delivered to OnGenerationEnd only once
+	total.add(cb.Counts())
+	total.subtract(cb.preserved)
+	assert.Equal(t, Counts{8, 3, 4, 0, 0, 1, 4}, Counts{total.Requests, total.TotalSuccesses, total.TotalFailures, 0, 0, total.TotalExclusions, total.TotalFailureWeight})
+
+	cb.Reset()
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, cb.Counts())
+}
+
+func tripped[T any](st Settings) *CircuitBreaker[T] {
+	st.Timeout = time.Hour
+	cb := NewCircuitBreaker[T](st)
+	for i := 0; i < 6; i++ {
+		_, _ = cb.Execute(func() (T, error) {
+			var defaultValue T
+			return defaultValue, errors.New("fail")
+		})
+	}
+	return cb
+}
+
+func TestRejectValue(t *testing.T) {
+	type point struct{ X, Y int }
+	sentinel := &point{-1, -1}
+
+	pointer := tripped[*point](Settings{RejectValue: func() any { return sentinel }})
+	p, err := pointer.Execute(func() (*point, error) { return &point{}, nil })
+	assert.Equal(t, ErrOpenState, err)
+	assert.Same(t, sentinel, p)
+
+	slice := tripped[[]int](Settings{RejectValue: func() any { return []int{} }})
+	values, err := slice.Execute(func() ([]int, error) { return []int{1}, nil })
+	assert.Equal(t, ErrOpenState, err)
+	assert.NotNil(t, values)
+	assert.Empty(t, values)
+
+	value := tripped[point](Settings{RejectValue: func() any { return point{-1, -1} }})
+	v, err := value.Execute(func() (point, error) { return point{}, nil })
+	assert.Equal(t, ErrOpenState, err)
+	assert.Equal(t, point{-1, -1}, v)
+
+	// the zero value by default or for nil
+	values, err = tripped[[]int](Settings{}).Execute(func() ([]int, error) { return []int{1}, nil })
+	assert.Equal(t, ErrOpenState, err)
+	assert.Nil(t, values)
+	p, err = tripped[*point](Settings{RejectValue: func() any { return nil }}).Execute(func() (*point, error) { return &point{}, nil })
+	assert.Equal(t, ErrOpenState, err)
+	assert.Nil(t, p)
+
+	// a value of another type is caught by NewCircuitBreaker
+	assert.PanicsWithValue(t, "gobreaker: RejectValue returns gobreaker.point, not *gobreaker.point", func() {
+		NewCircuitBreaker[*point](Settings{RejectValue: func() any { return point{} }})
+	})
+	assert.NotPanics(t, func() {
+		NewCircuitBreaker[any](Settings{RejectValue: func() any { return point{} }})
+	})
+}
+
+func TestPeekState(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{Timeout: 10 * time.Second, Clock: clock})
+	assert.Equal(t, StateClosed, cb.PeekState())
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.PeekState())
+
+	clock.advance(11 * time.Second) // over Timeout
+	assert.Equal(t, StateHalfOpen, cb.PeekState())
+	assert.Equal(t, StateOpen, cb.state) // no transition applied
+
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Equal(t, StateHalfOpen, cb.state)
+}
+
+func TestCircuitBreakerInParallel(t *testing.T) {
+	runtime.GOMAXPROCS(runtime.NumCPU())
+
+	ch := make(chan error)
+
+	const numReqs = 10000
+	routine := func() {
+		for i := 0; i < numReqs; i++ {
+			ch <- succeed(customCB)
+		}
+	}
+
+	const numRoutines = 10
+	for i := 0; i < numRoutines; i++ {
+		go routine()
+	}
+
+	total := uint32(numReqs * numRoutines)
+	for i := uint32(0); i < total; i++ {
+		err := <-ch
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, Counts{total, total, 0, total, 0, 0, 0}, customCB.counts)
+}
+
+func TestTransitionsExactlyOnceInParallel(t *testing.T) {
+	clock := newFakeClock()
+	var mutex sync.Mutex
+	var transitions []StateChange
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxRequests: 1000,
+		Timeout:     10 * time.Second,
+		OnStateChange: func(name string, from State, to State) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			transitions = append(transitions, StateChange{name, from, to})
+		},
+		Clock: clock,
+	})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	transitions = nil
+
+	const numRoutines = 16
+	const numCalls = 500
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < numRoutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			for j := 0; j < numCalls; j++ {
+				if i%2 == 0 {
+					cb.State()
+				} else {
+					_ = succeed(cb)
+				}
+			}
+		}(i)
+	}
+
+	// every goroutine crosses the timeout boundary at once
+	clock.advance(11 * time.Second)
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, []StateChange{
+		{"", StateOpen, StateHalfOpen},
+		{"", StateHalfOpen, StateClosed},
+	}, transitions)
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func benchmarkExecuteWithObserver(b *testing.B, observe func(cb *CircuitBreaker[bool])) {
+	cb := NewCircuitBreaker[bool](Settings{})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					observe(cb)
+				}
+			}
+		}()
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = succeed(cb)
+		}
+	})
+	b.StopTimer()
+
+	close(stop)
+	wg.Wait()
+}
+
+func BenchmarkExecuteWithStateObserver(b *testing.B) {
+	benchmarkExecuteWithObserver(b, func(cb *CircuitBreaker[bool]) { cb.State() })
+}
+
+func BenchmarkExecuteWithPeekStateObserver(b *testing.B) {
+	benchmarkExecuteWithObserver(b, func(cb *CircuitBreaker[bool]) { cb.PeekState() })
+}
+
+func BenchmarkExecuteWithCountsObserver(b *testing.B) {
+	benchmarkExecuteWithObserver(b, func(cb *CircuitBreaker[bool]) { cb.Counts() })
+}
+
+func BenchmarkExecuteClosed(b *testing.B) {
+	cb := NewCircuitBreaker[bool](Settings{})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = succeed(cb)
+	}
+}
+
+func BenchmarkExecuteClosedRolling(b *testing.B) {
+	cb := NewCircuitBreaker[bool](Settings{Interval: time.Minute, BucketPeriod: time.Second})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = succeed(cb)
+	}
+}
+
+func BenchmarkExecuteOpen(b *testing.B) {
+	cb := NewCircuitBreaker[bool](Settings{Timeout: time.Hour})
+	for i := 0; i < 6; i++ {
+		_ = fail(cb)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = succeed(cb)
+	}
+}
+
+func BenchmarkExecuteHalfOpen(b *testing.B) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxRequests: math.MaxUint32,
+		Timeout:     time.Second,
+		Clock:       clock,
+	})
+	for i := 0; i < 6; i++ {
+		_ = fail(cb)
+	}
+	clock.advance(2 * time.Second)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = succeed(cb)
+	}
+}
+
+func BenchmarkExecuteHalfOpenContention(b *testing.B) {
+	halfOpen := func() *CircuitBreaker[bool] {
+		clock := newFakeClock()
+		cb := NewCircuitBreaker[bool](Settings{
+			MaxRequests: 8,
+			Timeout:     time.Second,
+			IsExcluded:  isExcluded,
+			Clock:       clock,
+		})
+		for i := 0; i < 6; i++ {
+			_ = fail(cb)
+		}
+		clock.advance(2 * time.Second)
+		return cb
+	}
+
+	// the excluded requests keep freeing the slots for each other
+	b.Run("excluded", func(b *testing.B) {
+		cb := halfOpen()
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_ = exclude(cb)
+			}
+		})
+	})
+
+	// the slots are held by the requests in flight, so the others are rejected without the lock
+	b.Run("saturated", func(b *testing.B) {
+		cb := halfOpen()
+		for i := 0; i < 8; i++ {
+			_, _, _ = cb.beforeRequest()
+		}
+		_ = succeed(cb)
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_ = succeed(cb)
+			}
+		})
+	})
+}
+
+func BenchmarkExecuteParallel(b *testing.B) {
+	cb := NewCircuitBreaker[bool](Settings{})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = succeed(cb)
+		}
+	})
 }
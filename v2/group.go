@@ -0,0 +1,90 @@
+package gobreaker
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Group manages CircuitBreakers created from the same Settings template, one per name,
+// e.g. one per upstream host.
+// Unlike Registry, which holds distinct Settings per name for the whole process,
+// Group is meant for dynamically created breakers that share the same configuration.
+type Group[T any] struct {
+	settings Settings
+
+	mutex    sync.Mutex
+	breakers map[string]*CircuitBreaker[T]
+
+	subscribers subscribers
+}
+
+// NewGroup returns a new Group that creates CircuitBreakers from st.
+// OnStateChange of st is applied to every CircuitBreaker in the Group.
+func NewGroup[T any](st Settings) *Group[T] {
+	return &Group[T]{
+		settings: st,
+		breakers: make(map[string]*CircuitBreaker[T]),
+	}
+}
+
+// Get returns the CircuitBreaker for the given name,
+// creating it from the Settings template of the Group with Name overridden if it doesn't exist.
+func (g *Group[T]) Get(name string) *CircuitBreaker[T] {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	cb, ok := g.breakers[name]
+	if !ok {
+		st := g.settings
+		st.Name = name
+		cb = NewCircuitBreaker[T](st)
+		cb.groupSubscribers = &g.subscribers
+		g.breakers[name] = cb
+	}
+	return cb
+}
+
+// All returns the CircuitBreakers in the Group sorted by name,
+// e.g. to report the metrics of the whole Group.
+func (g *Group[T]) All() []*CircuitBreaker[T] {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	all := make([]*CircuitBreaker[T], 0, len(g.breakers))
+	for _, cb := range g.breakers {
+		all = append(all, cb)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+	return all
+}
+
+// Remove removes the CircuitBreaker for the given name, if any, e.g. for a decommissioned host,
+// and closes it. The next call of Get for the name creates a new CircuitBreaker.
+// Remove returns ErrRemovingOpen without removing the CircuitBreaker if it is open or forced open.
+func (g *Group[T]) Remove(name string) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	cb, ok := g.breakers[name]
+	if !ok {
+		return nil
+	}
+	if isOpen(cb.PeekState()) {
+		return fmt.Errorf("%w: %q", ErrRemovingOpen, name)
+	}
+	delete(g.breakers, name)
+	return cb.Close()
+}
+
+// Subscribe returns a channel that receives the state changes of all the CircuitBreakers in the Group.
+// The channel is buffered and an event is dropped when the buffer is full,
+// so that a slow subscriber never blocks the CircuitBreakers.
+func (g *Group[T]) Subscribe() <-chan StateChangeEvent {
+	return g.subscribers.subscribe()
+}
+
+// Unsubscribe stops delivering events to the channel returned by Subscribe and closes it.
+func (g *Group[T]) Unsubscribe(ch <-chan StateChangeEvent) {
+	g.subscribers.unsubscribe(ch)
+}
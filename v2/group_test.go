@@ -0,0 +1,117 @@
+package gobreaker
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroup(t *testing.T) {
+	g := NewGroup[bool](Settings{Name: "ignored", MaxRequests: 3})
+
+	a := g.Get("a")
+	assert.Equal(t, "a", a.Name())
+	assert.Equal(t, uint32(3), a.maxRequests)
+	assert.Same(t, a, g.Get("a"))
+
+	b := g.Get("b")
+	assert.Equal(t, "b", b.Name())
+	assert.NotSame(t, a, b)
+}
+
+func TestGroupAll(t *testing.T) {
+	g := NewGroup[bool](Settings{})
+	assert.Empty(t, g.All())
+
+	b := g.Get("b")
+	a := g.Get("a")
+	c := g.Get("c")
+	assert.Equal(t, []*CircuitBreaker[bool]{a, b, c}, g.All())
+
+	assert.NoError(t, g.Remove("b"))
+	assert.Equal(t, []*CircuitBreaker[bool]{a, c}, g.All())
+}
+
+func TestGroupRemove(t *testing.T) {
+	g := NewGroup[bool](Settings{})
+	a := g.Get("a")
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(a))
+	}
+	assert.ErrorIs(t, g.Remove("a"), ErrRemovingOpen)
+	assert.Same(t, a, g.Get("a"))
+
+	a.Reset()
+	a.ForceOpen()
+	assert.ErrorIs(t, g.Remove("a"), ErrRemovingOpen)
+	assert.Same(t, a, g.Get("a"))
+
+	a.Reset()
+	assert.NoError(t, g.Remove("a"))
+	other := g.Get("a")
+	assert.NotSame(t, a, other)
+	assert.Equal(t, Counts{}, other.Counts())
+	assert.NoError(t, g.Remove("unknown"))
+}
+
+func TestGroupRemoveInParallel(t *testing.T) {
+	g := NewGroup[bool](Settings{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, succeed(g.Get("a")))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, g.Remove("a"))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGroupStateChange(t *testing.T) {
+	var changes []StateChange
+	g := NewGroup[bool](Settings{
+		OnStateChange: func(name string, from State, to State) {
+			changes = append(changes, StateChange{name, from, to})
+		},
+	})
+
+	ch := g.Subscribe()
+	other := g.Subscribe()
+	g.Unsubscribe(other)
+	_, ok := <-other
+	assert.False(t, ok)
+
+	a := g.Get("a")
+	b := g.Get("b")
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(b))
+	}
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(a))
+	}
+
+	assert.Equal(t, []StateChange{{"b", StateClosed, StateOpen}, {"a", StateClosed, StateOpen}}, changes)
+	for _, name := range []string{"b", "a"} {
+		event := <-ch
+		assert.Equal(t, name, event.Name)
+		assert.Equal(t, StateClosed, event.From)
+		assert.Equal(t, StateOpen, event.To)
+		assert.Equal(t, Counts{6, 0, 6, 0, 6, 0, 6}, event.Counts)
+	}
+
+	// a slow subscriber doesn't block the breakers
+	a.mutex.Lock()
+	for i := 0; i < subscriptionBuffer+1; i++ {
+		a.setState(StateClosed, a.clock.Now())
+		a.setState(StateOpen, a.clock.Now())
+	}
+	a.unlock()
+	assert.Len(t, ch, subscriptionBuffer)
+}
@@ -0,0 +1,38 @@
+// Package grpcbreaker provides helpers to use gobreaker with gRPC clients.
+// It is a separate module so that the core of gobreaker doesn't depend on gRPC.
+package grpcbreaker
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultFailureCodes are the status codes that IsSuccessful counts as failures if no codes are given,
+// which indicate that the server is unavailable or overloaded rather than that the request is bad.
+var DefaultFailureCodes = []codes.Code{codes.Unavailable, codes.DeadlineExceeded}
+
+// IsSuccessful returns a function for Settings.IsSuccessful that counts the errors
+// with the given status codes, or DefaultFailureCodes if none are given, as failures.
+// The errors that don't carry a gRPC status, e.g. errors of the transport, are also failures.
+// The other errors, e.g. of codes.InvalidArgument or codes.NotFound, are successes
+// since the server did respond.
+func IsSuccessful(failureCodes ...codes.Code) func(err error) bool {
+	if len(failureCodes) == 0 {
+		failureCodes = DefaultFailureCodes
+	}
+	failures := make(map[codes.Code]bool, len(failureCodes))
+	for _, code := range failureCodes {
+		failures[code] = true
+	}
+
+	return func(err error) bool {
+		if err == nil {
+			return true
+		}
+		s, ok := status.FromError(err)
+		if !ok {
+			return false
+		}
+		return !failures[s.Code()]
+	}
+}
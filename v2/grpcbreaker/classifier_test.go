@@ -0,0 +1,40 @@
+package grpcbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsSuccessful(t *testing.T) {
+	isSuccessful := IsSuccessful()
+	for code, successful := range map[codes.Code]bool{
+		codes.OK:                true,
+		codes.InvalidArgument:   true,
+		codes.NotFound:          true,
+		codes.PermissionDenied:  true,
+		codes.Internal:          true,
+		codes.Unavailable:       false,
+		codes.DeadlineExceeded:  false,
+		codes.ResourceExhausted: true,
+	} {
+		assert.Equal(t, successful, isSuccessful(status.Error(code, "error")), code)
+	}
+	assert.True(t, isSuccessful(nil))
+	assert.False(t, isSuccessful(errors.New("connection refused")))
+	assert.False(t, isSuccessful(fmt.Errorf("wrapped: %w", status.Error(codes.Unavailable, "error"))))
+	assert.False(t, isSuccessful(context.DeadlineExceeded))
+}
+
+func TestIsSuccessfulWithCodes(t *testing.T) {
+	isSuccessful := IsSuccessful(codes.ResourceExhausted, codes.Internal)
+	assert.False(t, isSuccessful(status.Error(codes.ResourceExhausted, "error")))
+	assert.False(t, isSuccessful(status.Error(codes.Internal, "error")))
+	assert.True(t, isSuccessful(status.Error(codes.Unavailable, "error")))
+	assert.True(t, isSuccessful(nil))
+}
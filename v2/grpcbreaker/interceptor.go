@@ -0,0 +1,183 @@
+package grpcbreaker
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/sony/gobreaker/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Classifier determines how the error of a call is counted.
+type Classifier func(err error) gobreaker.Outcome
+
+// DefaultClassifier counts the errors with DefaultFailureCodes and the errors without a gRPC status as failures,
+// and the other calls, including the errors of codes.InvalidArgument or codes.NotFound, as successes.
+func DefaultClassifier(err error) gobreaker.Outcome {
+	if defaultIsSuccessful(err) {
+		return gobreaker.OutcomeSuccess
+	}
+	return gobreaker.OutcomeFailure
+}
+
+var defaultIsSuccessful = IsSuccessful()
+
+// StatusClassifier returns a Classifier that counts the errors with the status codes in outcomes
+// as mapped, and the other calls as DefaultClassifier does.
+// For example, mapping codes.NotFound to gobreaker.OutcomeExcluded counts it as neither a success nor a failure,
+// and mapping codes.ResourceExhausted to gobreaker.OutcomeFailure makes the CircuitBreaker back off
+// from an overloaded server.
+func StatusClassifier(outcomes map[codes.Code]gobreaker.Outcome) Classifier {
+	return func(err error) gobreaker.Outcome {
+		if s, ok := status.FromError(err); ok && err != nil {
+			if o, ok := outcomes[s.Code()]; ok {
+				return o
+			}
+		}
+		return DefaultClassifier(err)
+	}
+}
+
+// Option configures the interceptors.
+type Option func(*options)
+
+type options struct {
+	classify Classifier
+}
+
+// WithClassifier sets the Classifier of the calls. The default is DefaultClassifier.
+func WithClassifier(classify Classifier) Option {
+	return func(o *options) {
+		o.classify = classify
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{classify: DefaultClassifier}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// classifier returns the Classifier that counts a call cut off by ctx as an exclusion,
+// since the caller rather than the server ended it.
+func (o options) classifier(ctx context.Context) Classifier {
+	return func(err error) gobreaker.Outcome {
+		if err != nil && ctx.Err() != nil {
+			return gobreaker.OutcomeExcluded
+		}
+		return o.classify(err)
+	}
+}
+
+// RejectedError is the error of a call rejected by the CircuitBreaker.
+// Its gRPC status is codes.Unavailable with the message of the error of the rejection,
+// which errors.Is finds in the chain, e.g. gobreaker.ErrOpenState.
+type RejectedError struct {
+	Err error
+}
+
+func (e *RejectedError) Error() string {
+	return "rejected by circuit breaker: " + e.Err.Error()
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// GRPCStatus returns the status of codes.Unavailable, which status.FromError and status.Code use.
+func (e *RejectedError) GRPCStatus() *status.Status {
+	return status.New(codes.Unavailable, e.Error())
+}
+
+// UnaryClientInterceptor returns a grpc.UnaryClientInterceptor that sends each call through cb.
+// The calls are classified by the Classifier of the options instead of the classifiers of the Settings of cb,
+// and a call that fails after its context is done is counted as an exclusion.
+// If cb rejects a call, the interceptor returns a RejectedError without invoking it.
+func UnaryClientInterceptor(cb *gobreaker.CircuitBreaker[any], opts ...Option) grpc.UnaryClientInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		invoked := false
+		classify := o.classifier(ctx)
+		_, err := cb.ExecuteWithClassifier(func() (any, error) {
+			invoked = true
+			return nil, invoker(ctx, method, req, reply, cc, callOpts...)
+		}, func(_ any, err error) gobreaker.Outcome {
+			return classify(err)
+		})
+		if err != nil && !invoked {
+			return &RejectedError{Err: err}
+		}
+		return err
+	}
+}
+
+// StreamClientInterceptor returns a grpc.StreamClientInterceptor that sends each stream through cb
+// with CircuitBreaker.StreamAllow.
+// The outcome of a stream is the error that ends it, either of creating the stream or of receiving a message,
+// where io.EOF is the normal end; it is classified like the calls of UnaryClientInterceptor.
+// A stream that isn't received until its end is counted as an exclusion when its context is done.
+// If cb rejects a stream, the interceptor returns a RejectedError without creating it.
+func StreamClientInterceptor(cb *gobreaker.CircuitBreaker[any], opts ...Option) grpc.StreamClientInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		_, onDone, release, err := cb.StreamAllow()
+		if err != nil {
+			return nil, &RejectedError{Err: err}
+		}
+
+		classify := o.classifier(ctx)
+		done := func(err error) {
+			onDone(outcomeError{classify(err), err})
+		}
+		cs, err := streamer(ctx, desc, cc, method, callOpts...)
+		if err != nil {
+			done(err)
+			return nil, err
+		}
+		context.AfterFunc(ctx, release)
+		return &clientStream{ClientStream: cs, done: done}, nil
+	}
+}
+
+// clientStream reports the end of the stream to the CircuitBreaker.
+type clientStream struct {
+	grpc.ClientStream
+	done func(err error)
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case errors.Is(err, io.EOF):
+		s.done(nil)
+	case err != nil:
+		s.done(err)
+	}
+	return err
+}
+
+// outcomeError declares the outcome of a stream determined by Classifier, which may be nil.
+type outcomeError struct {
+	outcome gobreaker.Outcome
+	err     error
+}
+
+func (e outcomeError) Error() string {
+	if e.err == nil {
+		return e.outcome.String()
+	}
+	return e.err.Error()
+}
+
+func (e outcomeError) Unwrap() error {
+	return e.err
+}
+
+func (e outcomeError) CircuitOutcome() gobreaker.Outcome {
+	return e.outcome
+}
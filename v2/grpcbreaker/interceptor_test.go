@@ -0,0 +1,135 @@
+package grpcbreaker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sony/gobreaker/v2"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDefaultClassifier(t *testing.T) {
+	for code, o := range map[codes.Code]gobreaker.Outcome{
+		codes.OK:               gobreaker.OutcomeSuccess,
+		codes.InvalidArgument:  gobreaker.OutcomeSuccess,
+		codes.NotFound:         gobreaker.OutcomeSuccess,
+		codes.Unavailable:      gobreaker.OutcomeFailure,
+		codes.DeadlineExceeded: gobreaker.OutcomeFailure,
+	} {
+		assert.Equal(t, o, DefaultClassifier(status.Error(code, "error")), code)
+	}
+	assert.Equal(t, gobreaker.OutcomeSuccess, DefaultClassifier(nil))
+	assert.Equal(t, gobreaker.OutcomeFailure, DefaultClassifier(errors.New("connection refused")))
+}
+
+func TestStatusClassifier(t *testing.T) {
+	classify := StatusClassifier(map[codes.Code]gobreaker.Outcome{
+		codes.NotFound:          gobreaker.OutcomeExcluded,
+		codes.ResourceExhausted: gobreaker.OutcomeFailure,
+	})
+	assert.Equal(t, gobreaker.OutcomeExcluded, classify(status.Error(codes.NotFound, "error")))
+	assert.Equal(t, gobreaker.OutcomeFailure, classify(status.Error(codes.ResourceExhausted, "error")))
+	assert.Equal(t, gobreaker.OutcomeFailure, classify(status.Error(codes.Unavailable, "error")))
+	assert.Equal(t, gobreaker.OutcomeSuccess, classify(status.Error(codes.InvalidArgument, "error")))
+	assert.Equal(t, gobreaker.OutcomeSuccess, classify(nil))
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	cb := gobreaker.NewCircuitBreaker[any](gobreaker.Settings{
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= 2
+		},
+	})
+	interceptor := UnaryClientInterceptor(cb, WithClassifier(StatusClassifier(map[codes.Code]gobreaker.Outcome{
+		codes.NotFound: gobreaker.OutcomeExcluded,
+	})))
+	invoked := 0
+	call := func(ctx context.Context, err error) error {
+		return interceptor(ctx, "/svc/Method", nil, nil, nil, func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			invoked++
+			return err
+		})
+	}
+
+	assert.NoError(t, call(context.Background(), nil))
+	notFound := status.Error(codes.NotFound, "not found")
+	assert.Equal(t, notFound, call(context.Background(), notFound))
+	assert.Equal(t, gobreaker.Counts{Requests: 2, TotalSuccesses: 1, ConsecutiveSuccesses: 1, TotalExclusions: 1}, cb.Counts())
+
+	// a call cut off by the caller is an exclusion
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, call(ctx, status.Error(codes.Canceled, "canceled")))
+	assert.Equal(t, uint32(2), cb.Counts().TotalExclusions)
+
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	assert.Equal(t, unavailable, call(context.Background(), unavailable))
+	assert.Equal(t, unavailable, call(context.Background(), unavailable))
+	assert.Equal(t, gobreaker.StateOpen, cb.State())
+
+	err := call(context.Background(), nil)
+	assert.Equal(t, 5, invoked)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.ErrorIs(t, err, gobreaker.ErrOpenState)
+	assert.EqualError(t, err, "rejected by circuit breaker: circuit breaker is open")
+}
+
+type fakeClientStream struct {
+	grpc.ClientStream
+	errs []error
+}
+
+func (s *fakeClientStream) RecvMsg(m any) error {
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	cb := gobreaker.NewCircuitBreaker[any](gobreaker.Settings{})
+	interceptor := StreamClientInterceptor(cb)
+	open := func(ctx context.Context, err error, errs ...error) (grpc.ClientStream, error) {
+		return interceptor(ctx, &grpc.StreamDesc{}, nil, "/svc/Stream", func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			if err != nil {
+				return nil, err
+			}
+			return &fakeClientStream{errs: errs}, nil
+		})
+	}
+
+	// the stream received until io.EOF is a success
+	cs, err := open(context.Background(), nil, nil, io.EOF)
+	assert.NoError(t, err)
+	assert.NoError(t, cs.RecvMsg(nil))
+	assert.Equal(t, uint32(0), cb.Counts().TotalSuccesses)
+	assert.Equal(t, io.EOF, cs.RecvMsg(nil))
+	assert.Equal(t, gobreaker.Counts{Requests: 1, TotalSuccesses: 1, ConsecutiveSuccesses: 1}, cb.Counts())
+
+	// the error that ends the stream is classified
+	cs, err = open(context.Background(), nil, status.Error(codes.Unavailable, "unavailable"))
+	assert.NoError(t, err)
+	assert.Error(t, cs.RecvMsg(nil))
+	assert.Equal(t, uint32(1), cb.Counts().TotalFailures)
+
+	_, err = open(context.Background(), status.Error(codes.InvalidArgument, "invalid"))
+	assert.Error(t, err)
+	assert.Equal(t, uint32(2), cb.Counts().TotalSuccesses)
+
+	// the stream abandoned with its context is an exclusion
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = open(ctx, nil)
+	assert.NoError(t, err)
+	cancel()
+	assert.Eventually(t, func() bool { return cb.Counts().TotalExclusions == 1 }, time.Second, time.Millisecond)
+
+	cb.ForceOpen()
+	_, err = open(context.Background(), nil)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.ErrorIs(t, err, gobreaker.ErrOpenState)
+}
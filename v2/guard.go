@@ -0,0 +1,64 @@
+package gobreaker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Guard checks if a new request can proceed, for code that can't be restructured
+// into a single function for Execute, e.g. when setting up the request is expensive
+// and should be skipped while the CircuitBreaker is open.
+// If the CircuitBreaker rejects the request, Guard returns ctx, a nil callback and the error of the rejection.
+// Otherwise, Guard returns a child context of ctx for the work of the request
+// and a callback to report the error of the request, which is classified
+// by Classifiers, IsExcluded and IsSuccessful like the errors of StreamAllow.
+//
+// The returned context is cancelled when ctx is done or when the callback is called,
+// so the callback must be called exactly once after the work is done; subsequent calls are ignored.
+// Guard itself never cancels the work: if ctx is done while the request is in flight,
+// the error reported to the callback, e.g. context.Canceled, is classified as usual.
+func (cb *CircuitBreaker[T]) Guard(ctx context.Context) (context.Context, func(err error), error) {
+	generation, age, err := cb.beforeRequest()
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	ctx, done := cb.guard(ctx, func(o Outcome, err error, start time.Time) {
+		cb.afterRequestSince(generation, age, o, err, start)
+	})
+	return ctx, done, nil
+}
+
+// Guard checks if a new request can proceed through the shared state.
+// See CircuitBreaker.Guard.
+// The request is admitted by a write to the shared state and its outcome is written by the callback,
+// so the lock of SharedDataStore isn't held while the work of the request is done.
+// The errors of SharedDataStore in admitting the request are returned as they are,
+// regardless of the StoreUnavailablePolicy, and those in writing the outcome
+// are passed to the handler set by WithErrorHandler.
+func (dcb *DistributedCircuitBreaker[T]) Guard(ctx context.Context) (context.Context, func(err error), error) {
+	generation, age, err := dcb.admitShared()
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	ctx, done := dcb.guard(ctx, func(o Outcome, err error, start time.Time) {
+		dcb.recordShared(func() { dcb.afterRequestSince(generation, age, o, err, start) })
+	})
+	return ctx, done, nil
+}
+
+// guard returns the context and the callback of Guard for an admitted request
+// whose outcome is recorded by record.
+func (cb *CircuitBreaker[T]) guard(ctx context.Context, record func(o Outcome, err error, start time.Time)) (context.Context, func(err error)) {
+	start := cb.startTime()
+	ctx, cancel := context.WithCancel(ctx)
+	var once sync.Once
+	return ctx, func(err error) {
+		once.Do(func() {
+			cancel()
+			record(cb.classifyError(err), err, start)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package gobreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuard(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{})
+
+	ctx, done, err := cb.Guard(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, ctx.Err())
+	done(nil)
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	done(errors.New("fail"))
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0, 0}, cb.Counts())
+
+	for i := 0; i < 6; i++ {
+		ctx, done, err = cb.Guard(context.Background())
+		assert.NoError(t, err)
+		done(errors.New("fail"))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	parent := context.Background()
+	ctx, done, err = cb.Guard(parent)
+	assert.Equal(t, ErrOpenState, err)
+	assert.Equal(t, parent, ctx)
+	assert.Nil(t, done)
+}
+
+func TestGuardParentCancel(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{})
+
+	parent, cancel := context.WithCancel(context.Background())
+	ctx, done, err := cb.Guard(parent)
+	assert.NoError(t, err)
+
+	cancel()
+	<-ctx.Done()
+	done(ctx.Err())
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, cb.Counts())
+}
@@ -0,0 +1,86 @@
+package gobreaker
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// halfOpenGate is a counting semaphore of the slots of the half-open state.
+// The gate is installed whenever the CircuitBreaker becomes half-open and removed when it leaves the state.
+// A single request takes a slot before it takes the lock of the CircuitBreaker,
+// and keeps it unless its outcome frees the slot, e.g. an exclusion without ExclusionsConsumeHalfOpenSlots,
+// in which case the slot is freed after the lock is released.
+// Once a request has been rejected under the lock, which records the saturation of the state,
+// the gate sheds the requests over MaxRequests without taking the lock at all.
+//
+// A request admitted by ObserveOnly while all the slots are taken occupies a slot on top of them,
+// so that the gate is full as long as the requests occupying the slots are at least as many as the slots.
+type halfOpenGate struct {
+	slots    int64
+	taken    atomic.Int64
+	shedding atomic.Bool
+}
+
+// newHalfOpenGate returns a gate of n slots, of which the given number are taken,
+// e.g. by the requests counted in the shared state of DistributedCircuitBreaker.
+func newHalfOpenGate(n, taken uint32) *halfOpenGate {
+	g := &halfOpenGate{slots: int64(n)}
+	g.taken.Store(int64(taken))
+	return g
+}
+
+// tryAcquire takes a slot if any is free and reports whether it did.
+func (g *halfOpenGate) tryAcquire() bool {
+	for {
+		taken := g.taken.Load()
+		if taken >= g.slots {
+			return false
+		}
+		if g.taken.CompareAndSwap(taken, taken+1) {
+			return true
+		}
+	}
+}
+
+// occupy takes a slot even if none is free, for a request admitted by ObserveOnly.
+func (g *halfOpenGate) occupy() {
+	g.taken.Add(1)
+}
+
+// release frees a slot taken by tryAcquire or occupy.
+func (g *halfOpenGate) release() {
+	for {
+		taken := g.taken.Load()
+		if taken <= 0 || g.taken.CompareAndSwap(taken, taken-1) {
+			return
+		}
+	}
+}
+
+// free returns the number of the slots not taken, capped at math.MaxInt32 to fit in int on every platform.
+func (g *halfOpenGate) free() int {
+	return int(min(max(g.slots-g.taken.Load(), 0), math.MaxInt32))
+}
+
+// full reports whether all the slots are taken.
+func (g *halfOpenGate) full() bool {
+	return g.taken.Load() >= g.slots
+}
+
+// shed makes the gate reject the requests over the slots without the lock of the CircuitBreaker.
+func (g *halfOpenGate) shed() {
+	g.shedding.Store(true)
+}
+
+// sheds reports whether the gate rejects a request that finds no free slot without the lock.
+func (g *halfOpenGate) sheds() bool {
+	return g.shedding.Load()
+}
+
+// clone returns a copy of the gate for Simulate.
+func (g *halfOpenGate) clone() *halfOpenGate {
+	c := &halfOpenGate{slots: g.slots}
+	c.taken.Store(g.taken.Load())
+	c.shedding.Store(g.shedding.Load())
+	return c
+}
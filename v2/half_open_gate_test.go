@@ -0,0 +1,119 @@
+package gobreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHalfOpenGate(t *testing.T) {
+	g := newHalfOpenGate(2, 0)
+	assert.False(t, g.full())
+	assert.True(t, g.tryAcquire())
+	assert.True(t, g.tryAcquire())
+	assert.True(t, g.full())
+	assert.False(t, g.tryAcquire())
+	assert.Equal(t, 0, g.free())
+
+	// a slot occupied over the limit is freed before the gate opens again
+	g.occupy()
+	g.release()
+	assert.True(t, g.full())
+	g.release()
+	assert.False(t, g.full())
+	assert.True(t, g.tryAcquire())
+
+	// releasing a free gate has no effect
+	g.release()
+	g.release()
+	g.release()
+	assert.Equal(t, int64(0), g.taken.Load())
+	assert.Equal(t, 2, g.free())
+
+	assert.False(t, newHalfOpenGate(2, 1).full())
+	g = newHalfOpenGate(2, 3)
+	assert.True(t, g.full())
+	assert.Equal(t, 0, g.free())
+	assert.False(t, g.sheds())
+	g.shed()
+	assert.True(t, g.clone().sheds())
+	assert.Equal(t, int64(3), g.clone().taken.Load())
+}
+
+func TestHalfOpenGateObserveOnly(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxRequests: 1,
+		Timeout:     time.Second,
+		ObserveOnly: true,
+		IsExcluded:  isExcluded,
+		Clock:       clock,
+	})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	clock.advance(2 * time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	// the excluded requests free the slots of the half-open state in any order
+	done := make([]func(), 3)
+	for i := range done {
+		generation, age, err := cb.beforeRequest()
+		assert.NoError(t, err)
+		done[i] = func() { cb.afterRequest(generation, age, OutcomeExcluded, nil) }
+	}
+	assert.Equal(t, uint32(3), cb.halfOpenRequests())
+	for i := range done {
+		assert.True(t, cb.halfOpenGate.Load().full())
+		done[i]()
+	}
+	assert.Equal(t, uint32(0), cb.halfOpenRequests())
+	assert.False(t, cb.halfOpenGate.Load().full())
+}
+
+func TestHalfOpenGateSheds(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{MaxRequests: 1, Timeout: time.Second, Clock: clock})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	clock.advance(2 * time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	generation, age, err := cb.beforeRequest()
+	assert.NoError(t, err)
+
+	// the first rejection records the saturation under the lock
+	assert.Equal(t, ErrTooManyRequests, succeed(cb))
+	assert.True(t, cb.saturated)
+
+	// and the following ones are shed without the lock
+	cb.mutex.Lock()
+	shed := make(chan error)
+	go func() { shed <- succeed(cb) }()
+	select {
+	case err = <-shed:
+		assert.Equal(t, ErrTooManyRequests, err)
+	case <-time.After(time.Second):
+		t.Error("the rejection waited for the lock")
+	}
+	cb.mutex.Unlock()
+
+	// the gate is removed when the CircuitBreaker leaves the half-open state
+	cb.afterRequest(generation, age, OutcomeSuccess, nil)
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Nil(t, cb.halfOpenGate.Load())
+	assert.Nil(t, succeed(cb))
+
+	// or when Restore replaces the half-open state
+	closed := cb.Snapshot()
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	clock.advance(2 * time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.NotNil(t, cb.halfOpenGate.Load())
+	assert.NoError(t, cb.Restore(closed))
+	assert.Nil(t, cb.halfOpenGate.Load())
+}
@@ -0,0 +1,37 @@
+package gobreaker
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrRejected is wrapped by the error that a handler wrapped by WrapHandler returns
+// when the CircuitBreaker rejects a message, along with ErrOpenState or ErrTooManyRequests.
+var ErrRejected = errors.New("rejected by circuit breaker")
+
+// WrapHandler returns a handler of messages, e.g. of a Kafka or NATS consumer,
+// that runs h through cb, so that the consumer stops processing while the dependency called by h is unhealthy.
+// The error of h is classified by the Settings of cb and returned like the error of Execute,
+// i.e. wrapped in BreakerError with Settings.WrapErrors.
+//
+// If cb rejects a message, the returned handler returns an error that wraps ErrRejected
+// along with the rejection error of Execute without calling h. The consumer loop can check it with errors.Is to pause the subscription
+// or back off for a while, e.g. for CurrentTimeout, and redeliver the message afterwards.
+// Since a rejected message has not been processed at all, it should not count toward
+// the retries of the consumer nor be sent to a dead letter queue.
+// Conversely, retries of the consumer run through cb again, so a message failing repeatedly
+// counts as many failures.
+func WrapHandler[T, M any](cb *CircuitBreaker[T], h func(msg M) error) func(msg M) error {
+	return func(msg M) error {
+		state, generation, age, err := cb.admit()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrRejected, cb.rejectionError(state, err))
+		}
+
+		_, o, err := cb.run(generation, age, func() (T, error) {
+			var zero T
+			return zero, h(msg)
+		}, cb.classify)
+		return cb.requestError(state, o, err)
+	}
+}
@@ -0,0 +1,66 @@
+package gobreaker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapHandler(t *testing.T) {
+	cb := NewCircuitBreaker[any](Settings{})
+
+	var handled []int
+	errHandler := errors.New("handler")
+	handler := WrapHandler(cb, func(msg int) error {
+		handled = append(handled, msg)
+		if msg < 0 {
+			return errHandler
+		}
+		return nil
+	})
+
+	assert.NoError(t, handler(1))
+	for i := 0; i < 6; i++ {
+		assert.Equal(t, errHandler, handler(-1))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, Counts{}, cb.Counts())
+
+	err := handler(2)
+	assert.ErrorIs(t, err, ErrRejected)
+	assert.ErrorIs(t, err, ErrOpenState)
+	assert.Equal(t, []int{1, -1, -1, -1, -1, -1, -1}, handled)
+}
+
+func TestWrapHandlerWrapErrors(t *testing.T) {
+	cb := NewCircuitBreaker[any](Settings{Name: "consumer", WrapErrors: true})
+
+	errHandler := errors.New("handler")
+	handler := WrapHandler(cb, func(msg int) error {
+		if msg < 0 {
+			return errHandler
+		}
+		return nil
+	})
+
+	assert.NoError(t, handler(1))
+	err := handler(-1)
+	var be *BreakerError
+	assert.ErrorAs(t, err, &be)
+	assert.Equal(t, "consumer", be.Name)
+	assert.Equal(t, StateClosed, be.State)
+	assert.Equal(t, OutcomeFailure, be.Outcome)
+	assert.False(t, be.ShortCircuited)
+	assert.ErrorIs(t, err, errHandler)
+
+	for i := 0; i < 5; i++ {
+		assert.ErrorIs(t, handler(-1), errHandler)
+	}
+	err = handler(2)
+	assert.ErrorIs(t, err, ErrRejected)
+	assert.ErrorIs(t, err, ErrOpenState)
+	assert.ErrorAs(t, err, &be)
+	assert.Equal(t, StateOpen, be.State)
+	assert.True(t, be.ShortCircuited)
+}
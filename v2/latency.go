@@ -0,0 +1,194 @@
+package gobreaker
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Latencies holds the approximate percentiles of the durations of the requests counted in Counts,
+// measured by Settings.TrackLatency. Count is the number of the measured requests.
+// The percentiles are the upper bounds of the buckets of a histogram,
+// which overestimate the actual durations by less than 12.5%, and are zero if Count is 0.
+type Latencies struct {
+	Count uint32
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// latencySubBuckets is the number of the buckets of latencyHistogram per power of two microseconds.
+const latencySubBuckets = 8
+
+// latencyBins is the number of the buckets of latencyHistogram,
+// the last of which holds the durations longer than about six days.
+const latencyBins = 37 * latencySubBuckets
+
+// latencyHistogram counts durations in buckets whose widths grow exponentially,
+// in the manner of HDR histograms with a precision of three bits.
+type latencyHistogram [latencyBins]uint32
+
+// latencyBin returns the index of the bucket of latencyHistogram holding d.
+func latencyBin(d time.Duration) int {
+	us := uint64(max(d/time.Microsecond, 0))
+	if us < latencySubBuckets {
+		return int(us)
+	}
+	shift := bits.Len64(us) - 4
+	bin := (shift+1)*latencySubBuckets + int(us>>shift) - latencySubBuckets
+	return min(bin, latencyBins-1)
+}
+
+// latencyUpperBound returns the exclusive upper bound of the durations in the given bucket.
+func latencyUpperBound(bin int) time.Duration {
+	if bin < latencySubBuckets {
+		return time.Duration(bin+1) * time.Microsecond
+	}
+	shift := bin/latencySubBuckets - 1
+	m := bin%latencySubBuckets + latencySubBuckets
+	return time.Duration((m+1)<<shift) * time.Microsecond
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	if bin := latencyBin(d); h[bin] < math.MaxUint32 {
+		h[bin]++
+	}
+}
+
+func (h *latencyHistogram) subtract(other *latencyHistogram) {
+	for i, n := range other {
+		h[i] -= min(h[i], n)
+	}
+}
+
+func (h *latencyHistogram) clear() {
+	*h = latencyHistogram{}
+}
+
+// latencies returns the percentiles of the durations in the histogram.
+func (h *latencyHistogram) latencies() Latencies {
+	var count uint64
+	for _, n := range h {
+		count += uint64(n)
+	}
+	if count == 0 {
+		return Latencies{}
+	}
+
+	// percentile returns the upper bound of the bucket of the duration of the given rank.
+	percentile := func(q float64) time.Duration {
+		rank := uint64(math.Ceil(q * float64(count)))
+		var seen uint64
+		for i, n := range h {
+			seen += uint64(n)
+			if seen >= rank {
+				return latencyUpperBound(i)
+			}
+		}
+		return latencyUpperBound(latencyBins - 1)
+	}
+	return Latencies{
+		Count: uint32(min(count, math.MaxUint32)),
+		P50:   percentile(0.5),
+		P95:   percentile(0.95),
+		P99:   percentile(0.99),
+	}
+}
+
+// latencyTracker holds the durations of the requests counted in Counts.
+// total is the histogram of all the requests of the generation, like Counts.
+// In the closed state of the rolling window, buckets follow the buckets of the window,
+// and a bucket is subtracted from total when the window drops it.
+type latencyTracker struct {
+	total   latencyHistogram
+	buckets []latencyHistogram
+	start   time.Time
+	age     uint64
+}
+
+// reset clears the histograms for a new generation.
+func (lt *latencyTracker) reset() {
+	lt.total.clear()
+	lt.buckets = nil
+}
+
+// follow advances the buckets along with the given window, dropping the buckets it has dropped.
+// If the buckets don't match the window, e.g. because the window has been switched or started anew,
+// the buckets start anew with total in the bucket of the newest age.
+func (lt *latencyTracker) follow(w *rollingCounts) {
+	if w == nil {
+		lt.buckets = nil
+		return
+	}
+	if len(lt.buckets) != len(w.buckets) || !lt.start.Equal(w.start) || w.age < lt.age {
+		lt.buckets = make([]latencyHistogram, len(w.buckets))
+		lt.start = w.start
+		lt.age = w.age
+		lt.buckets[bucketIndex(w.age, len(lt.buckets))] = lt.total
+		return
+	}
+
+	expireBuckets(lt.age, w.age, len(lt.buckets), func(i int) {
+		lt.total.subtract(&lt.buckets[i])
+		lt.buckets[i].clear()
+	})
+	lt.age = w.age
+}
+
+// observe records the duration of a request counted in the bucket of the given age of the window, if any.
+func (lt *latencyTracker) observe(d time.Duration, w *rollingCounts, age uint64) {
+	lt.total.observe(d)
+	if w == nil || len(lt.buckets) == 0 || age > lt.age || lt.age-age >= uint64(len(lt.buckets)) {
+		return
+	}
+	lt.buckets[bucketIndex(age, len(lt.buckets))].observe(d)
+}
+
+// observeLatency records the duration of the request started at start and counted with the given outcome
+// in the bucket of the given age, if TrackLatency is set. Excluded requests are not recorded.
+// It must be called with the write lock held.
+func (cb *CircuitBreaker[T]) observeLatency(o Outcome, start, now time.Time, state State, age uint64) {
+	if cb.latency == nil || start.IsZero() || o == OutcomeExcluded {
+		return
+	}
+
+	var w *rollingCounts
+	if state == StateClosed {
+		w = cb.window
+	}
+	cb.latency.follow(w)
+	cb.latency.observe(now.Sub(start), w, age)
+}
+
+// tripsOnLatency reports whether ReadyToTripOnLatency returns true for the current Counts and Latencies.
+// It must be called with the write lock held in the closed state.
+func (cb *CircuitBreaker[T]) tripsOnLatency() bool {
+	if cb.latency == nil || cb.readyToTripOnLatency == nil {
+		return false
+	}
+	cb.latency.follow(cb.window)
+	return cb.readyToTripOnLatency(cb.tripCounts(), cb.latency.total.latencies())
+}
+
+// Latencies returns the approximate percentiles of the durations of the requests counted in Counts.
+// It returns zero Latencies if Settings.TrackLatency is false.
+func (cb *CircuitBreaker[T]) Latencies() Latencies {
+	if cb.latency == nil {
+		return Latencies{}
+	}
+
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	state, _, _ := cb.currentState(cb.clock.Now())
+	if state == StateClosed {
+		cb.latency.follow(cb.window)
+	}
+	return cb.latency.total.latencies()
+}
+
+// Latencies returns the approximate percentiles of the durations of the requests counted in Counts.
+// See CircuitBreaker.Latencies.
+func (tscb *TwoStepCircuitBreaker[T]) Latencies() Latencies {
+	return tscb.cb.Latencies()
+}
@@ -0,0 +1,128 @@
+package gobreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyBin(t *testing.T) {
+	assert.Equal(t, 0, latencyBin(-time.Second))
+	assert.Equal(t, 0, latencyBin(999*time.Nanosecond))
+	assert.Equal(t, latencyBins-1, latencyBin(365*24*time.Hour))
+
+	for d := time.Microsecond; d < 100*time.Hour; d = d*9/8 + time.Microsecond {
+		bin := latencyBin(d)
+		upper := latencyUpperBound(bin)
+		assert.Less(t, d, upper, d)
+		if bin > 0 {
+			assert.GreaterOrEqual(t, d, latencyUpperBound(bin-1), d)
+		}
+		if d >= latencySubBuckets*time.Microsecond {
+			assert.LessOrEqual(t, float64(upper-d)/float64(d), 0.125, d)
+		}
+	}
+}
+
+func newLatencyBreaker(clock *fakeClock, st Settings) (*CircuitBreaker[bool], func(d time.Duration, err error)) {
+	st.TrackLatency = true
+	st.IsExcluded = isExcluded
+	st.Clock = clock
+	cb := NewCircuitBreaker[bool](st)
+	return cb, func(d time.Duration, err error) {
+		cb.Execute(func() (bool, error) {
+			clock.advance(d)
+			return err == nil, err
+		})
+	}
+}
+
+func TestLatencies(t *testing.T) {
+	clock := newFakeClock()
+	cb, request := newLatencyBreaker(clock, Settings{})
+	assert.Equal(t, Latencies{}, cb.Latencies())
+
+	for i := 0; i < 97; i++ {
+		request(10*time.Millisecond, nil)
+	}
+	request(time.Second, errors.New("fail"))
+	request(time.Second, nil)
+	request(time.Second, nil)
+	request(time.Hour, errExcluded)
+
+	assert.Equal(t, Latencies{
+		Count: 100,
+		P50:   10240 * time.Microsecond,
+		P95:   10240 * time.Microsecond,
+		P99:   1048576 * time.Microsecond,
+	}, cb.Latencies())
+
+	cb.Reset()
+	assert.Equal(t, Latencies{}, cb.Latencies())
+
+	disabled := NewCircuitBreaker[bool](Settings{})
+	assert.Nil(t, disabled.latency)
+	assert.Equal(t, Latencies{}, disabled.Latencies())
+}
+
+func TestLatenciesRollingWindow(t *testing.T) {
+	clock := newFakeClock()
+	cb, request := newLatencyBreaker(clock, Settings{
+		Interval:     3 * time.Second,
+		BucketPeriod: time.Second,
+	})
+
+	request(500*time.Millisecond, nil)
+	clock.advance(500 * time.Millisecond)
+	request(10*time.Millisecond, nil)
+	request(10*time.Millisecond, nil)
+	assert.Equal(t, uint32(3), cb.Latencies().Count)
+	assert.Equal(t, 524288*time.Microsecond, cb.Latencies().P99)
+
+	// the bucket of the slow request is dropped
+	clock.advance(2 * time.Second)
+	assert.Equal(t, Latencies{
+		Count: 2,
+		P50:   10240 * time.Microsecond,
+		P95:   10240 * time.Microsecond,
+		P99:   10240 * time.Microsecond,
+	}, cb.Latencies())
+	assert.Equal(t, uint32(2), cb.Counts().Requests)
+
+	clock.advance(3 * time.Second)
+	assert.Equal(t, Latencies{}, cb.Latencies())
+}
+
+func TestReadyToTripOnLatency(t *testing.T) {
+	clock := newFakeClock()
+	var tripped []Counts
+	cb, request := newLatencyBreaker(clock, Settings{
+		ReadyToTripOnLatency: func(counts Counts, latencies Latencies) bool {
+			return latencies.Count >= 10 && latencies.P95 > 100*time.Millisecond
+		},
+		OnTrip: func(name string, lastErr error, counts Counts) {
+			tripped = append(tripped, counts)
+		},
+	})
+
+	for i := 0; i < 9; i++ {
+		request(time.Second, nil)
+	}
+	assert.Equal(t, StateClosed, cb.State())
+	request(time.Second, nil)
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, []Counts{{10, 10, 0, 10, 0, 0, 0}}, tripped)
+
+	// the durations start anew with the generation
+	clock.advance(defaultTimeout + time.Second)
+	request(10*time.Millisecond, nil)
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Latencies{}, cb.Latencies())
+	for i := 0; i < 10; i++ {
+		request(10*time.Millisecond, nil)
+	}
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, uint32(10), cb.Latencies().Count)
+}
@@ -0,0 +1,106 @@
+package gobreaker
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics holds the observations of the requests of CircuitBreaker, which don't affect its state.
+//
+// QueueTime and ExecutionTime are the timing breakdown, measured if Settings.MeasureTiming is true.
+// QueueTime is the moving average of the time a request waits for the lock of the CircuitBreaker
+// before it is admitted or rejected; it grows when the CircuitBreaker itself is the bottleneck.
+// ExecutionTime is the moving average of the time a request run by Execute or its variants takes.
+// The durations are measured with the system clock regardless of Settings.Clock.
+//
+// RetriedSuccesses is the number of the calls of ExecuteWithRetry that succeeded after retrying.
+// RetryExhausted is the number of the calls of ExecuteWithRetry whose last attempt failed
+// after all the attempts of the RetryPolicy had been made.
+// The calls stopped by the CircuitBreaker or by the context are counted in neither.
+// Unlike Counts, they are never cleared.
+//
+// Satisfied, Tolerating and Frustrated are the numbers of the requests in each band of Apdex,
+// measured if Settings.ApdexTarget is greater than 0. They are never cleared either.
+// Apdex is the score computed from them, (Satisfied + Tolerating/2) / (Satisfied + Tolerating + Frustrated),
+// from 0 to 1. It is 0 if no request has been measured.
+type Metrics struct {
+	QueueTime        time.Duration
+	ExecutionTime    time.Duration
+	RetriedSuccesses uint64
+	RetryExhausted   uint64
+	Satisfied        uint64
+	Tolerating       uint64
+	Frustrated       uint64
+	Apdex            float64
+}
+
+// Metrics returns the observations of the requests.
+func (cb *CircuitBreaker[T]) Metrics() Metrics {
+	var m Metrics
+	if cb.timing != nil {
+		m = cb.timing.metrics()
+	}
+	m.RetriedSuccesses = cb.retries.retriedSuccesses.Load()
+	m.RetryExhausted = cb.retries.retryExhausted.Load()
+	if cb.apdex != nil {
+		cb.apdex.metrics(&m)
+	}
+	return m
+}
+
+// retryCounters counts the outcomes of ExecuteWithRetry for Metrics.
+type retryCounters struct {
+	retriedSuccesses atomic.Uint64
+	retryExhausted   atomic.Uint64
+}
+
+// timingWeight is the reciprocal of the weight of a new sample in the moving averages.
+const timingWeight = 8
+
+// timing measures the moving averages of Metrics.
+// It has its own lock so as not to contend with the lock of the CircuitBreaker.
+type timing struct {
+	mutex     sync.Mutex
+	queue     movingAverage
+	execution movingAverage
+}
+
+func (t *timing) observeQueue(d time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.queue.observe(d)
+}
+
+func (t *timing) observeExecution(d time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.execution.observe(d)
+}
+
+func (t *timing) metrics() Metrics {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return Metrics{
+		QueueTime:     t.queue.value,
+		ExecutionTime: t.execution.value,
+	}
+}
+
+// movingAverage is an exponentially weighted moving average of durations.
+type movingAverage struct {
+	value    time.Duration
+	observed bool
+}
+
+func (a *movingAverage) observe(d time.Duration) {
+	if !a.observed {
+		a.value = d
+		a.observed = true
+		return
+	}
+	a.value += (d - a.value) / timingWeight
+}
@@ -0,0 +1,159 @@
+// Package metrics provides a Prometheus collector for gobreaker.
+// It is a separate module so that the core of gobreaker doesn't depend on Prometheus.
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sony/gobreaker/v2"
+)
+
+// Breaker is the part of CircuitBreaker read by Collector at scrape time.
+// *gobreaker.CircuitBreaker[T] and *gobreaker.TwoStepCircuitBreaker[T] implement it for any T.
+type Breaker interface {
+	Name() string
+	State() gobreaker.State
+	Counts() gobreaker.Counts
+}
+
+// Collector is a prometheus.Collector that reports the state and Counts of any number of CircuitBreakers,
+// labeled by their names, so that a single Collector is registered however many breakers there are.
+//
+// The state is reported as a gauge whose value is the gobreaker.State, i.e. 0 for closed, 1 for half-open, 2 for open,
+// 3 for forced open and 4 for forced closed.
+// The numbers of Counts are reported as gauges rather than counters, since CircuitBreaker clears Counts
+// on the change of the state and at the closed-state intervals.
+// The state transitions are reported as a counter labeled by the states before and after,
+// which counts the transitions notified by the function returned by OnStateChange.
+type Collector struct {
+	mutex    sync.RWMutex
+	breakers map[string]Breaker
+
+	state       *prometheus.Desc
+	requests    *prometheus.Desc
+	successes   *prometheus.Desc
+	failures    *prometheus.Desc
+	exclusions  *prometheus.Desc
+	transitions *prometheus.CounterVec
+}
+
+// Option configures Collector.
+type Option func(*options)
+
+type options struct {
+	namespace   string
+	constLabels prometheus.Labels
+}
+
+// WithNamespace sets the namespace of the metric names, e.g. "myapp" for "myapp_gobreaker_state".
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithConstLabels sets the labels with fixed values added to all the metrics.
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(o *options) {
+		o.constLabels = labels
+	}
+}
+
+// NewCollector returns a new Collector that reports cb.
+// More CircuitBreakers can be added to the Collector by Add.
+func NewCollector[T any](cb *gobreaker.CircuitBreaker[T], opts ...Option) *Collector {
+	c := newCollector(opts...)
+	c.Add(cb)
+	return c
+}
+
+// NewEmptyCollector returns a new Collector that reports no CircuitBreakers until they are added by Add.
+func NewEmptyCollector(opts ...Option) *Collector {
+	return newCollector(opts...)
+}
+
+func newCollector(opts ...Option) *Collector {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(o.namespace, "gobreaker", name), help, []string{"name"}, o.constLabels)
+	}
+	return &Collector{
+		breakers:   make(map[string]Breaker),
+		state:      desc("state", "The state of the circuit breaker: 0 closed, 1 half-open, 2 open, 3 forced open, 4 forced closed."),
+		requests:   desc("requests", "The number of requests in the current generation of Counts."),
+		successes:  desc("successes", "The number of successes in the current generation of Counts."),
+		failures:   desc("failures", "The number of failures in the current generation of Counts."),
+		exclusions: desc("exclusions", "The number of exclusions in the current generation of Counts."),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   o.namespace,
+			Subsystem:   "gobreaker",
+			Name:        "state_transitions_total",
+			Help:        "The number of the transitions of the state of the circuit breaker.",
+			ConstLabels: o.constLabels,
+		}, []string{"name", "from", "to"}),
+	}
+}
+
+// Add adds cb to the breakers reported by the Collector, replacing the one of the same name, if any.
+func (c *Collector) Add(cb Breaker) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.breakers[cb.Name()] = cb
+}
+
+// Remove removes the CircuitBreaker of the given name from the breakers reported by the Collector,
+// along with its state transitions.
+func (c *Collector) Remove(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.breakers, name)
+	c.transitions.DeletePartialMatch(prometheus.Labels{"name": name})
+}
+
+// OnStateChange returns a function for Settings.OnStateChange that counts the state transitions
+// and then calls next, if not nil, e.g. the OnStateChange the user would have set otherwise.
+func (c *Collector) OnStateChange(next func(name string, from gobreaker.State, to gobreaker.State)) func(name string, from gobreaker.State, to gobreaker.State) {
+	return func(name string, from gobreaker.State, to gobreaker.State) {
+		c.transitions.WithLabelValues(name, from.String(), to.String()).Inc()
+		if next != nil {
+			next(name, from, to)
+		}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.state
+	ch <- c.requests
+	ch <- c.successes
+	ch <- c.failures
+	ch <- c.exclusions
+	c.transitions.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.RLock()
+	breakers := make([]Breaker, 0, len(c.breakers))
+	for _, cb := range c.breakers {
+		breakers = append(breakers, cb)
+	}
+	c.mutex.RUnlock()
+
+	for _, cb := range breakers {
+		name, state, counts := cb.Name(), cb.State(), cb.Counts()
+		ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, float64(state), name)
+		ch <- prometheus.MustNewConstMetric(c.requests, prometheus.GaugeValue, float64(counts.Requests), name)
+		ch <- prometheus.MustNewConstMetric(c.successes, prometheus.GaugeValue, float64(counts.TotalSuccesses), name)
+		ch <- prometheus.MustNewConstMetric(c.failures, prometheus.GaugeValue, float64(counts.TotalFailures), name)
+		ch <- prometheus.MustNewConstMetric(c.exclusions, prometheus.GaugeValue, float64(counts.TotalExclusions), name)
+	}
+	c.transitions.Collect(ch)
+}
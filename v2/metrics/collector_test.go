@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sony/gobreaker/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	var changes []gobreaker.State
+	c := NewEmptyCollector(WithNamespace("test"))
+	onStateChange := c.OnStateChange(func(name string, from gobreaker.State, to gobreaker.State) {
+		changes = append(changes, to)
+	})
+
+	cb := gobreaker.NewCircuitBreaker[int](gobreaker.Settings{
+		Name:          "db",
+		OnStateChange: onStateChange,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= 2
+		},
+	})
+	tscb := gobreaker.NewTwoStepCircuitBreaker[string](gobreaker.Settings{
+		Name:          "api",
+		OnStateChange: onStateChange,
+	})
+	c.Add(cb)
+	c.Add(tscb)
+
+	_, _ = cb.Execute(func() (int, error) { return 0, errors.New("fail") })
+	_, _ = cb.Execute(func() (int, error) { return 0, errors.New("fail") })
+	done, err := tscb.Allow()
+	assert.NoError(t, err)
+	done(true)
+
+	registry := prometheus.NewPedanticRegistry()
+	assert.NoError(t, registry.Register(c))
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP test_gobreaker_failures The number of failures in the current generation of Counts.
+# TYPE test_gobreaker_failures gauge
+test_gobreaker_failures{name="api"} 0
+test_gobreaker_failures{name="db"} 0
+# HELP test_gobreaker_requests The number of requests in the current generation of Counts.
+# TYPE test_gobreaker_requests gauge
+test_gobreaker_requests{name="api"} 1
+test_gobreaker_requests{name="db"} 0
+# HELP test_gobreaker_state The state of the circuit breaker: 0 closed, 1 half-open, 2 open, 3 forced open, 4 forced closed.
+# TYPE test_gobreaker_state gauge
+test_gobreaker_state{name="api"} 0
+test_gobreaker_state{name="db"} 2
+# HELP test_gobreaker_state_transitions_total The number of the transitions of the state of the circuit breaker.
+# TYPE test_gobreaker_state_transitions_total counter
+test_gobreaker_state_transitions_total{from="closed",name="db",to="open"} 1
+`), "test_gobreaker_failures", "test_gobreaker_requests", "test_gobreaker_state", "test_gobreaker_state_transitions_total"))
+	assert.Equal(t, []gobreaker.State{gobreaker.StateOpen}, changes)
+
+	c.Remove("db")
+	assert.Equal(t, 5, testutil.CollectAndCount(c))
+}
+
+func TestNewCollector(t *testing.T) {
+	cb := gobreaker.NewCircuitBreaker[int](gobreaker.Settings{Name: "cb"})
+	_, _ = cb.Execute(func() (int, error) { return 1, nil })
+
+	c := NewCollector(cb, WithConstLabels(prometheus.Labels{"service": "web"}))
+	assert.Equal(t, 5, testutil.CollectAndCount(c))
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP gobreaker_successes The number of successes in the current generation of Counts.
+# TYPE gobreaker_successes gauge
+gobreaker_successes{name="cb",service="web"} 1
+`), "gobreaker_successes"))
+}
@@ -0,0 +1,66 @@
+package gobreaker
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsDisabled(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{})
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, Metrics{}, cb.Metrics())
+}
+
+func TestMetricsExecutionTime(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{MeasureTiming: true})
+
+	_, err := cb.Execute(func() (bool, error) {
+		time.Sleep(10 * time.Millisecond)
+		return true, nil
+	})
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, cb.Metrics().ExecutionTime, 10*time.Millisecond)
+
+	// the moving average decreases gradually with fast requests
+	before := cb.Metrics().ExecutionTime
+	assert.Nil(t, succeed(cb))
+	after := cb.Metrics().ExecutionTime
+	assert.Less(t, after, before)
+	assert.Greater(t, after, before/2)
+}
+
+func TestMetricsQueueTime(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{MeasureTiming: true})
+	assert.Nil(t, succeed(cb))
+	idle := cb.Metrics().QueueTime
+
+	// hold the lock to make the requests queue
+	cb.mutex.Lock()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, succeed(cb))
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	cb.mutex.Unlock()
+	wg.Wait()
+
+	assert.Greater(t, cb.Metrics().QueueTime, idle)
+	assert.GreaterOrEqual(t, cb.Metrics().QueueTime, 2*time.Millisecond)
+}
+
+func TestMovingAverage(t *testing.T) {
+	var a movingAverage
+	a.observe(80 * time.Millisecond)
+	assert.Equal(t, 80*time.Millisecond, a.value)
+	a.observe(0)
+	assert.Equal(t, 70*time.Millisecond, a.value)
+	a.observe(150 * time.Millisecond)
+	assert.Equal(t, 80*time.Millisecond, a.value)
+}
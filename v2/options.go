@@ -0,0 +1,122 @@
+package gobreaker
+
+import "time"
+
+// Option configures the Settings of a CircuitBreaker of the result type T
+// for NewCircuitBreakerWithOptions and NewTwoStepCircuitBreakerWithOptions.
+// The options taking a result take it as T rather than any, e.g. WithIsSuccessfulResult.
+// Options are applied in order, so a later option overrides an earlier one of the same field.
+type Option[T any] func(st *Settings)
+
+// NewCircuitBreakerWithOptions returns a new CircuitBreaker configured with the given options
+// applied to zero Settings. It is interchangeable with NewCircuitBreaker:
+// NewCircuitBreakerWithOptions(WithSettings[T](st)) is the same as NewCircuitBreaker[T](st).
+func NewCircuitBreakerWithOptions[T any](opts ...Option[T]) *CircuitBreaker[T] {
+	return NewCircuitBreaker[T](settingsOf(opts))
+}
+
+// NewTwoStepCircuitBreakerWithOptions returns a new TwoStepCircuitBreaker configured with the given options.
+// See NewCircuitBreakerWithOptions.
+func NewTwoStepCircuitBreakerWithOptions[T any](opts ...Option[T]) *TwoStepCircuitBreaker[T] {
+	return NewTwoStepCircuitBreaker[T](settingsOf(opts))
+}
+
+// settingsOf returns zero Settings with the given options applied.
+func settingsOf[T any](opts []Option[T]) Settings {
+	var st Settings
+	for _, opt := range opts {
+		opt(&st)
+	}
+	return st
+}
+
+// WithSettings replaces the Settings configured so far with st,
+// e.g. as the first option to start from shared Settings and override some of them.
+func WithSettings[T any](st Settings) Option[T] {
+	return func(s *Settings) {
+		*s = st
+	}
+}
+
+// WithName sets Settings.Name.
+func WithName[T any](name string) Option[T] {
+	return func(st *Settings) {
+		st.Name = name
+	}
+}
+
+// WithMaxRequests sets Settings.MaxRequests.
+func WithMaxRequests[T any](maxRequests uint32) Option[T] {
+	return func(st *Settings) {
+		st.MaxRequests = maxRequests
+	}
+}
+
+// WithInterval sets Settings.Interval.
+func WithInterval[T any](interval time.Duration) Option[T] {
+	return func(st *Settings) {
+		st.Interval = interval
+	}
+}
+
+// WithTimeout sets Settings.Timeout.
+func WithTimeout[T any](timeout time.Duration) Option[T] {
+	return func(st *Settings) {
+		st.Timeout = timeout
+	}
+}
+
+// WithReadyToTrip sets Settings.ReadyToTrip.
+func WithReadyToTrip[T any](readyToTrip func(counts Counts) bool) Option[T] {
+	return func(st *Settings) {
+		st.ReadyToTrip = readyToTrip
+	}
+}
+
+// WithOnStateChange sets Settings.OnStateChange.
+func WithOnStateChange[T any](onStateChange func(name string, from State, to State)) Option[T] {
+	return func(st *Settings) {
+		st.OnStateChange = onStateChange
+	}
+}
+
+// WithIsSuccessful sets Settings.IsSuccessful.
+func WithIsSuccessful[T any](isSuccessful func(err error) bool) Option[T] {
+	return func(st *Settings) {
+		st.IsSuccessful = isSuccessful
+	}
+}
+
+// WithIsSuccessfulResult sets Settings.IsSuccessfulResult to isSuccessful called with the result as T.
+func WithIsSuccessfulResult[T any](isSuccessful func(result T, err error) bool) Option[T] {
+	return func(st *Settings) {
+		st.IsSuccessfulResult = typedResult(isSuccessful)
+	}
+}
+
+// WithResultMatters sets Settings.ResultMatters.
+func WithResultMatters[T any](resultMatters bool) Option[T] {
+	return func(st *Settings) {
+		st.ResultMatters = resultMatters
+	}
+}
+
+// WithIsExcludedResult sets Settings.IsExcludedResult to isExcluded called with the result as T.
+func WithIsExcludedResult[T any](isExcluded func(result T, err error) bool) Option[T] {
+	return func(st *Settings) {
+		st.IsExcludedResult = typedResult(isExcluded)
+	}
+}
+
+// typedResult adapts f to the functions of Settings taking the result as any.
+// The result of a CircuitBreaker of T is always a T, except for nil of an interface type T,
+// for which f is called with the zero value of T, i.e. nil as well.
+func typedResult[T any](f func(result T, err error) bool) func(result any, err error) bool {
+	if f == nil {
+		return nil
+	}
+	return func(result any, err error) bool {
+		r, _ := result.(T)
+		return f(r, err)
+	}
+}
@@ -0,0 +1,90 @@
+package gobreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type response struct {
+	status int
+}
+
+func TestNewCircuitBreakerWithOptions(t *testing.T) {
+	var changes []StateChange
+	cb := NewCircuitBreakerWithOptions[*response](
+		WithName[*response]("api"),
+		WithMaxRequests[*response](2),
+		WithInterval[*response](time.Minute),
+		WithTimeout[*response](10*time.Second),
+		WithReadyToTrip[*response](func(counts Counts) bool { return counts.ConsecutiveFailures >= 2 }),
+		WithOnStateChange[*response](func(name string, from State, to State) {
+			changes = append(changes, StateChange{name, from, to})
+		}),
+		WithIsSuccessfulResult(func(resp *response, err error) bool {
+			return err == nil && resp != nil && resp.status < 500
+		}),
+		WithIsExcludedResult(func(resp *response, err error) bool {
+			return resp != nil && resp.status == 429
+		}),
+	)
+
+	v := cb.Settings()
+	assert.Equal(t, "api", v.Name)
+	assert.Equal(t, uint32(2), v.MaxRequests)
+	assert.Equal(t, time.Minute, v.Interval)
+	assert.Equal(t, 10*time.Second, v.Timeout)
+
+	request := func(resp *response) {
+		_, err := cb.Execute(func() (*response, error) { return resp, nil })
+		assert.NoError(t, err)
+	}
+	request(&response{200})
+	request(&response{429})
+	request(nil)
+	assert.Equal(t, Counts{3, 1, 1, 0, 1, 1, 1}, cb.Counts())
+	request(&response{503})
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, []StateChange{{"api", StateClosed, StateOpen}}, changes)
+}
+
+func TestOptionsInterchangeable(t *testing.T) {
+	st := Settings{
+		Name:         "shared",
+		MaxRequests:  3,
+		Timeout:      time.Second,
+		IsSuccessful: func(err error) bool { return err == nil },
+	}
+	assert.Equal(t,
+		NewCircuitBreaker[int](st).Settings(),
+		NewCircuitBreakerWithOptions(WithSettings[int](st)).Settings())
+
+	// the options after WithSettings override it
+	tscb := NewTwoStepCircuitBreakerWithOptions(
+		WithSettings[int](st),
+		WithTimeout[int](time.Minute),
+		WithIsSuccessful[int](nil),
+		WithIsSuccessfulResult(func(result int, err error) bool { return result > 0 }),
+		WithResultMatters[int](true),
+	)
+	v := tscb.Settings()
+	assert.Equal(t, "shared", v.Name)
+	assert.Equal(t, time.Minute, v.Timeout)
+	assert.True(t, v.ResultMatters)
+	assert.Equal(t, []string{"IsSuccessfulResult"}, v.Callbacks)
+
+	assert.Nil(t, typedResult[int](nil))
+}
+
+func TestTypedResultOfInterface(t *testing.T) {
+	cb := NewCircuitBreakerWithOptions(
+		WithIsSuccessfulResult(func(result error, err error) bool { return result == nil }),
+	)
+	_, err := cb.Execute(func() (error, error) { return nil, nil })
+	assert.NoError(t, err)
+	_, err = cb.Execute(func() (error, error) { return errors.New("result"), nil })
+	assert.NoError(t, err)
+	assert.Equal(t, Counts{2, 1, 1, 0, 1, 0, 1}, cb.Counts())
+}
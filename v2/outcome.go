@@ -0,0 +1,54 @@
+package gobreaker
+
+import "time"
+
+// OutcomeInfo describes a request whose outcome has been counted, for Settings.OnOutcome.
+//
+// Duration is the time the request took, measured with Settings.Clock from when it was admitted.
+// It is zero for an intermediate failure of a stream reported by the onEvent callback of StreamAllow.
+// Generation is the generation in which the outcome was counted.
+// State is the state of the CircuitBreaker after the outcome was counted,
+// and Transitioned reports whether the outcome changed the state, e.g. by tripping the CircuitBreaker.
+type OutcomeInfo struct {
+	Name         string
+	Outcome      Outcome
+	Duration     time.Duration
+	Generation   uint64
+	State        State
+	Transitioned bool
+}
+
+// startTime returns the time to measure the duration of a request from,
+// or the zero time if the duration is not used.
+func (cb *CircuitBreaker[T]) startTime() time.Time {
+	if cb.onOutcome == nil && cb.apdex == nil && cb.halfOpenLatency == 0 && cb.latency == nil {
+		return time.Time{}
+	}
+	return cb.clock.Now()
+}
+
+// tooSlow reports whether the request started at start and finished at now
+// is slower than HalfOpenSuccessLatency.
+func (cb *CircuitBreaker[T]) tooSlow(start, now time.Time) bool {
+	return cb.halfOpenLatency > 0 && !start.IsZero() && now.Sub(start) > cb.halfOpenLatency
+}
+
+// notifyOutcome schedules OnOutcome for the outcome counted in the given generation and state
+// of the request started at the given time.
+func (cb *CircuitBreaker[T]) notifyOutcome(o Outcome, start, now time.Time, generation uint64, state State) {
+	if cb.onOutcome == nil {
+		return
+	}
+
+	info := OutcomeInfo{
+		Name:         cb.name,
+		Outcome:      o,
+		Generation:   generation,
+		State:        cb.state,
+		Transitioned: cb.state != state,
+	}
+	if !start.IsZero() {
+		info.Duration = now.Sub(start)
+	}
+	cb.callback(func() { cb.onOutcome(info) })
+}
@@ -0,0 +1,72 @@
+package gobreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnOutcome(t *testing.T) {
+	clock := newFakeClock()
+	var infos []OutcomeInfo
+	cb := NewCircuitBreaker[bool](Settings{
+		Name: "cb",
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 2
+		},
+		IsExcluded: isExcluded,
+		OnOutcome: func(info OutcomeInfo) {
+			infos = append(infos, info)
+		},
+		Clock: clock,
+	})
+
+	request := func(d time.Duration, err error) {
+		cb.Execute(func() (bool, error) {
+			clock.advance(d)
+			return err == nil, err
+		})
+	}
+	request(time.Second, nil)
+	request(2*time.Second, errExcluded)
+	request(3*time.Second, errors.New("fail"))
+	request(4*time.Second, errors.New("fail"))
+
+	assert.Equal(t, []OutcomeInfo{
+		{"cb", OutcomeSuccess, time.Second, 1, StateClosed, false},
+		{"cb", OutcomeExcluded, 2 * time.Second, 1, StateClosed, false},
+		{"cb", OutcomeFailure, 3 * time.Second, 1, StateClosed, false},
+		{"cb", OutcomeFailure, 4 * time.Second, 1, StateOpen, true},
+	}, infos)
+
+	// the rejected requests are not reported
+	request(time.Second, nil)
+	assert.Len(t, infos, 4)
+
+	// the recovery is reported in the generation of the half-open state
+	clock.advance(defaultTimeout + time.Second)
+	tscb := &TwoStepCircuitBreaker[bool]{cb: cb}
+	done, err := tscb.Allow()
+	assert.NoError(t, err)
+	clock.advance(5 * time.Second)
+	done(true)
+	assert.Equal(t, OutcomeInfo{"cb", OutcomeSuccess, 5 * time.Second, 3, StateClosed, true}, infos[4])
+}
+
+func TestOnOutcomeDiscarded(t *testing.T) {
+	var infos []OutcomeInfo
+	cb := NewCircuitBreaker[bool](Settings{
+		OnOutcome: func(info OutcomeInfo) {
+			infos = append(infos, info)
+		},
+	})
+
+	_, err := cb.Execute(func() (bool, error) {
+		cb.Reset()
+		return true, nil
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, infos)
+}
@@ -0,0 +1,84 @@
+package gobreaker
+
+// ForceOpen places the CircuitBreaker into StateForcedOpen regardless of Counts,
+// e.g. to shed the load of a dependency during an incident.
+// In StateForcedOpen, all requests are rejected with ErrOpenState, even with ObserveOnly,
+// and the state doesn't change at the end of Timeout; only ClearOverride, ForceClose and Reset end it.
+// OnStateChange is called if the state changes.
+func (cb *CircuitBreaker[T]) ForceOpen() {
+	cb.force(StateForcedOpen)
+}
+
+// ForceClose places the CircuitBreaker into StateForcedClosed regardless of Counts.
+// In StateForcedClosed, all requests are accepted, without the limit of MaxConcurrentRequests,
+// and their outcomes are counted but ReadyToTrip is never called.
+// Only ClearOverride, ForceOpen and Reset end StateForcedClosed.
+// OnStateChange is called if the state changes.
+func (cb *CircuitBreaker[T]) ForceClose() {
+	cb.force(StateForcedClosed)
+}
+
+// ClearOverride returns the CircuitBreaker forced by ForceOpen or ForceClose to the automatic behavior.
+// StateForcedOpen becomes StateOpen, which lasts for the period of the open state as if the CircuitBreaker had just tripped,
+// and StateForcedClosed becomes StateClosed. Both start a new generation with cleared Counts.
+// OnStateChange is called if the state changes.
+func (cb *CircuitBreaker[T]) ClearOverride() {
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	now := cb.clock.Now()
+	switch state, _, _ := cb.currentState(now); state {
+	case StateForcedOpen:
+		cb.setState(StateOpen, now)
+	case StateForcedClosed:
+		cb.setState(StateClosed, now)
+	}
+}
+
+func (cb *CircuitBreaker[T]) force(state State) {
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	now := cb.clock.Now()
+	cb.currentState(now)
+	cb.setState(state, now)
+}
+
+// ForceOpen places the shared state into StateForcedOpen, so that every instance sharing it
+// rejects the requests until the override is ended. See CircuitBreaker.ForceOpen.
+// It returns the error of SharedDataStore if the shared state can't be updated.
+func (dcb *DistributedCircuitBreaker[T]) ForceOpen() error {
+	return dcb.updateShared(dcb.CircuitBreaker.ForceOpen)
+}
+
+// ForceClose places the shared state into StateForcedClosed, so that every instance sharing it
+// accepts the requests until the override is ended. See CircuitBreaker.ForceClose.
+// It returns the error of SharedDataStore if the shared state can't be updated.
+func (dcb *DistributedCircuitBreaker[T]) ForceClose() error {
+	return dcb.updateShared(dcb.CircuitBreaker.ForceClose)
+}
+
+// ClearOverride returns the shared state forced by ForceOpen or ForceClose of any instance
+// to the automatic behavior. See CircuitBreaker.ClearOverride.
+// It returns the error of SharedDataStore if the shared state can't be updated.
+func (dcb *DistributedCircuitBreaker[T]) ClearOverride() error {
+	return dcb.updateShared(dcb.CircuitBreaker.ClearOverride)
+}
+
+// ForceOpen places the TwoStepCircuitBreaker into StateForcedOpen.
+// See CircuitBreaker.ForceOpen.
+func (tscb *TwoStepCircuitBreaker[T]) ForceOpen() {
+	tscb.cb.ForceOpen()
+}
+
+// ForceClose places the TwoStepCircuitBreaker into StateForcedClosed.
+// See CircuitBreaker.ForceClose.
+func (tscb *TwoStepCircuitBreaker[T]) ForceClose() {
+	tscb.cb.ForceClose()
+}
+
+// ClearOverride returns the TwoStepCircuitBreaker to the automatic behavior.
+// See CircuitBreaker.ClearOverride.
+func (tscb *TwoStepCircuitBreaker[T]) ClearOverride() {
+	tscb.cb.ClearOverride()
+}
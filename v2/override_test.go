@@ -0,0 +1,106 @@
+package gobreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForceOpen(t *testing.T) {
+	clock := newFakeClock()
+	var changes []StateChange
+	cb := NewCircuitBreaker[bool](Settings{
+		Name:        "cb",
+		Timeout:     10 * time.Second,
+		ObserveOnly: true,
+		OnStateChange: func(name string, from State, to State) {
+			changes = append(changes, StateChange{name, from, to})
+		},
+		Clock: clock,
+	})
+
+	opened := cb.OpenedChan()
+	cb.ForceOpen()
+	assert.Equal(t, StateForcedOpen, cb.State())
+	assert.Equal(t, ErrOpenState, succeed(cb))
+	assert.Equal(t, Counts{}, cb.Counts())
+	select {
+	case <-opened:
+	default:
+		t.Error("OpenedChan is not closed")
+	}
+
+	// the timeout doesn't end the forced state
+	clock.advance(time.Hour)
+	assert.Equal(t, StateForcedOpen, cb.State())
+
+	cb.ClearOverride()
+	assert.Equal(t, StateOpen, cb.State())
+	clock.advance(11 * time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	assert.Equal(t, []StateChange{
+		{"cb", StateClosed, StateForcedOpen},
+		{"cb", StateForcedOpen, StateOpen},
+		{"cb", StateOpen, StateHalfOpen},
+	}, changes)
+}
+
+func TestForceClose(t *testing.T) {
+	var changes []StateChange
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{
+		Name:                  "cb",
+		MaxConcurrentRequests: 1,
+		OnStateChange: func(name string, from State, to State) {
+			changes = append(changes, StateChange{name, from, to})
+		},
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail2Step(tscb))
+	}
+	assert.Equal(t, StateOpen, tscb.State())
+
+	tscb.ForceClose()
+	assert.Equal(t, StateForcedClosed, tscb.State())
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, fail2Step(tscb))
+	}
+	assert.Nil(t, succeed2Step(tscb))
+	assert.Equal(t, StateForcedClosed, tscb.State())
+	assert.Equal(t, Counts{11, 1, 10, 1, 0, 0, 10}, tscb.Counts())
+
+	// all requests pass regardless of MaxConcurrentRequests
+	done1, err := tscb.Allow()
+	assert.NoError(t, err)
+	done2, err := tscb.Allow()
+	assert.NoError(t, err)
+	done1(true)
+	done2(true)
+
+	tscb.ForceOpen()
+	assert.Equal(t, StateForcedOpen, tscb.State())
+	tscb.ForceClose()
+	tscb.ClearOverride()
+	assert.Equal(t, StateClosed, tscb.State())
+	assert.Equal(t, Counts{}, tscb.Counts())
+
+	// ClearOverride has no effect without an override
+	tscb.ClearOverride()
+	assert.Equal(t, StateClosed, tscb.State())
+
+	tscb.ForceOpen()
+	tscb.Reset()
+	assert.Equal(t, StateClosed, tscb.State())
+
+	assert.Equal(t, []StateChange{
+		{"cb", StateClosed, StateOpen},
+		{"cb", StateOpen, StateForcedClosed},
+		{"cb", StateForcedClosed, StateForcedOpen},
+		{"cb", StateForcedOpen, StateForcedClosed},
+		{"cb", StateForcedClosed, StateClosed},
+		{"cb", StateClosed, StateForcedOpen},
+		{"cb", StateForcedOpen, StateClosed},
+	}, changes)
+}
@@ -0,0 +1,95 @@
+package gobreaker
+
+// Probe runs the given request as a synthetic probe if the CircuitBreaker would accept a request.
+// Unlike Execute, the probe neither counts toward Counts nor occupies a slot of the half-open state,
+// so it never affects the state of the CircuitBreaker.
+// Its outcome is recorded only in ProbeCounts.
+// Probe reports whether the request ran; if not, err is the error of the rejection.
+// If a panic occurs in the request, Probe records it as a failure and causes the same panic again.
+func (cb *CircuitBreaker[T]) Probe(req func() (T, error)) (result T, ran bool, err error) {
+	err = cb.beforeProbe()
+	if err != nil {
+		return result, false, err
+	}
+
+	result, err = cb.probe(req)
+	return result, true, err
+}
+
+// Probe runs the given request as a synthetic probe if the shared state would accept a request.
+// See CircuitBreaker.Probe.
+// The shared state is read, and written if a transition is due, before the probe runs,
+// but the outcome of the probe is recorded only in ProbeCounts of this instance.
+// The errors of SharedDataStore are returned as they are, without running the request.
+func (dcb *DistributedCircuitBreaker[T]) Probe(req func() (T, error)) (result T, ran bool, err error) {
+	var probeErr error
+	err = dcb.updateShared(func() {
+		probeErr = dcb.beforeProbe()
+	})
+	if err != nil {
+		return result, false, err
+	}
+	if probeErr != nil {
+		return result, false, probeErr
+	}
+
+	result, err = dcb.probe(req)
+	return result, true, err
+}
+
+// probe runs the request admitted by beforeProbe and records its outcome.
+func (cb *CircuitBreaker[T]) probe(req func() (T, error)) (T, error) {
+	defer func() {
+		e := recover()
+		if e != nil {
+			cb.afterProbe(OutcomeFailure)
+			panic(e)
+		}
+	}()
+
+	result, err := req()
+	cb.afterProbe(cb.classify(result, err))
+	return result, err
+}
+
+// ProbeCounts returns the counters of the requests run by Probe.
+// Unlike Counts, they are never cleared.
+func (cb *CircuitBreaker[T]) ProbeCounts() Counts {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	return cb.probeCounts
+}
+
+func (cb *CircuitBreaker[T]) beforeProbe() error {
+	if CurrentGlobalMode() == GlobalModeForceOpenAll {
+		return ErrOpenState
+	}
+
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	state, _, _ := cb.currentState(cb.clock.Now())
+	if state == StateOpen || state == StateForcedOpen {
+		return ErrOpenState
+	} else if state == StateHalfOpen && cb.probeGated() && cb.halfOpenGate.Load().full() {
+		return ErrTooManyRequests
+	}
+
+	cb.probeCounts.onRequest()
+	return nil
+}
+
+func (cb *CircuitBreaker[T]) afterProbe(o Outcome) {
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	switch o {
+	case OutcomeSuccess:
+		cb.probeCounts.onSuccess()
+	case OutcomeFailure:
+		cb.probeCounts.onFailure()
+	case OutcomeExcluded:
+		cb.probeCounts.onExclusion()
+	}
+}
@@ -0,0 +1,58 @@
+package gobreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbe(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[int](Settings{Timeout: 10 * time.Second, IsExcluded: isExcluded, Clock: clock})
+
+	result, ran, err := cb.Probe(func() (int, error) { return 1, nil })
+	assert.Equal(t, 1, result)
+	assert.True(t, ran)
+	assert.NoError(t, err)
+
+	errProbe := errors.New("probe")
+	for i := 0; i < 10; i++ {
+		_, ran, err = cb.Probe(func() (int, error) { return 0, errProbe })
+		assert.True(t, ran)
+		assert.Equal(t, errProbe, err)
+	}
+	_, ran, err = cb.Probe(func() (int, error) { return 0, errExcluded })
+	assert.True(t, ran)
+	assert.Equal(t, errExcluded, err)
+
+	// probes don't affect the state of the breaker
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, cb.Counts())
+	assert.Equal(t, Counts{12, 1, 10, 0, 10, 1, 10}, cb.ProbeCounts())
+
+	for i := 0; i < 6; i++ {
+		_, _ = cb.Execute(func() (int, error) { return 0, errProbe })
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	_, ran, err = cb.Probe(func() (int, error) { return 1, nil })
+	assert.False(t, ran)
+	assert.Equal(t, ErrOpenState, err)
+	assert.Equal(t, Counts{12, 1, 10, 0, 10, 1, 10}, cb.ProbeCounts())
+
+	// probes don't occupy the slots of the half-open state
+	clock.advance(11 * time.Second)
+	_, ran, err = cb.Probe(func() (int, error) { return 1, nil })
+	assert.True(t, ran)
+	assert.NoError(t, err)
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	_, err = cb.Execute(func() (int, error) { return 1, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, StateClosed, cb.State())
+
+	assert.Panics(t, func() { _, _, _ = cb.Probe(func() (int, error) { panic("oops") }) })
+	assert.Equal(t, Counts{14, 2, 11, 0, 1, 1, 11}, cb.ProbeCounts())
+}
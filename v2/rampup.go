@@ -0,0 +1,53 @@
+package gobreaker
+
+import "time"
+
+// defaultRampUpInitialRatio is the fraction of the requests admitted at the start of the ramp-up
+// if RampUpInitialRatio is not valid.
+const defaultRampUpInitialRatio = 0.1
+
+// validRampUpInitialRatio returns ratio if it is a valid RampUpInitialRatio, or the default otherwise.
+func validRampUpInitialRatio(ratio float64) float64 {
+	if ratio > 0 && ratio <= 1 {
+		return ratio
+	}
+	return defaultRampUpInitialRatio
+}
+
+// startRampUp starts the ramp-up of RampUpPeriod at the given time, if any.
+func (cb *CircuitBreaker[T]) startRampUp(now time.Time) {
+	if cb.rampUpPeriod <= 0 {
+		return
+	}
+	cb.rampUpStart = now
+	cb.rampUpUntil = now.Add(cb.rampUpPeriod)
+	// The first request of the ramp-up is always admitted.
+	cb.rampUpCredit = 1
+}
+
+// stopRampUp ends the ramp-up, if any.
+func (cb *CircuitBreaker[T]) stopRampUp() {
+	cb.rampUpUntil = time.Time{}
+}
+
+// rampUpAdmits reports whether a request of the closed state at the given time is admitted by the ramp-up.
+// The fraction of the admitted requests climbs linearly from RampUpInitialRatio to 1 over RampUpPeriod,
+// and each request earns the credit of the fraction at its time; a request is admitted for a whole credit,
+// so that the requests are sampled deterministically.
+func (cb *CircuitBreaker[T]) rampUpAdmits(now time.Time) bool {
+	if cb.rampUpUntil.IsZero() {
+		return true
+	}
+	if !now.Before(cb.rampUpUntil) {
+		cb.stopRampUp()
+		return true
+	}
+
+	progress := float64(now.Sub(cb.rampUpStart)) / float64(cb.rampUpPeriod)
+	cb.rampUpCredit += cb.rampUpInitialRatio + (1-cb.rampUpInitialRatio)*progress
+	if cb.rampUpCredit < 1 {
+		return false
+	}
+	cb.rampUpCredit--
+	return true
+}
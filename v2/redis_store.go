@@ -1,8 +1,10 @@
 package gobreaker
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"time"
 
 	"github.com/go-redsync/redsync/v4"
 	"github.com/go-redsync/redsync/v4/redis/goredis/v9"
@@ -14,18 +16,57 @@ type RedisStore struct {
 	client *redis.Client
 	rs     *redsync.Redsync
 	mutex  map[string]*redsync.Mutex
+	prefix string
+	ttl    time.Duration
 }
 
-func NewRedisStore(addr string) *RedisStore {
+// RedisStoreOption configures RedisStore.
+type RedisStoreOption func(*RedisStore)
+
+// WithRedisKeyPrefix sets the prefix prepended to every key of RedisStore, including the keys of the locks,
+// e.g. to share a Redis database among applications. The default is no prefix.
+func WithRedisKeyPrefix(prefix string) RedisStoreOption {
+	return func(rs *RedisStore) {
+		rs.prefix = prefix
+	}
+}
+
+// WithRedisTTL sets the expiration of the data written by RedisStore, so that the state of an abandoned breaker
+// doesn't linger forever. The expiration is extended by every write of the state.
+// The TTL should be longer than Interval and Timeout of the breaker to avoid evicting live state.
+// If the TTL is 0, which is the default, the data never expires.
+func WithRedisTTL(ttl time.Duration) RedisStoreOption {
+	return func(rs *RedisStore) {
+		rs.ttl = ttl
+	}
+}
+
+// NewRedisStore returns a new RedisStore connected to the Redis server at addr.
+func NewRedisStore(addr string, opts ...RedisStoreOption) *RedisStore {
 	client := redis.NewClient(&redis.Options{
 		Addr: addr,
 	})
-	return &RedisStore{
+	return NewRedisStoreFromClient(client, opts...)
+}
+
+// NewRedisStoreFromClient returns a new RedisStore that uses the given client,
+// e.g. to configure authentication or TLS. Close of RedisStore closes the client.
+func NewRedisStoreFromClient(client *redis.Client, opts ...RedisStoreOption) *RedisStore {
+	rs := &RedisStore{
 		ctx:    context.Background(),
 		client: client,
 		rs:     redsync.New(goredis.NewPool(client)),
 		mutex:  map[string]*redsync.Mutex{},
 	}
+	for _, opt := range opts {
+		opt(rs)
+	}
+	return rs
+}
+
+// key returns the key of Redis for the given name.
+func (rs *RedisStore) key(name string) string {
+	return rs.prefix + name
 }
 
 func (rs *RedisStore) Lock(name string) error {
@@ -34,7 +75,7 @@ func (rs *RedisStore) Lock(name string) error {
 		return mutex.Lock()
 	}
 
-	mutex = rs.rs.NewMutex(name, redsync.WithExpiry(mutexTimeout))
+	mutex = rs.rs.NewMutex(rs.key(name), redsync.WithExpiry(mutexTimeout))
 	rs.mutex[name] = mutex
 	return mutex.Lock()
 }
@@ -52,11 +93,39 @@ func (rs *RedisStore) Unlock(name string) error {
 }
 
 func (rs *RedisStore) GetData(name string) ([]byte, error) {
-	return rs.client.Get(rs.ctx, name).Bytes()
+	return rs.client.Get(rs.ctx, rs.key(name)).Bytes()
 }
 
 func (rs *RedisStore) SetData(name string, data []byte) error {
-	return rs.client.Set(rs.ctx, name, data, 0).Err()
+	return rs.client.Set(rs.ctx, rs.key(name), data, rs.ttl).Err()
+}
+
+// errDataChanged aborts the transaction of CompareAndSwap when the data is not the expected one.
+var errDataChanged = errors.New("data changed")
+
+// CompareAndSwap sets the data of the given name to new if the current data is old,
+// using WATCH and MULTI so that a concurrent change of the data aborts the update.
+func (rs *RedisStore) CompareAndSwap(name string, old, new []byte) (bool, error) {
+	key := rs.key(name)
+	err := rs.client.Watch(rs.ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(rs.ctx, key).Bytes()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if !bytes.Equal(current, old) {
+			return errDataChanged
+		}
+
+		_, err = tx.TxPipelined(rs.ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(rs.ctx, key, new, rs.ttl)
+			return nil
+		})
+		return err
+	}, key)
+	if errors.Is(err, errDataChanged) || errors.Is(err, redis.TxFailedErr) {
+		return false, nil
+	}
+	return err == nil, err
 }
 
 func (rs *RedisStore) Close() {
@@ -0,0 +1,116 @@
+package gobreaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrRemovingOpen is returned when removing an open or forced-open CircuitBreaker from Registry or Group,
+// which would forget that its dependency is known to be bad.
+var ErrRemovingOpen = errors.New("refusing to remove an open circuit breaker")
+
+// isOpen reports whether the given state rejects requests, i.e. StateOpen or StateForcedOpen.
+func isOpen(state State) bool {
+	return state == StateOpen || state == StateForcedOpen
+}
+
+// Registry is a concurrency-safe, process-wide place to define default Settings
+// per dependency name and to obtain CircuitBreakers by that name.
+// Each name has at most one CircuitBreaker, which is created lazily on first use.
+// Use Group instead for many breakers that share the same Settings.
+type Registry struct {
+	mutex    sync.Mutex
+	settings map[string]Settings
+	breakers map[string]any
+}
+
+// DefaultRegistry is the Registry used by Breaker.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		settings: make(map[string]Settings),
+		breakers: make(map[string]any),
+	}
+}
+
+// Register sets the default Settings for the given name.
+// The Name field of st is ignored and replaced with name.
+// Register has no effect on a CircuitBreaker already created for the name.
+func (r *Registry) Register(name string, st Settings) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	st.Name = name
+	r.settings[name] = st
+}
+
+// Unregister removes the Settings and the CircuitBreaker for the given name, if any,
+// e.g. for a decommissioned host, and closes the CircuitBreaker.
+// The next CircuitBreaker for the name is created anew with the default Settings.
+// Unregister returns ErrRemovingOpen without removing anything if the CircuitBreaker is open or forced open.
+func (r *Registry) Unregister(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	b, ok := r.breakers[name]
+	if !ok {
+		delete(r.settings, name)
+		return nil
+	}
+
+	cb := b.(closableBreaker)
+	if isOpen(cb.PeekState()) {
+		return fmt.Errorf("%w: %q", ErrRemovingOpen, name)
+	}
+	delete(r.breakers, name)
+	delete(r.settings, name)
+	return cb.Close()
+}
+
+// closableBreaker is the part of CircuitBreaker that doesn't depend on the type parameter.
+type closableBreaker interface {
+	PeekState() State
+	Close() error
+}
+
+// Unregister removes the Settings and the CircuitBreaker for the given name from DefaultRegistry.
+// See Registry.Unregister.
+func Unregister(name string) error {
+	return DefaultRegistry.Unregister(name)
+}
+
+// Breaker returns the CircuitBreaker for the given name from DefaultRegistry.
+// See RegistryBreaker.
+func Breaker[T any](name string) *CircuitBreaker[T] {
+	return RegistryBreaker[T](DefaultRegistry, name)
+}
+
+// RegistryBreaker returns the CircuitBreaker for the given name from r.
+// The CircuitBreaker is created from the Settings registered for the name on the first call
+// and the same instance is returned afterwards.
+// If no Settings are registered for the name, the default Settings are used.
+// RegistryBreaker panics if the CircuitBreaker for the name was created with a different type parameter.
+func RegistryBreaker[T any](r *Registry, name string) *CircuitBreaker[T] {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if b, ok := r.breakers[name]; ok {
+		cb, ok := b.(*CircuitBreaker[T])
+		if !ok {
+			panic(fmt.Sprintf("gobreaker: breaker %q is %T, not %T", name, b, cb))
+		}
+		return cb
+	}
+
+	st, ok := r.settings[name]
+	if !ok {
+		st = Settings{Name: name}
+	}
+
+	cb := NewCircuitBreaker[T](st)
+	r.breakers[name] = cb
+	return cb
+}
@@ -0,0 +1,101 @@
+package gobreaker
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Register("db", Settings{Name: "ignored", MaxRequests: 3, Timeout: 10 * time.Second})
+
+	cb := RegistryBreaker[bool](r, "db")
+	assert.Equal(t, "db", cb.Name())
+	assert.Equal(t, uint32(3), cb.maxRequests)
+	assert.Equal(t, 10*time.Second, cb.timeout)
+	assert.Same(t, cb, RegistryBreaker[bool](r, "db"))
+
+	// unregistered names use the default Settings
+	other := RegistryBreaker[bool](r, "cache")
+	assert.Equal(t, "cache", other.Name())
+	assert.Equal(t, uint32(1), other.maxRequests)
+	assert.Equal(t, defaultTimeout, other.timeout)
+	assert.NotSame(t, cb, other)
+
+	// registering after creation has no effect on the existing breaker
+	r.Register("db", Settings{MaxRequests: 5})
+	assert.Same(t, cb, RegistryBreaker[bool](r, "db"))
+	assert.Equal(t, uint32(3), cb.maxRequests)
+
+	assert.Panics(t, func() { RegistryBreaker[string](r, "db") })
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	DefaultRegistry.Register("TestDefaultRegistry", Settings{MaxRequests: 2})
+
+	cb := Breaker[bool]("TestDefaultRegistry")
+	assert.Equal(t, "TestDefaultRegistry", cb.Name())
+	assert.Equal(t, uint32(2), cb.maxRequests)
+	assert.Same(t, cb, Breaker[bool]("TestDefaultRegistry"))
+}
+
+func TestRegistryUnregister(t *testing.T) {
+	r := NewRegistry()
+	r.Register("db", Settings{MaxRequests: 3})
+	cb := RegistryBreaker[bool](r, "db")
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.ErrorIs(t, r.Unregister("db"), ErrRemovingOpen)
+	assert.Same(t, cb, RegistryBreaker[bool](r, "db"))
+
+	cb.Reset()
+	cb.ForceOpen()
+	assert.ErrorIs(t, r.Unregister("db"), ErrRemovingOpen)
+	assert.Same(t, cb, RegistryBreaker[bool](r, "db"))
+
+	cb.Reset()
+	assert.NoError(t, r.Unregister("db"))
+	other := RegistryBreaker[bool](r, "db")
+	assert.NotSame(t, cb, other)
+	assert.Equal(t, StateClosed, other.State())
+	assert.Equal(t, uint32(1), other.maxRequests)
+
+	// the name may have only Settings, or nothing at all
+	r.Register("cache", Settings{MaxRequests: 3})
+	assert.NoError(t, r.Unregister("cache"))
+	assert.Equal(t, uint32(1), RegistryBreaker[bool](r, "cache").maxRequests)
+	assert.NoError(t, r.Unregister("unknown"))
+
+	// the CircuitBreaker may be created with another type parameter after it is removed
+	assert.NoError(t, r.Unregister("db"))
+	assert.NotPanics(t, func() { RegistryBreaker[string](r, "db") })
+
+	Breaker[bool]("TestRegistryUnregister")
+	assert.NoError(t, Unregister("TestRegistryUnregister"))
+}
+
+func TestRegistryInParallel(t *testing.T) {
+	r := NewRegistry()
+	r.Register("db", Settings{})
+
+	const numRoutines = 10
+	breakers := make([]*CircuitBreaker[bool], numRoutines)
+	var wg sync.WaitGroup
+	for i := 0; i < numRoutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			breakers[i] = RegistryBreaker[bool](r, "db")
+		}(i)
+	}
+	wg.Wait()
+
+	for _, cb := range breakers {
+		assert.Same(t, breakers[0], cb)
+	}
+}
@@ -0,0 +1,91 @@
+package gobreaker
+
+import (
+	"context"
+	"time"
+)
+
+// RetryPolicy configures ExecuteWithRetry.
+//
+// MaxAttempts is the maximum number of times the request is run, including the first attempt.
+// If MaxAttempts is less than or equal to 0, the request is run only once.
+//
+// Backoff is called with the number of the attempt that has just failed, starting from 1,
+// and returns how long to wait before the next attempt.
+// If Backoff is nil, the next attempt is made immediately.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     func(attempt int) time.Duration
+}
+
+// ExecuteWithRetry runs the given request through the CircuitBreaker like Execute,
+// retrying it according to policy while it fails.
+// Only the attempts that run the request and are counted as failures are retried.
+// If the CircuitBreaker rejects an attempt, ExecuteWithRetry stops retrying immediately
+// and returns the rejection error, so that retries don't hammer an open CircuitBreaker.
+// If ctx is done while waiting between attempts, ExecuteWithRetry returns ctx.Err().
+// Otherwise, ExecuteWithRetry returns the result of the last attempt.
+// With Settings.WrapErrors, the rejection error and the error of the last attempt are wrapped
+// in BreakerError like those of Execute.
+// The retries that succeed or are exhausted are counted in Metrics.
+func (cb *CircuitBreaker[T]) ExecuteWithRetry(ctx context.Context, policy RetryPolicy, req func(context.Context) (T, error)) (T, error) {
+	return cb.retry(ctx, policy, func() (T, Outcome, bool, error) {
+		state, generation, age, err := cb.admit()
+		if err != nil {
+			return cb.rejectedValue(), OutcomeFailure, false, cb.rejectionError(state, err)
+		}
+
+		result, o, err := cb.run(generation, age, func() (T, error) { return req(ctx) }, cb.classify)
+		return result, o, true, cb.requestError(state, o, err)
+	})
+}
+
+// ExecuteWithRetry runs the given request through the shared state like Execute,
+// retrying it according to policy while it fails.
+// See CircuitBreaker.ExecuteWithRetry.
+// Each attempt reads and writes the shared state, so an attempt is rejected as soon as
+// any instance opens the shared state. ExecuteWithRetry also stops retrying
+// if the shared state can't be read, and returns the error of SharedDataStore.
+func (dcb *DistributedCircuitBreaker[T]) ExecuteWithRetry(ctx context.Context, policy RetryPolicy, req func(context.Context) (T, error)) (T, error) {
+	return dcb.retry(ctx, policy, func() (T, Outcome, bool, error) {
+		return dcb.executeCounted(func() (T, error) { return req(ctx) })
+	})
+}
+
+// retry makes the attempts of ExecuteWithRetry according to policy.
+// attempt returns the result, the outcome and the error of an attempt, and whether the request ran;
+// the attempts are retried only while the request runs and fails.
+func (cb *CircuitBreaker[T]) retry(ctx context.Context, policy RetryPolicy, attempt func() (T, Outcome, bool, error)) (T, error) {
+	for n := 1; ; n++ {
+		result, o, ran, err := attempt()
+		if !ran {
+			return result, err
+		}
+		if o != OutcomeFailure {
+			if o == OutcomeSuccess && n > 1 {
+				cb.retries.retriedSuccesses.Add(1)
+			}
+			return result, err
+		}
+		if n >= policy.MaxAttempts {
+			if n > 1 {
+				cb.retries.retryExhausted.Add(1)
+			}
+			return result, err
+		}
+
+		var wait time.Duration
+		if policy.Backoff != nil {
+			wait = policy.Backoff(n)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			var defaultValue T
+			return defaultValue, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
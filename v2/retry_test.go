@@ -0,0 +1,116 @@
+package gobreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteWithRetrySuccess(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{})
+
+	var backoffs []int
+	policy := RetryPolicy{
+		MaxAttempts: 5,
+		Backoff: func(attempt int) time.Duration {
+			backoffs = append(backoffs, attempt)
+			return time.Millisecond
+		},
+	}
+
+	calls := 0
+	result, err := cb.ExecuteWithRetry(context.Background(), policy, func(ctx context.Context) (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, errors.New("fail")
+		}
+		return calls, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result)
+	assert.Equal(t, []int{1, 2}, backoffs)
+	assert.Equal(t, Counts{3, 1, 2, 1, 0, 0, 2}, cb.Counts())
+	assert.Equal(t, Metrics{RetriedSuccesses: 1}, cb.Metrics())
+
+	// the success of the first attempt is not a retried success
+	_, err = cb.ExecuteWithRetry(context.Background(), policy, func(ctx context.Context) (int, error) {
+		return 0, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Metrics{RetriedSuccesses: 1}, cb.Metrics())
+}
+
+func TestExecuteWithRetryExhausted(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{})
+
+	errFail := errors.New("fail")
+	calls := 0
+	_, err := cb.ExecuteWithRetry(context.Background(), RetryPolicy{MaxAttempts: 3}, func(ctx context.Context) (int, error) {
+		calls++
+		return 0, errFail
+	})
+	assert.Equal(t, errFail, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, Counts{3, 0, 3, 0, 3, 0, 3}, cb.Counts())
+	assert.Equal(t, Metrics{RetryExhausted: 1}, cb.Metrics())
+
+	// the request is run only once without MaxAttempts
+	calls = 0
+	_, err = cb.ExecuteWithRetry(context.Background(), RetryPolicy{}, func(ctx context.Context) (int, error) {
+		calls++
+		return 0, errFail
+	})
+	assert.Equal(t, errFail, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, Metrics{RetryExhausted: 1}, cb.Metrics())
+}
+
+func TestExecuteWithRetryStopsWhenOpen(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 2
+		},
+	})
+
+	calls := 0
+	_, err := cb.ExecuteWithRetry(context.Background(), RetryPolicy{MaxAttempts: 10}, func(ctx context.Context) (int, error) {
+		calls++
+		return 0, errors.New("fail")
+	})
+	assert.Equal(t, ErrOpenState, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, StateOpen, cb.State())
+
+	calls = 0
+	_, err = cb.ExecuteWithRetry(context.Background(), RetryPolicy{MaxAttempts: 10}, func(ctx context.Context) (int, error) {
+		calls++
+		return 0, nil
+	})
+	assert.Equal(t, ErrOpenState, err)
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, Metrics{}, cb.Metrics())
+}
+
+func TestExecuteWithRetryContextDone(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{
+		MaxAttempts: 5,
+		Backoff: func(attempt int) time.Duration {
+			cancel()
+			return time.Hour
+		},
+	}
+
+	calls := 0
+	_, err := cb.ExecuteWithRetry(ctx, policy, func(ctx context.Context) (int, error) {
+		calls++
+		return 0, errors.New("fail")
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,172 @@
+package gobreaker
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// SettingsView is the resolved configuration of a CircuitBreaker without the functions of Settings,
+// e.g. to audit the consistency of the CircuitBreakers across services.
+// The fields hold the values in effect, with the defaults applied and the invalid values coerced,
+// rather than the values given to NewCircuitBreaker.
+// Callbacks lists the names of the fields of Settings holding the functions that are set,
+// e.g. "ReadyToTrip" and "OnStateChange", in the order of the fields.
+type SettingsView struct {
+	Name                           string
+	MaxRequests                    uint32
+	UnlimitedHalfOpenRequests      bool
+	MaxConcurrentRequests          uint32
+	HalfOpenProbeRatio             float64
+	HalfOpenProbeInterval          time.Duration
+	HalfOpenSuccessThreshold       float64
+	MinimumRequests                uint32
+	FailureRateThreshold           float64
+	Interval                       time.Duration
+	MaxAccumulatedRequests         uint32
+	Timeout                        time.Duration
+	ManualRecovery                 bool
+	MaxProbeAttempts               uint32
+	StateChangeThrottle            time.Duration
+	ResultMatters                  bool
+	ExclusionsConsumeHalfOpenSlots bool
+	IntervalCarryOver              bool
+	MinClosedDuration              time.Duration
+	RampUpPeriod                   time.Duration
+	RampUpInitialRatio             float64
+	IgnoreFirstN                   uint32
+	PreserveSuccessesOnReset       bool
+	SaturationBackoff              float64
+	MaxSaturationTimeout           time.Duration
+	BucketPeriod                   time.Duration
+	BucketDecay                    float64
+	HalfOpenMinBuckets             uint32
+	HalfOpenSuccessLatency         time.Duration
+	WrapErrors                     bool
+	MeasureTiming                  bool
+	ApdexTarget                    time.Duration
+	ApdexTolerating                time.Duration
+	TrackLatency                   bool
+	ObserveOnly                    bool
+	EvalInterval                   time.Duration
+	CancelOnOpen                   bool
+	Callbacks                      []string
+}
+
+// Settings returns the resolved configuration of the CircuitBreaker.
+func (cb *CircuitBreaker[T]) Settings() SettingsView {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	v := SettingsView{
+		Name:                           cb.name,
+		MaxRequests:                    cb.maxRequests,
+		UnlimitedHalfOpenRequests:      cb.unlimitedHalfOpen,
+		MaxConcurrentRequests:          cb.maxConcurrent,
+		HalfOpenProbeRatio:             cb.probeRatio,
+		HalfOpenProbeInterval:          cb.probeInterval,
+		HalfOpenSuccessThreshold:       cb.successThreshold,
+		MinimumRequests:                cb.minimumRequests,
+		FailureRateThreshold:           cb.failureRateThreshold,
+		Interval:                       cb.interval,
+		MaxAccumulatedRequests:         cb.maxAccumulated,
+		Timeout:                        cb.timeout,
+		ManualRecovery:                 cb.manualRecovery,
+		MaxProbeAttempts:               cb.maxProbeAttempts,
+		StateChangeThrottle:            max(cb.stateChangeThrottle, 0),
+		ResultMatters:                  cb.resultMatters,
+		ExclusionsConsumeHalfOpenSlots: cb.exclusionsConsume,
+		IntervalCarryOver:              cb.intervalCarryOver,
+		MinClosedDuration:              max(cb.minClosedDuration, 0),
+		IgnoreFirstN:                   cb.ignoreFirstN,
+		PreserveSuccessesOnReset:       cb.preserveSuccesses,
+		BucketPeriod:                   cb.bucketPeriod,
+		BucketDecay:                    cb.bucketDecay,
+		HalfOpenMinBuckets:             cb.halfOpenMinBuckets,
+		HalfOpenSuccessLatency:         cb.halfOpenLatency,
+		WrapErrors:                     cb.wrapErrors,
+		MeasureTiming:                  cb.timing != nil,
+		TrackLatency:                   cb.latency != nil,
+		ObserveOnly:                    cb.observeOnly,
+		EvalInterval:                   max(cb.settings.EvalInterval, 0),
+		CancelOnOpen:                   cb.cancelOpenCtx != nil,
+		Callbacks:                      callbacksOf(cb.settings),
+	}
+	if cb.saturationBackoff > 1 {
+		v.SaturationBackoff = cb.saturationBackoff
+		v.MaxSaturationTimeout = max(cb.maxSaturationTimeout, 0)
+	}
+	if cb.rampUpPeriod > 0 {
+		v.RampUpPeriod = cb.rampUpPeriod
+		v.RampUpInitialRatio = cb.rampUpInitialRatio
+	}
+	if cb.apdex != nil {
+		v.ApdexTarget = cb.apdex.target
+		v.ApdexTolerating = cb.apdex.tolerating
+	}
+	return v
+}
+
+// Settings returns the resolved configuration of the TwoStepCircuitBreaker.
+func (tscb *TwoStepCircuitBreaker[T]) Settings() SettingsView {
+	return tscb.cb.Settings()
+}
+
+// callbacksOf returns the names of the fields of st holding the functions that are set.
+func callbacksOf(st Settings) []string {
+	var names []string
+	v := reflect.ValueOf(st)
+	for _, i := range callbackFields() {
+		if !v.Field(i).IsNil() {
+			names = append(names, v.Type().Field(i).Name)
+		}
+	}
+	return names
+}
+
+// callbackFields returns the indexes of the fields of Settings holding functions,
+// including Classifiers.
+func callbackFields() []int {
+	var fields []int
+	t := reflect.TypeOf(Settings{})
+	for i := 0; i < t.NumField(); i++ {
+		if k := t.Field(i).Type.Kind(); k == reflect.Func || k == reflect.Slice {
+			fields = append(fields, i)
+		}
+	}
+	return fields
+}
+
+// Diff returns the differences between v and other, one per field, e.g. "Timeout: 30s vs 1m0s",
+// in the order of the fields. A callback set in only one of them is reported like "OnTrip: set vs unset".
+// Diff returns nil if v and other are the same.
+func (v SettingsView) Diff(other SettingsView) []string {
+	var diffs []string
+	a, b := reflect.ValueOf(v), reflect.ValueOf(other)
+	for i := 0; i < a.NumField(); i++ {
+		name := a.Type().Field(i).Name
+		if name == "Callbacks" {
+			continue
+		}
+		if x, y := a.Field(i).Interface(), b.Field(i).Interface(); x != y {
+			diffs = append(diffs, fmt.Sprintf("%s: %v vs %v", name, x, y))
+		}
+	}
+
+	set := func(names []string) map[string]bool {
+		m := make(map[string]bool, len(names))
+		for _, name := range names {
+			m[name] = true
+		}
+		return m
+	}
+	setA, setB := set(v.Callbacks), set(other.Callbacks)
+	presence := map[bool]string{true: "set", false: "unset"}
+	for _, i := range callbackFields() {
+		name := reflect.TypeOf(Settings{}).Field(i).Name
+		if setA[name] != setB[name] {
+			diffs = append(diffs, fmt.Sprintf("%s: %s vs %s", name, presence[setA[name]], presence[setB[name]]))
+		}
+	}
+	return diffs
+}
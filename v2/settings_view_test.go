@@ -0,0 +1,68 @@
+package gobreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettings(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{
+		Name:              "cb",
+		Timeout:           -time.Second,
+		SaturationBackoff: 0.5,
+		BucketPeriod:      time.Second,
+		BucketDecay:       2,
+		ApdexTarget:       time.Second,
+		ReadyToTrip:       func(counts Counts) bool { return false },
+		OnTrip:            func(name string, lastErr error, counts Counts) {},
+		Classifiers:       []func(err error) (Outcome, bool){},
+	})
+
+	assert.Equal(t, SettingsView{
+		Name:            "cb",
+		MaxRequests:     1,
+		Timeout:         defaultTimeout,
+		BucketPeriod:    time.Second,
+		ApdexTarget:     time.Second,
+		ApdexTolerating: 4 * time.Second,
+		Callbacks:       []string{"ReadyToTrip", "OnTrip", "Classifiers"},
+	}, cb.Settings())
+
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{Interval: time.Minute, BucketPeriod: time.Second})
+	assert.Equal(t, SettingsView{
+		MaxRequests:  1,
+		Interval:     time.Minute,
+		Timeout:      defaultTimeout,
+		BucketPeriod: time.Second,
+	}, tscb.Settings())
+}
+
+func TestSettingsViewDiff(t *testing.T) {
+	a := NewCircuitBreaker[bool](Settings{
+		Name:        "a",
+		Timeout:     30 * time.Second,
+		MaxRequests: 3,
+		OnTrip:      func(name string, lastErr error, counts Counts) {},
+	}).Settings()
+	b := NewCircuitBreaker[bool](Settings{
+		Name:          "b",
+		MaxRequests:   3,
+		OnStateChange: func(name string, from State, to State) {},
+	}).Settings()
+
+	assert.Nil(t, a.Diff(a))
+	assert.Equal(t, []string{
+		"Name: a vs b",
+		"Timeout: 30s vs 1m0s",
+		"OnStateChange: unset vs set",
+		"OnTrip: set vs unset",
+	}, a.Diff(b))
+	assert.Equal(t, []string{
+		"Name: b vs a",
+		"Timeout: 1m0s vs 30s",
+		"OnStateChange: set vs unset",
+		"OnTrip: unset vs set",
+	}, b.Diff(a))
+}
@@ -0,0 +1,131 @@
+package gobreaker
+
+import "time"
+
+// Transition is a change of the state of CircuitBreaker found by Simulate.
+// Index is the index of the outcome whose request caused the transition, or observed it when it was due,
+// or the number of the outcomes if the transition was due after all of them.
+type Transition struct {
+	Index int
+	From  State
+	To    State
+}
+
+// SimulationResult is the result of Simulate.
+// Transitions are the changes of the state in order.
+// Rejected is the number of the outcomes whose requests were rejected and thus not counted.
+// State and Counts are the state and the Counts after the last outcome.
+type SimulationResult struct {
+	Transitions []Transition
+	Rejected    int
+	State       State
+	Counts      Counts
+}
+
+// Simulate reports what the CircuitBreaker would do if requests with the given outcomes
+// were made one after another from now on, e.g. to tune ReadyToTrip offline against recorded traffic.
+// The requests are run against a copy of the state of the CircuitBreaker,
+// which is left untouched, at the current time, which doesn't advance during the simulation.
+// The requests in flight in the CircuitBreaker stay in flight throughout the simulation,
+// e.g. taking the room of MaxConcurrentRequests.
+// ReadyToTrip is called as usual, but none of the callbacks of Settings is called,
+// and SetGlobalMode is ignored.
+func (cb *CircuitBreaker[T]) Simulate(outcomes []Outcome) SimulationResult {
+	var result SimulationResult
+	index := 0
+	sim := cb.clone(func(name string, from State, to State) {
+		result.Transitions = append(result.Transitions, Transition{Index: index, From: from, To: to})
+	})
+
+	for i, o := range outcomes {
+		index = i
+		generation, age, err := sim.simulate()
+		if err != nil {
+			result.Rejected++
+			continue
+		}
+		sim.afterRequest(generation, age, o, nil)
+	}
+
+	index = len(outcomes)
+	result.State = sim.State()
+	result.Counts = sim.Counts()
+	return result
+}
+
+// simulate admits or rejects a request of the simulation regardless of the global mode.
+func (cb *CircuitBreaker[T]) simulate() (uint64, uint64, error) {
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	_, generation, age, err := cb.admitAt(cb.clock.Now(), nil)
+	return generation, age, err
+}
+
+// clone returns a copy of the CircuitBreaker frozen at the current time for Simulate,
+// which calls onStateChange instead of the callbacks of Settings.
+func (cb *CircuitBreaker[T]) clone(onStateChange func(name string, from State, to State)) *CircuitBreaker[T] {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	st := cb.settings
+	st.Name = cb.name
+	st.OnStateChange = onStateChange
+	st.StateChangeThrottle = 0
+	st.OnRecover = nil
+	st.OnTrip = nil
+	st.OnProbeStart = nil
+	st.OnProbeEnd = nil
+	st.OnGenerationEnd = nil
+	st.OnIntervalReset = nil
+	st.OnOutcome = nil
+	st.OnProbeBudgetExhausted = nil
+	st.OnWouldReject = nil
+	st.MeasureTiming = false
+	st.EvalInterval = 0
+	st.CancelOnOpen = false
+	st.Clock = frozenClock{cb.clock.Now()}
+	sim := NewCircuitBreaker[T](st)
+
+	sim.state = cb.state
+	sim.generation = cb.generation
+	sim.stateGeneration = cb.stateGeneration
+	sim.counts = cb.counts
+	sim.preserved = cb.preserved
+	sim.generationRequests = cb.generationRequests
+	sim.expiry = cb.expiry
+	sim.stateChangedAt = cb.stateChangedAt
+	sim.openTimeout = cb.openTimeout
+	sim.saturated = cb.saturated
+	sim.failedProbes = cb.failedProbes
+	sim.openedAt = cb.openedAt
+	sim.recoveredAt = cb.recoveredAt
+	sim.interval = cb.interval
+	sim.window = nil
+	if cb.window != nil {
+		sim.window = cb.window.clone()
+	}
+	sim.bucketDecay = cb.bucketDecay
+	sim.halfOpenedAt = cb.halfOpenedAt
+	sim.halfOpenBuckets = cb.halfOpenBuckets
+	sim.halfOpenArrivals = cb.halfOpenArrivals
+	sim.lastProbeAt = cb.lastProbeAt
+	sim.rampUpStart = cb.rampUpStart
+	sim.rampUpUntil = cb.rampUpUntil
+	sim.rampUpCredit = cb.rampUpCredit
+	sim.lastSuccessAge = cb.lastSuccessAge
+	sim.inFlight = cb.inFlight
+	if gate := cb.halfOpenGate.Load(); gate != nil {
+		sim.halfOpenGate.Store(gate.clone())
+	}
+	return sim
+}
+
+// frozenClock is a Clock that never advances.
+type frozenClock struct {
+	now time.Time
+}
+
+func (c frozenClock) Now() time.Time {
+	return c.now
+}
@@ -0,0 +1,114 @@
+package gobreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulate(t *testing.T) {
+	var transitions []Transition
+	index := 0
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxRequests: 2,
+		Interval:    10 * time.Second,
+		Timeout:     time.Second,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.TotalFailures >= 3
+		},
+		OnStateChange: func(name string, from State, to State) {
+			transitions = append(transitions, Transition{Index: index, From: from, To: to})
+		},
+		IsExcluded: isExcluded,
+		Clock:      clock,
+	})
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, fail(cb))
+	before := cb.Counts()
+
+	outcomes := []Outcome{
+		OutcomeFailure, OutcomeExcluded, OutcomeSuccess, OutcomeFailure,
+		OutcomeSuccess, OutcomeFailure,
+	}
+	result := cb.Simulate(outcomes)
+	assert.Equal(t, SimulationResult{
+		Transitions: []Transition{{Index: 3, From: StateClosed, To: StateOpen}},
+		Rejected:    2,
+		State:       StateOpen,
+		Counts:      Counts{},
+	}, result)
+
+	// the CircuitBreaker is untouched
+	assert.Empty(t, transitions)
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, before, cb.Counts())
+
+	// the simulation agrees with a real run of the same outcomes
+	requests := map[Outcome]func(*CircuitBreaker[bool]) error{
+		OutcomeSuccess:  succeed,
+		OutcomeFailure:  fail,
+		OutcomeExcluded: exclude,
+	}
+	rejected := 0
+	for i, o := range outcomes {
+		index = i
+		if requests[o](cb) != nil {
+			rejected++
+		}
+	}
+	assert.Equal(t, result.Transitions, transitions)
+	assert.Equal(t, result.Rejected, rejected)
+	assert.Equal(t, result.State, cb.State())
+	assert.Equal(t, result.Counts, cb.Counts())
+}
+
+func TestSimulateHalfOpen(t *testing.T) {
+	clock := newFakeClock()
+	var probes int
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxRequests:  2,
+		Timeout:      time.Second,
+		OnProbeStart: func(name string) { probes++ },
+		Clock:        clock,
+	})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	clock.advance(2 * time.Second)
+
+	result := cb.Simulate([]Outcome{OutcomeSuccess, OutcomeSuccess, OutcomeFailure})
+	assert.Equal(t, []Transition{
+		{Index: 0, From: StateOpen, To: StateHalfOpen},
+		{Index: 1, From: StateHalfOpen, To: StateClosed},
+	}, result.Transitions)
+	assert.Equal(t, StateClosed, result.State)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, result.Counts)
+	assert.Equal(t, 0, probes)
+	assert.Equal(t, StateOpen, cb.state)
+
+	result = cb.Simulate(nil)
+	assert.Equal(t, []Transition{{Index: 0, From: StateOpen, To: StateHalfOpen}}, result.Transitions)
+}
+
+func TestSimulateInFlight(t *testing.T) {
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{MaxConcurrentRequests: 2})
+	outcomes := []Outcome{OutcomeSuccess, OutcomeSuccess, OutcomeSuccess}
+
+	done, err := tscb.Allow()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, tscb.cb.Simulate(outcomes).Rejected)
+
+	// the requests in flight take all the room of MaxConcurrentRequests
+	other, err := tscb.Allow()
+	assert.NoError(t, err)
+	result := tscb.cb.Simulate(outcomes)
+	assert.Equal(t, 3, result.Rejected)
+	assert.Equal(t, Counts{2, 0, 0, 0, 0, 0, 0}, result.Counts)
+
+	done(true)
+	other(true)
+	assert.Equal(t, 0, tscb.cb.Simulate(outcomes).Rejected)
+	assert.Equal(t, uint32(0), tscb.cb.inFlight)
+}
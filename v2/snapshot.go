@@ -0,0 +1,128 @@
+package gobreaker
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSnapshotMismatch is returned by Restore when the snapshot doesn't fit the configuration of the CircuitBreaker.
+var ErrSnapshotMismatch = errors.New("snapshot doesn't match the circuit breaker")
+
+// StateSnapshot is the state of CircuitBreaker captured by Snapshot, e.g. to persist it to local disk on shutdown
+// and to restore it on startup with Restore. It is serializable with encoding/json.
+// Buckets, WindowStart and BucketAge are the rolling window of the closed state, if any.
+type StateSnapshot struct {
+	State          State         `json:"state"`
+	Generation     uint64        `json:"generation"`
+	Counts         Counts        `json:"counts"`
+	Expiry         time.Time     `json:"expiry"`
+	Buckets        []Counts      `json:"buckets,omitempty"`
+	WindowStart    time.Time     `json:"windowStart"`
+	BucketAge      uint64        `json:"bucketAge"`
+	StateChangedAt time.Time     `json:"stateChangedAt"`
+	OpenTimeout    time.Duration `json:"openTimeout,omitempty"`
+	FailedProbes   uint32        `json:"failedProbes,omitempty"`
+}
+
+// Snapshot returns the current state of the CircuitBreaker.
+// Like State, it applies the transition that is due, if any.
+func (cb *CircuitBreaker[T]) Snapshot() StateSnapshot {
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	cb.currentState(cb.clock.Now())
+	s := StateSnapshot{
+		State:          cb.state,
+		Generation:     cb.generation,
+		Counts:         cb.counts,
+		Expiry:         cb.expiry,
+		StateChangedAt: cb.stateChangedAt,
+		OpenTimeout:    cb.openTimeout,
+		FailedProbes:   cb.failedProbes,
+	}
+	if cb.window != nil {
+		s.Buckets = append([]Counts(nil), cb.window.buckets...)
+		s.WindowStart = cb.window.start
+		s.BucketAge = cb.window.age
+	}
+	return s
+}
+
+// Restore replaces the state of the CircuitBreaker with the snapshot taken by Snapshot,
+// e.g. of the previous process, so that a restarted service doesn't re-probe a failing dependency.
+// It is meant to be called before the CircuitBreaker serves any request;
+// the outcomes of the requests in flight may be counted in the restored Counts.
+// The expiry of the snapshot is kept as is, so the transition that has become due since is applied by the next call.
+// Restore returns ErrSnapshotMismatch if the number of the buckets of the snapshot doesn't match
+// the rolling window of the CircuitBreaker, or if the state is unknown.
+// OnStateChange is not called.
+func (cb *CircuitBreaker[T]) Restore(s StateSnapshot) error {
+	if s.State < StateClosed || s.State > StateForcedClosed {
+		return fmt.Errorf("%w: %v", ErrSnapshotMismatch, s.State)
+	}
+
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	buckets := 0
+	if cb.window != nil {
+		buckets = len(cb.window.buckets)
+	}
+	if len(s.Buckets) != buckets {
+		return fmt.Errorf("%w: %d buckets instead of %d", ErrSnapshotMismatch, len(s.Buckets), buckets)
+	}
+
+	cb.state = s.State
+	cb.generation = s.Generation
+	cb.stateGeneration = s.Generation
+	cb.counts = s.Counts
+	cb.preserved.clear()
+	cb.generationRequests = s.Counts.Requests
+	cb.expiry = s.Expiry
+	cb.stateChangedAt = s.StateChangedAt
+	if s.OpenTimeout > 0 {
+		cb.openTimeout = s.OpenTimeout
+	}
+	cb.failedProbes = s.FailedProbes
+	if cb.window != nil {
+		cb.window.load(s.Buckets, s.WindowStart, s.BucketAge, s.Counts)
+	}
+	if cb.state == StateOpen {
+		cb.openedAt = s.StateChangedAt
+	}
+	if cb.state == StateHalfOpen {
+		cb.halfOpenedAt = s.StateChangedAt
+		cb.halfOpenBuckets = 0
+		cb.halfOpenArrivals = 0
+		cb.lastProbeAt = time.Time{}
+	}
+	cb.resetHalfOpenGate(cb.halfOpenRequests())
+	return nil
+}
+
+// Snapshot returns the current shared state.
+// Like State, it applies the transition that is due, if any, to the shared state.
+// It returns the error of SharedDataStore if the shared state can't be read or written.
+func (dcb *DistributedCircuitBreaker[T]) Snapshot() (s StateSnapshot, err error) {
+	err = dcb.updateShared(func() {
+		s = dcb.CircuitBreaker.Snapshot()
+	})
+	return s, err
+}
+
+// Restore replaces the shared state with the snapshot taken by Snapshot,
+// so that it is picked up by every instance sharing the state on its next read.
+// See CircuitBreaker.Restore.
+// The Rejections of the shared state are kept.
+// It returns the error of SharedDataStore if the shared state can't be read or written.
+func (dcb *DistributedCircuitBreaker[T]) Restore(s StateSnapshot) error {
+	var restoreErr error
+	err := dcb.updateShared(func() {
+		restoreErr = dcb.CircuitBreaker.Restore(s)
+	})
+	if err != nil {
+		return err
+	}
+	return restoreErr
+}
@@ -0,0 +1,69 @@
+package gobreaker
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	clock := newFakeClock()
+	st := Settings{
+		Interval:     3 * time.Second,
+		BucketPeriod: time.Second,
+		Timeout:      10 * time.Second,
+		Clock:        clock,
+	}
+	cb := NewCircuitBreaker[bool](st)
+	assert.Nil(t, succeed(cb))
+	clock.advance(time.Second)
+	assert.Nil(t, fail(cb))
+
+	data, err := json.Marshal(cb.Snapshot())
+	assert.NoError(t, err)
+	var s StateSnapshot
+	assert.NoError(t, json.Unmarshal(data, &s))
+
+	restored := NewCircuitBreaker[bool](st)
+	assert.NoError(t, restored.Restore(s))
+	assert.Equal(t, cb.Counts(), restored.Counts())
+	assert.Equal(t, cb.WindowInfo().Buckets, restored.WindowInfo().Buckets)
+	assert.True(t, cb.WindowInfo().Start.Equal(restored.WindowInfo().Start))
+
+	// the restored window keeps rolling
+	clock.advance(2 * time.Second)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, restored.Counts())
+
+	// the open state lasts until the restored expiry
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	s = cb.Snapshot()
+	restored = NewCircuitBreaker[bool](st)
+	assert.NoError(t, restored.Restore(s))
+	assert.Equal(t, StateOpen, restored.State())
+	assert.Equal(t, ErrOpenState, succeed(restored))
+	clock.advance(11 * time.Second)
+	assert.Equal(t, StateHalfOpen, restored.State())
+	assert.Nil(t, succeed(restored))
+	assert.Equal(t, StateClosed, restored.State())
+}
+
+func TestRestoreMismatch(t *testing.T) {
+	rolling := NewCircuitBreaker[bool](Settings{Interval: 3 * time.Second, BucketPeriod: time.Second})
+	fixed := NewCircuitBreaker[bool](Settings{})
+
+	err := fixed.Restore(rolling.Snapshot())
+	assert.True(t, errors.Is(err, ErrSnapshotMismatch))
+	assert.EqualError(t, err, "snapshot doesn't match the circuit breaker: 3 buckets instead of 0")
+	err = rolling.Restore(fixed.Snapshot())
+	assert.EqualError(t, err, "snapshot doesn't match the circuit breaker: 0 buckets instead of 3")
+
+	err = fixed.Restore(StateSnapshot{State: State(100)})
+	assert.EqualError(t, err, "snapshot doesn't match the circuit breaker: unknown state: 100")
+	assert.Equal(t, StateClosed, fixed.State())
+}
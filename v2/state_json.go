@@ -0,0 +1,62 @@
+package gobreaker
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+var states = []State{StateClosed, StateHalfOpen, StateOpen, StateForcedOpen, StateForcedClosed}
+
+// MarshalText implements encoding.TextMarshaler, encoding State by its name, e.g. "half-open".
+// It returns an error for an unknown state.
+func (s State) MarshalText() ([]byte, error) {
+	for _, state := range states {
+		if s == state {
+			return []byte(s.String()), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown state: %d", int(s))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, decoding State from its name, e.g. for YAML.
+// It returns an error for an unknown name.
+func (s *State) UnmarshalText(text []byte) error {
+	for _, state := range states {
+		if string(text) == state.String() {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown state: %q", text)
+}
+
+// MarshalJSON implements json.Marshaler, encoding State as a string of its name.
+func (s State) MarshalJSON() ([]byte, error) {
+	text, err := s.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding State from a string of its name.
+// It also accepts the number in which SharedState stores State and older versions encoded it,
+// so that SharedState and StateSnapshot written by them are still readable.
+// It returns an error for an unknown name or number.
+func (s *State) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var n int
+		if json.Unmarshal(data, &n) != nil {
+			return err
+		}
+		for _, state := range states {
+			if State(n) == state {
+				*s = state
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown state: %d", n)
+	}
+	return s.UnmarshalText([]byte(name))
+}
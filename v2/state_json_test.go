@@ -0,0 +1,51 @@
+package gobreaker
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateJSON(t *testing.T) {
+	for _, state := range states {
+		data, err := json.Marshal(state)
+		assert.NoError(t, err)
+		assert.Equal(t, `"`+state.String()+`"`, string(data))
+
+		var decoded State
+		assert.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, state, decoded)
+	}
+
+	data, err := json.Marshal(struct {
+		State State `json:"state"`
+	}{StateHalfOpen})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"state":"half-open"}`, string(data))
+
+	_, err = json.Marshal(State(100))
+	assert.ErrorContains(t, err, "unknown state: 100")
+
+	var s State
+	assert.EqualError(t, json.Unmarshal([]byte(`"ajar"`), &s), `unknown state: "ajar"`)
+	assert.Error(t, json.Unmarshal([]byte(`true`), &s))
+
+	// the number written by older versions
+	assert.NoError(t, json.Unmarshal([]byte(`2`), &s))
+	assert.Equal(t, StateOpen, s)
+	assert.EqualError(t, json.Unmarshal([]byte(`100`), &s), "unknown state: 100")
+	assert.EqualError(t, json.Unmarshal([]byte(`-1`), &s), "unknown state: -1")
+	assert.Equal(t, StateOpen, s)
+}
+
+func TestStateText(t *testing.T) {
+	var s State
+	assert.NoError(t, s.UnmarshalText([]byte("forced-closed")))
+	assert.Equal(t, StateForcedClosed, s)
+	assert.EqualError(t, s.UnmarshalText([]byte("Open")), `unknown state: "Open"`)
+
+	text, err := StateOpen.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, "open", string(text))
+}
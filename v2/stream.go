@@ -0,0 +1,142 @@
+package gobreaker
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// StreamAllow checks if a new long-lived stream, e.g. a gRPC server stream or an SSE connection,
+// can proceed. If the CircuitBreaker rejects the stream, StreamAllow returns an error.
+// Otherwise the stream is counted as a request, like a request of Execute,
+// and the caller reports its lifecycle with the returned callbacks:
+//
+// onEvent reports an intermediate error of the stream. An error classified as a failure
+// is counted at once as a failed request of its own, so that a failing stream can trip
+// the CircuitBreaker before it ends. Other errors, including nil, are not counted.
+// The errors are ignored after the state of the CircuitBreaker changes or the stream is finished.
+//
+// onDone reports the final error of the stream, which is counted as the outcome of the stream.
+//
+// release finishes the stream without an outcome, e.g. when the client goes away.
+// The stream is counted as an exclusion.
+//
+// Only the first call of onDone or release takes effect; the caller must call either of them.
+// The errors are classified by Classifiers, IsExcluded and IsSuccessful; IsSuccessfulResult is not used
+// since a stream has no result.
+func (cb *CircuitBreaker[T]) StreamAllow() (onEvent func(err error), onDone func(err error), release func(), err error) {
+	generation, age, err := cb.beforeRequest()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	onEvent, onDone, release = cb.stream(func(o Outcome, err error, start time.Time) {
+		cb.afterRequestSince(generation, age, o, err, start)
+	}, func(err error) {
+		cb.afterEvent(generation, err)
+	})
+	return onEvent, onDone, release, nil
+}
+
+// StreamAllow checks if a new long-lived stream can proceed through the shared state.
+// See CircuitBreaker.StreamAllow.
+// The stream is admitted by a write to the shared state, and each failed event and the end of the stream
+// are written by the callbacks, so the lock of SharedDataStore isn't held while the stream lasts.
+// The errors of SharedDataStore in admitting the stream are returned as they are,
+// regardless of the StoreUnavailablePolicy, and those in writing the callbacks
+// are passed to the handler set by WithErrorHandler.
+func (dcb *DistributedCircuitBreaker[T]) StreamAllow() (onEvent func(err error), onDone func(err error), release func(), err error) {
+	generation, age, err := dcb.admitShared()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	onEvent, onDone, release = dcb.stream(func(o Outcome, err error, start time.Time) {
+		dcb.recordShared(func() { dcb.afterRequestSince(generation, age, o, err, start) })
+	}, func(err error) {
+		dcb.recordShared(func() { dcb.afterEvent(generation, err) })
+	})
+	return onEvent, onDone, release, nil
+}
+
+// stream returns the callbacks of StreamAllow for an admitted stream
+// whose outcome is recorded by record and whose failed events are recorded by event.
+func (cb *CircuitBreaker[T]) stream(record func(o Outcome, err error, start time.Time), event func(err error)) (onEvent func(err error), onDone func(err error), release func()) {
+	start := cb.startTime()
+	var mutex sync.Mutex
+	finished := false
+	finish := func(o Outcome, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if finished {
+			return
+		}
+		finished = true
+		record(o, err, start)
+	}
+
+	onEvent = func(err error) {
+		if cb.classifyError(err) != OutcomeFailure {
+			return
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if !finished {
+			event(err)
+		}
+	}
+	onDone = func(err error) {
+		finish(cb.classifyError(err), err)
+	}
+	release = func() {
+		finish(OutcomeExcluded, nil)
+	}
+	return onEvent, onDone, release
+}
+
+// classifyError classifies the error of a request that has no result.
+func (cb *CircuitBreaker[T]) classifyError(err error) Outcome {
+	if o, ok := cb.classifyByChain(err); ok {
+		return o
+	}
+	if cb.classifyOutcome != nil {
+		return cb.classifyByFunc(err)
+	}
+	if cb.isExcluded != nil && cb.isExcluded(err) {
+		return OutcomeExcluded
+	}
+	return outcomeOf(cb.isSuccessful(err))
+}
+
+// afterEvent counts a failed event of the stream started in the given generation
+// as a failed request at the current time, unless the state has changed since.
+func (cb *CircuitBreaker[T]) afterEvent(before uint64, err error) {
+	if before == bypassGeneration {
+		return
+	}
+
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	now := cb.clock.Now()
+	state, generation, age := cb.currentState(now)
+	if before < cb.stateGeneration {
+		return
+	}
+
+	cb.counts.onRequest()
+	if cb.generationRequests < math.MaxUint32 {
+		cb.generationRequests++
+	}
+	weight := cb.failureWeight(err)
+	if bucket := cb.bucket(state, age); bucket != nil {
+		bucket.onRequest()
+		bucket.onWeightedFailure(weight)
+	}
+	cb.lastError = err
+	cb.onFailure(state, now, weight)
+	cb.notifyOutcome(OutcomeFailure, time.Time{}, now, generation, state)
+}
@@ -0,0 +1,68 @@
+package gobreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamAllow(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 3
+		},
+	})
+
+	onEvent, onDone, _, err := cb.StreamAllow()
+	assert.Nil(t, err)
+	onEvent(nil)
+	onEvent(errors.New("fail"))
+	assert.Equal(t, Counts{2, 0, 1, 0, 1, 0, 1}, cb.Counts())
+	onDone(nil)
+	onDone(errors.New("fail"))
+	assert.Equal(t, Counts{2, 1, 1, 1, 0, 0, 1}, cb.Counts())
+
+	// failures in the middle of a stream trip the breaker
+	onEvent, onDone, _, err = cb.StreamAllow()
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		onEvent(errors.New("fail"))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	// the events and the outcome after the trip are ignored
+	onEvent(errors.New("fail"))
+	onDone(nil)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, cb.Counts())
+
+	_, _, _, err = cb.StreamAllow()
+	assert.Equal(t, ErrOpenState, err)
+}
+
+func TestStreamAllowRelease(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{Timeout: 10 * time.Second, Clock: clock})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	clock.advance(11 * time.Second)
+
+	onEvent, onDone, release, err := cb.StreamAllow()
+	assert.Nil(t, err)
+	_, _, _, err = cb.StreamAllow()
+	assert.Equal(t, ErrTooManyRequests, err)
+
+	// release frees the half-open slot without an outcome
+	release()
+	onDone(errors.New("fail"))
+	onEvent(errors.New("fail"))
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Equal(t, Counts{1, 0, 0, 0, 0, 1, 0}, cb.Counts())
+
+	_, onDone, _, err = cb.StreamAllow()
+	assert.Nil(t, err)
+	onDone(nil)
+	assert.Equal(t, StateClosed, cb.State())
+}
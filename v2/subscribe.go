@@ -0,0 +1,113 @@
+package gobreaker
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StateChangeEvent describes a change of the state of a CircuitBreaker.
+// At is the time of the change by the Clock of the CircuitBreaker,
+// and Counts are the Counts of the generation that ended with the change.
+type StateChangeEvent struct {
+	Name   string
+	From   State
+	To     State
+	At     time.Time
+	Counts Counts
+}
+
+// subscriptionBuffer is the capacity of the channels returned by Subscribe.
+const subscriptionBuffer = 64
+
+// subscribers delivers StateChangeEvents to the channels of Subscribe.
+// The zero value has no subscribers.
+type subscribers struct {
+	mutex   sync.Mutex
+	chans   []chan StateChangeEvent
+	count   atomic.Int32
+	dropped atomic.Uint64
+}
+
+// subscribe returns a new channel that receives the published events.
+func (s *subscribers) subscribe() chan StateChangeEvent {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ch := make(chan StateChangeEvent, subscriptionBuffer)
+	s.chans = append(s.chans, ch)
+	s.count.Add(1)
+	return ch
+}
+
+// unsubscribe stops delivering events to ch and closes it, if ch is subscribed.
+func (s *subscribers) unsubscribe(ch <-chan StateChangeEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, sub := range s.chans {
+		if sub == ch {
+			s.chans = append(s.chans[:i], s.chans[i+1:]...)
+			s.count.Add(-1)
+			close(sub)
+			return
+		}
+	}
+}
+
+// active reports whether there are any subscribers.
+func (s *subscribers) active() bool {
+	return s != nil && s.count.Load() > 0
+}
+
+// publish sends event to every subscriber without blocking,
+// dropping and counting the event for a subscriber whose buffer is full.
+func (s *subscribers) publish(event StateChangeEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, sub := range s.chans {
+		select {
+		case sub <- event:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe returns a channel that receives the state changes of the CircuitBreaker,
+// and a function that stops delivering the events to the channel and closes it.
+// Unlike OnStateChange, the events are delivered outside the lock of the CircuitBreaker,
+// one per change regardless of StateChangeThrottle, to any number of subscribers.
+// The channel is buffered and an event is dropped when the buffer is full,
+// so that a slow subscriber never blocks the CircuitBreaker; DroppedEvents counts the dropped events.
+func (cb *CircuitBreaker[T]) Subscribe() (<-chan StateChangeEvent, func()) {
+	ch := cb.subscribers.subscribe()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() { cb.subscribers.unsubscribe(ch) })
+	}
+}
+
+// DroppedEvents returns the number of the events of Subscribe dropped because of a full buffer.
+func (cb *CircuitBreaker[T]) DroppedEvents() uint64 {
+	return cb.subscribers.dropped.Load()
+}
+
+// publishStateChange schedules the delivery of the change of the state from prev to state
+// to the subscribers of the CircuitBreaker and its Group, if any.
+// It must be called before Counts are cleared for the new state.
+func (cb *CircuitBreaker[T]) publishStateChange(prev State, state State, now time.Time) {
+	if !cb.subscribers.active() && !cb.groupSubscribers.active() {
+		return
+	}
+
+	event := StateChangeEvent{Name: cb.name, From: prev, To: state, At: now, Counts: cb.endedCounts()}
+	groupSubscribers := cb.groupSubscribers
+	cb.callback(func() {
+		cb.subscribers.publish(event)
+		if groupSubscribers != nil {
+			groupSubscribers.publish(event)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package gobreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	clock := newFakeClock()
+	cb := NewCircuitBreaker[bool](Settings{Name: "cb", Clock: clock})
+
+	ch, unsubscribe := cb.Subscribe()
+	other, unsubscribeOther := cb.Subscribe()
+	unsubscribeOther()
+	unsubscribeOther()
+	_, ok := <-other
+	assert.False(t, ok)
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateChangeEvent{"cb", StateClosed, StateOpen, clock.Now(), Counts{6, 0, 6, 0, 6, 0, 6}}, <-ch)
+
+	clock.advance(defaultTimeout + time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateChangeEvent{"cb", StateOpen, StateHalfOpen, clock.Now(), Counts{}}, <-ch)
+	assert.Equal(t, StateChangeEvent{"cb", StateHalfOpen, StateClosed, clock.Now(), Counts{1, 1, 0, 1, 0, 0, 0}}, <-ch)
+
+	// a slow subscriber doesn't block the breaker
+	cb.mutex.Lock()
+	for i := 0; i < subscriptionBuffer+1; i++ {
+		cb.setState(StateOpen, clock.Now())
+		cb.setState(StateClosed, clock.Now())
+	}
+	cb.unlock()
+	assert.Len(t, ch, subscriptionBuffer)
+	assert.Equal(t, uint64(subscriptionBuffer+2), cb.DroppedEvents())
+
+	unsubscribe()
+	for range ch {
+	}
+	assert.NotPanics(t, func() { cb.ForceOpen() })
+}
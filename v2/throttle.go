@@ -0,0 +1,83 @@
+package gobreaker
+
+import "time"
+
+// notifyStateChange calls OnStateChange for the transition from prev to state,
+// coalescing the transitions within StateChangeThrottle.
+func (cb *CircuitBreaker[T]) notifyStateChange(prev State, state State, now time.Time) {
+	if cb.onStateChange == nil {
+		return
+	}
+	if cb.stateChangeThrottle <= 0 {
+		cb.callStateChange(prev, state)
+		return
+	}
+
+	if !cb.changePending {
+		cb.pendingFrom = prev
+	}
+	cb.pendingTo = state
+	cb.changePending = true
+
+	if !cb.notifiedAt.IsZero() && now.Sub(cb.notifiedAt) < cb.stateChangeThrottle {
+		if clock, ok := cb.clock.(TimerClock); ok && cb.stopThrottle == nil {
+			cb.stopThrottle = clock.AfterFunc(cb.notifiedAt.Add(cb.stateChangeThrottle).Sub(now), cb.flushStateChangeLater)
+		}
+		return
+	}
+	cb.flushStateChange(now)
+}
+
+// flushStateChange calls OnStateChange for the transitions coalesced so far, if any.
+// The transitions that end in the state they started from are dropped.
+func (cb *CircuitBreaker[T]) flushStateChange(now time.Time) {
+	if !cb.changePending {
+		return
+	}
+	cb.changePending = false
+	if cb.pendingFrom == cb.pendingTo {
+		return
+	}
+	cb.notifiedAt = now
+	cb.callStateChange(cb.pendingFrom, cb.pendingTo)
+}
+
+// callStateChange calls OnStateChange under the lock of the CircuitBreaker,
+// or schedules it with the other callbacks while they are staged.
+func (cb *CircuitBreaker[T]) callStateChange(from State, to State) {
+	if !cb.staging {
+		cb.onStateChange(cb.name, from, to)
+		return
+	}
+	name := cb.name
+	cb.callback(func() { cb.onStateChange(name, from, to) })
+}
+
+// flushDueStateChange calls OnStateChange for the transitions coalesced so far
+// if the throttle window has ended at the given time.
+func (cb *CircuitBreaker[T]) flushDueStateChange(now time.Time) {
+	if cb.changePending && now.Sub(cb.notifiedAt) >= cb.stateChangeThrottle {
+		cb.flushStateChange(now)
+	}
+}
+
+// flushStateChangeLater is called by the TimerClock at the end of the throttle window.
+func (cb *CircuitBreaker[T]) flushStateChangeLater() {
+	cb.mutex.Lock()
+	defer cb.unlock()
+
+	cb.stopThrottle = nil
+	cb.flushStateChange(cb.clock.Now())
+}
+
+// stopThrottleTimer stops the call of StateChangeThrottle scheduled with the TimerClock, if any.
+// The transitions coalesced so far are not reported.
+func (cb *CircuitBreaker[T]) stopThrottleTimer() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.stopThrottle != nil {
+		cb.stopThrottle()
+		cb.stopThrottle = nil
+	}
+}
@@ -0,0 +1,203 @@
+package gobreaker
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stateChanges struct {
+	mutex   sync.Mutex
+	changes []StateChange
+}
+
+func (sc *stateChanges) onStateChange(name string, from State, to State) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	sc.changes = append(sc.changes, StateChange{name, from, to})
+}
+
+func (sc *stateChanges) get() []StateChange {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	return append([]StateChange(nil), sc.changes...)
+}
+
+func tripThrottled(t *testing.T, cb *CircuitBreaker[bool]) {
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestStateChangeThrottle(t *testing.T) {
+	clock := newFakeClock()
+	var sc stateChanges
+	cb := NewCircuitBreaker[bool](Settings{
+		Name:                "cb",
+		Timeout:             2 * time.Minute,
+		OnStateChange:       sc.onStateChange,
+		StateChangeThrottle: time.Minute,
+		Clock:               clock,
+	})
+	defer cb.Close()
+
+	// the first transition is reported at once
+	tripThrottled(t, cb)
+	assert.Equal(t, []StateChange{{"cb", StateClosed, StateOpen}}, sc.get())
+
+	// the transitions within the window are not reported while the state changes as usual
+	cb.Reset()
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, 1, len(sc.get()))
+
+	// the net transition from open to open is dropped
+	tripThrottled(t, cb)
+	clock.advance(time.Minute + time.Second)
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, 1, len(sc.get()))
+
+	// a transition after the window is reported at once
+	clock.advance(time.Minute)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Equal(t, []StateChange{
+		{"cb", StateClosed, StateOpen},
+		{"cb", StateOpen, StateHalfOpen},
+	}, sc.get())
+
+	// the net transition is reported when the window ends
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	tripThrottled(t, cb)
+	assert.Equal(t, 2, len(sc.get()))
+
+	clock.advance(time.Minute)
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, []StateChange{
+		{"cb", StateClosed, StateOpen},
+		{"cb", StateOpen, StateHalfOpen},
+		{"cb", StateHalfOpen, StateOpen},
+	}, sc.get())
+}
+
+// timerClock is a fakeClock implementing TimerClock, which calls the functions of AfterFunc
+// as it is advanced past their time.
+type timerClock struct {
+	*fakeClock
+	mutex  sync.Mutex
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at   time.Time
+	f    func()
+	done bool
+}
+
+func newTimerClock() *timerClock {
+	return &timerClock{fakeClock: newFakeClock()}
+}
+
+func (c *timerClock) AfterFunc(d time.Duration, f func()) func() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timer := &fakeTimer{at: c.Now().Add(d), f: f}
+	c.timers = append(c.timers, timer)
+	return func() bool {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		stopped := !timer.done
+		timer.done = true
+		return stopped
+	}
+}
+
+func (c *timerClock) advance(period time.Duration) {
+	c.fakeClock.advance(period)
+
+	c.mutex.Lock()
+	var due []func()
+	for _, timer := range c.timers {
+		if !timer.done && !c.Now().Before(timer.at) {
+			timer.done = true
+			due = append(due, timer.f)
+		}
+	}
+	c.mutex.Unlock()
+
+	for _, f := range due {
+		f()
+	}
+}
+
+func TestStateChangeThrottleTimer(t *testing.T) {
+	clock := newTimerClock()
+	var sc stateChanges
+	cb := NewCircuitBreaker[bool](Settings{
+		Name:                "cb",
+		OnStateChange:       sc.onStateChange,
+		StateChangeThrottle: time.Minute,
+		Clock:               clock,
+	})
+	defer cb.Close()
+
+	tripThrottled(t, cb)
+	cb.Reset()
+	assert.Equal(t, 1, len(sc.get()))
+
+	// the net transition is reported at the end of the window of the Clock without another call of the CircuitBreaker
+	clock.advance(time.Minute - time.Second)
+	assert.Equal(t, 1, len(sc.get()))
+	clock.advance(time.Second)
+	assert.Equal(t, []StateChange{
+		{"cb", StateClosed, StateOpen},
+		{"cb", StateOpen, StateClosed},
+	}, sc.get())
+
+	// Close stops the scheduled report
+	tripThrottled(t, cb)
+	cb.Close()
+	clock.advance(time.Minute)
+	assert.Equal(t, 2, len(sc.get()))
+}
+
+func TestStateChangeThrottleWithoutTimer(t *testing.T) {
+	clock := newFakeClock()
+	var sc stateChanges
+	cb := NewCircuitBreaker[bool](Settings{
+		Name:                "cb",
+		OnStateChange:       sc.onStateChange,
+		StateChangeThrottle: time.Millisecond,
+		Clock:               clock,
+	})
+
+	tripThrottled(t, cb)
+	cb.Reset()
+	assert.Nil(t, cb.stopThrottle)
+
+	// with a Clock that is not a TimerClock, the net transition waits for the next call
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 1, len(sc.get()))
+	clock.advance(time.Millisecond)
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, StateChange{"cb", StateOpen, StateClosed}, sc.get()[1])
+}
+
+func TestStateChangeThrottleDisabled(t *testing.T) {
+	var sc stateChanges
+	cb := NewCircuitBreaker[bool](Settings{
+		Name:          "cb",
+		OnStateChange: sc.onStateChange,
+	})
+
+	tripThrottled(t, cb)
+	cb.Reset()
+	tripThrottled(t, cb)
+	assert.Equal(t, 3, len(sc.get()))
+}
@@ -0,0 +1,174 @@
+package gobreaker
+
+import "fmt"
+
+// Severity is a type that represents how serious a ValidationIssue is.
+type Severity int
+
+// These constants are severities of ValidationIssue.
+const (
+	// SeverityWarning is an issue that NewCircuitBreaker handles by a documented rule,
+	// e.g. by coercing a value, but that may not be what the caller meant.
+	SeverityWarning Severity = iota
+	// SeverityError is an issue that is most likely a mistake, e.g. a negative period.
+	SeverityError
+)
+
+// String implements stringer interface.
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("unknown severity: %d", s)
+	}
+}
+
+// ValidationIssue is an issue of Settings reported by Validate.
+// Field is the name of the field of Settings that has the issue.
+type ValidationIssue struct {
+	Field    string
+	Severity Severity
+	Message  string
+}
+
+// String implements stringer interface.
+func (i ValidationIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Field, i.Message)
+}
+
+// Validate reports the issues of the given Settings, e.g. for a lint step before deploying a configuration.
+// It surfaces the rules that NewCircuitBreaker applies silently, such as coercing a value or ignoring a field,
+// as well as the values that are most likely mistakes.
+// Validate never fails; it is up to the caller whether to treat any issue as fatal.
+// NewCircuitBreaker accepts the Settings regardless of the issues.
+func Validate(st Settings) []ValidationIssue {
+	var issues []ValidationIssue
+	warn := func(field, format string, args ...any) {
+		issues = append(issues, ValidationIssue{field, SeverityWarning, fmt.Sprintf(format, args...)})
+	}
+	fail := func(field, format string, args ...any) {
+		issues = append(issues, ValidationIssue{field, SeverityError, fmt.Sprintf(format, args...)})
+	}
+
+	if st.MaxRequests == 0 {
+		warn("MaxRequests", "MaxRequests is 0 and will be coerced to 1")
+	}
+
+	if st.HalfOpenProbeRatio < 0 || st.HalfOpenProbeRatio > 1 {
+		warn("HalfOpenProbeRatio", "HalfOpenProbeRatio is not between 0 and 1 and will be ignored")
+	} else if st.HalfOpenProbeRatio > 0 && st.UnlimitedHalfOpenRequests {
+		warn("HalfOpenProbeRatio", "HalfOpenProbeRatio has no effect with UnlimitedHalfOpenRequests")
+	}
+
+	if st.HalfOpenProbeInterval < 0 {
+		fail("HalfOpenProbeInterval", "HalfOpenProbeInterval is negative and will be ignored")
+	} else if st.HalfOpenProbeInterval > 0 && st.UnlimitedHalfOpenRequests {
+		warn("HalfOpenProbeInterval", "HalfOpenProbeInterval has no effect with UnlimitedHalfOpenRequests")
+	}
+
+	if st.HalfOpenSuccessThreshold < 0 || st.HalfOpenSuccessThreshold > 1 {
+		warn("HalfOpenSuccessThreshold", "HalfOpenSuccessThreshold is not between 0 and 1 and will be ignored")
+	}
+
+	if st.Interval < 0 {
+		fail("Interval", "Interval is negative and will be treated as 0, which never clears Counts")
+	}
+
+	if st.Timeout < 0 {
+		fail("Timeout", "Timeout is negative and will be coerced to %v", defaultTimeout)
+	}
+
+	if st.FailureRateThreshold != 0 && (st.FailureRateThreshold < 0 || st.FailureRateThreshold > 1) {
+		warn("FailureRateThreshold", "FailureRateThreshold is not between 0 and 1 and will be ignored")
+	} else if st.FailureRateThreshold != 0 && st.ReadyToTrip != nil {
+		warn("FailureRateThreshold", "FailureRateThreshold has no effect with ReadyToTrip")
+	}
+	if st.MinimumRequests > 0 && st.ReadyToTrip != nil {
+		warn("MinimumRequests", "MinimumRequests has no effect with ReadyToTrip")
+	}
+
+	switch {
+	case st.BucketPeriod < 0:
+		fail("BucketPeriod", "BucketPeriod is negative and will be ignored")
+	case st.BucketPeriod > 0 && st.Interval <= 0:
+		warn("BucketPeriod", "BucketPeriod has no effect without a positive Interval")
+	case st.BucketPeriod > 0 && st.Interval%st.BucketPeriod != 0:
+		warn("BucketPeriod", "BucketPeriod does not divide Interval, which will be rounded up to %v",
+			(st.Interval+st.BucketPeriod-1)/st.BucketPeriod*st.BucketPeriod)
+	}
+
+	if st.BucketDecay != 0 && (st.BucketDecay < 0 || st.BucketDecay >= 1) {
+		warn("BucketDecay", "BucketDecay is not between 0 and 1 and will be ignored")
+	} else if st.BucketDecay != 0 && (st.BucketPeriod <= 0 || st.Interval <= 0) {
+		warn("BucketDecay", "BucketDecay has no effect without the rolling window of BucketPeriod")
+	}
+
+	if st.HalfOpenMinBuckets > 1 && st.BucketPeriod <= 0 {
+		warn("HalfOpenMinBuckets", "HalfOpenMinBuckets has no effect without a positive BucketPeriod")
+	}
+
+	if st.MinClosedDuration < 0 {
+		fail("MinClosedDuration", "MinClosedDuration is negative and will be ignored")
+	}
+
+	if st.RampUpPeriod < 0 {
+		fail("RampUpPeriod", "RampUpPeriod is negative and will be ignored")
+	}
+	if st.RampUpInitialRatio < 0 || st.RampUpInitialRatio > 1 {
+		warn("RampUpInitialRatio", "RampUpInitialRatio is not between 0 and 1 and will be coerced to %v", defaultRampUpInitialRatio)
+	} else if st.RampUpInitialRatio > 0 && st.RampUpPeriod <= 0 {
+		warn("RampUpInitialRatio", "RampUpInitialRatio has no effect without a positive RampUpPeriod")
+	}
+
+	if st.SaturationBackoff < 0 {
+		fail("SaturationBackoff", "SaturationBackoff is negative and will be ignored")
+	} else if st.SaturationBackoff > 0 && st.SaturationBackoff <= 1 {
+		warn("SaturationBackoff", "SaturationBackoff is not greater than 1 and will be ignored")
+	}
+
+	if st.MaxSaturationTimeout < 0 {
+		fail("MaxSaturationTimeout", "MaxSaturationTimeout is negative and will be ignored")
+	} else if st.MaxSaturationTimeout > 0 && st.SaturationBackoff <= 1 {
+		warn("MaxSaturationTimeout", "MaxSaturationTimeout has no effect without SaturationBackoff greater than 1")
+	}
+
+	if st.MaxProbeAttempts > 0 && st.ManualRecovery {
+		warn("MaxProbeAttempts", "MaxProbeAttempts has no effect with ManualRecovery")
+	}
+
+	if st.EvalInterval < 0 {
+		fail("EvalInterval", "EvalInterval is negative and will be ignored")
+	}
+
+	if st.Classify != nil {
+		if st.IsSuccessful != nil {
+			warn("IsSuccessful", "IsSuccessful has no effect with Classify")
+		}
+		if st.IsSuccessfulResult != nil {
+			warn("IsSuccessfulResult", "IsSuccessfulResult has no effect with Classify")
+		}
+		if st.IsExcluded != nil {
+			warn("IsExcluded", "IsExcluded has no effect with Classify")
+		}
+		if st.IsExcludedResult != nil {
+			warn("IsExcludedResult", "IsExcludedResult has no effect with Classify")
+		}
+	}
+
+	if st.ResultMatters && st.IsSuccessfulResult == nil {
+		warn("ResultMatters", "ResultMatters has no effect without IsSuccessfulResult")
+	}
+
+	if st.ReadyToTripOnLatency != nil && !st.TrackLatency {
+		warn("ReadyToTripOnLatency", "ReadyToTripOnLatency has no effect without TrackLatency")
+	}
+
+	if st.OnWouldReject != nil && !st.ObserveOnly {
+		warn("OnWouldReject", "OnWouldReject is never called without ObserveOnly")
+	}
+
+	return issues
+}
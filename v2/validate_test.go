@@ -0,0 +1,170 @@
+package gobreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	valid := Settings{MaxRequests: 1}
+	assert.Empty(t, Validate(valid))
+	assert.Empty(t, Validate(Settings{
+		MaxRequests:          3,
+		Interval:             10 * time.Second,
+		Timeout:              time.Minute,
+		BucketPeriod:         time.Second,
+		BucketDecay:          0.5,
+		HalfOpenMinBuckets:   2,
+		SaturationBackoff:    2,
+		MaxSaturationTimeout: time.Hour,
+		ObserveOnly:          true,
+		OnWouldReject:        func(name string, err error) {},
+	}))
+
+	for _, c := range []struct {
+		modify func(st *Settings)
+		issue  ValidationIssue
+	}{
+		{
+			func(st *Settings) { st.MaxRequests = 0 },
+			ValidationIssue{"MaxRequests", SeverityWarning, "MaxRequests is 0 and will be coerced to 1"},
+		},
+		{
+			func(st *Settings) { st.HalfOpenProbeRatio = 1.5 },
+			ValidationIssue{"HalfOpenProbeRatio", SeverityWarning, "HalfOpenProbeRatio is not between 0 and 1 and will be ignored"},
+		},
+		{
+			func(st *Settings) { st.HalfOpenProbeInterval = -time.Second },
+			ValidationIssue{"HalfOpenProbeInterval", SeverityError, "HalfOpenProbeInterval is negative and will be ignored"},
+		},
+		{
+			func(st *Settings) { st.HalfOpenProbeRatio, st.UnlimitedHalfOpenRequests = 0.5, true },
+			ValidationIssue{"HalfOpenProbeRatio", SeverityWarning, "HalfOpenProbeRatio has no effect with UnlimitedHalfOpenRequests"},
+		},
+		{
+			func(st *Settings) { st.HalfOpenProbeInterval, st.UnlimitedHalfOpenRequests = time.Second, true },
+			ValidationIssue{"HalfOpenProbeInterval", SeverityWarning, "HalfOpenProbeInterval has no effect with UnlimitedHalfOpenRequests"},
+		},
+		{
+			func(st *Settings) { st.HalfOpenSuccessThreshold = 1.5 },
+			ValidationIssue{"HalfOpenSuccessThreshold", SeverityWarning, "HalfOpenSuccessThreshold is not between 0 and 1 and will be ignored"},
+		},
+		{
+			func(st *Settings) { st.Interval = -time.Second },
+			ValidationIssue{"Interval", SeverityError, "Interval is negative and will be treated as 0, which never clears Counts"},
+		},
+		{
+			func(st *Settings) { st.Timeout = -time.Second },
+			ValidationIssue{"Timeout", SeverityError, "Timeout is negative and will be coerced to 1m0s"},
+		},
+		{
+			func(st *Settings) { st.FailureRateThreshold = 1.5 },
+			ValidationIssue{"FailureRateThreshold", SeverityWarning, "FailureRateThreshold is not between 0 and 1 and will be ignored"},
+		},
+		{
+			func(st *Settings) { st.FailureRateThreshold, st.ReadyToTrip = 0.5, defaultReadyToTrip },
+			ValidationIssue{"FailureRateThreshold", SeverityWarning, "FailureRateThreshold has no effect with ReadyToTrip"},
+		},
+		{
+			func(st *Settings) { st.MinimumRequests, st.ReadyToTrip = 10, defaultReadyToTrip },
+			ValidationIssue{"MinimumRequests", SeverityWarning, "MinimumRequests has no effect with ReadyToTrip"},
+		},
+		{
+			func(st *Settings) { st.Interval, st.BucketPeriod = time.Second, -time.Second },
+			ValidationIssue{"BucketPeriod", SeverityError, "BucketPeriod is negative and will be ignored"},
+		},
+		{
+			func(st *Settings) { st.BucketPeriod = time.Second },
+			ValidationIssue{"BucketPeriod", SeverityWarning, "BucketPeriod has no effect without a positive Interval"},
+		},
+		{
+			func(st *Settings) { st.Interval, st.BucketPeriod = 10*time.Second, 3*time.Second },
+			ValidationIssue{"BucketPeriod", SeverityWarning, "BucketPeriod does not divide Interval, which will be rounded up to 12s"},
+		},
+		{
+			func(st *Settings) { st.Interval, st.BucketPeriod, st.BucketDecay = time.Second, time.Second, 1.5 },
+			ValidationIssue{"BucketDecay", SeverityWarning, "BucketDecay is not between 0 and 1 and will be ignored"},
+		},
+		{
+			func(st *Settings) { st.BucketDecay = 0.5 },
+			ValidationIssue{"BucketDecay", SeverityWarning, "BucketDecay has no effect without the rolling window of BucketPeriod"},
+		},
+		{
+			func(st *Settings) { st.HalfOpenMinBuckets = 2 },
+			ValidationIssue{"HalfOpenMinBuckets", SeverityWarning, "HalfOpenMinBuckets has no effect without a positive BucketPeriod"},
+		},
+		{
+			func(st *Settings) { st.MinClosedDuration = -time.Second },
+			ValidationIssue{"MinClosedDuration", SeverityError, "MinClosedDuration is negative and will be ignored"},
+		},
+		{
+			func(st *Settings) { st.RampUpPeriod = -time.Second },
+			ValidationIssue{"RampUpPeriod", SeverityError, "RampUpPeriod is negative and will be ignored"},
+		},
+		{
+			func(st *Settings) { st.RampUpPeriod, st.RampUpInitialRatio = time.Second, 2 },
+			ValidationIssue{"RampUpInitialRatio", SeverityWarning, "RampUpInitialRatio is not between 0 and 1 and will be coerced to 0.1"},
+		},
+		{
+			func(st *Settings) { st.RampUpInitialRatio = 0.5 },
+			ValidationIssue{"RampUpInitialRatio", SeverityWarning, "RampUpInitialRatio has no effect without a positive RampUpPeriod"},
+		},
+		{
+			func(st *Settings) { st.SaturationBackoff = -2 },
+			ValidationIssue{"SaturationBackoff", SeverityError, "SaturationBackoff is negative and will be ignored"},
+		},
+		{
+			func(st *Settings) { st.SaturationBackoff = 0.5 },
+			ValidationIssue{"SaturationBackoff", SeverityWarning, "SaturationBackoff is not greater than 1 and will be ignored"},
+		},
+		{
+			func(st *Settings) { st.SaturationBackoff, st.MaxSaturationTimeout = 2, -time.Second },
+			ValidationIssue{"MaxSaturationTimeout", SeverityError, "MaxSaturationTimeout is negative and will be ignored"},
+		},
+		{
+			func(st *Settings) { st.MaxSaturationTimeout = time.Hour },
+			ValidationIssue{"MaxSaturationTimeout", SeverityWarning, "MaxSaturationTimeout has no effect without SaturationBackoff greater than 1"},
+		},
+		{
+			func(st *Settings) { st.MaxProbeAttempts, st.ManualRecovery = 3, true },
+			ValidationIssue{"MaxProbeAttempts", SeverityWarning, "MaxProbeAttempts has no effect with ManualRecovery"},
+		},
+		{
+			func(st *Settings) { st.EvalInterval = -time.Second },
+			ValidationIssue{"EvalInterval", SeverityError, "EvalInterval is negative and will be ignored"},
+		},
+		{
+			func(st *Settings) {
+				st.Classify, st.IsExcluded = func(err error) Outcome { return OutcomeSuccess }, isExcluded
+			},
+			ValidationIssue{"IsExcluded", SeverityWarning, "IsExcluded has no effect with Classify"},
+		},
+		{
+			func(st *Settings) { st.ResultMatters = true },
+			ValidationIssue{"ResultMatters", SeverityWarning, "ResultMatters has no effect without IsSuccessfulResult"},
+		},
+		{
+			func(st *Settings) {
+				st.ReadyToTripOnLatency = func(counts Counts, latencies Latencies) bool { return false }
+			},
+			ValidationIssue{"ReadyToTripOnLatency", SeverityWarning, "ReadyToTripOnLatency has no effect without TrackLatency"},
+		},
+		{
+			func(st *Settings) { st.OnWouldReject = func(name string, err error) {} },
+			ValidationIssue{"OnWouldReject", SeverityWarning, "OnWouldReject is never called without ObserveOnly"},
+		},
+	} {
+		st := valid
+		c.modify(&st)
+		assert.Equal(t, []ValidationIssue{c.issue}, Validate(st))
+	}
+}
+
+func TestValidationIssueString(t *testing.T) {
+	issue := ValidationIssue{"Timeout", SeverityError, "Timeout is negative"}
+	assert.Equal(t, "error: Timeout: Timeout is negative", issue.String())
+	assert.Equal(t, "warning", SeverityWarning.String())
+	assert.Equal(t, "unknown severity: 2", Severity(2).String())
+}
@@ -0,0 +1,202 @@
+package gobreaker
+
+import (
+	"math"
+	"time"
+)
+
+// rollingCounts holds the Counts of the closed state per bucket of a rolling window.
+// The sum of the buckets is kept in the Counts of the CircuitBreaker,
+// from which the totals of a bucket are subtracted when the bucket is dropped.
+// The totals of the dropped buckets are accumulated in dropped.
+type rollingCounts struct {
+	period  time.Duration
+	start   time.Time
+	age     uint64
+	buckets []Counts
+	dropped Counts
+}
+
+// newRollingCounts returns a rolling window of the given interval
+// that consists of buckets of the given period.
+func newRollingCounts(interval, period time.Duration) *rollingCounts {
+	n := (interval + period - 1) / period
+	return &rollingCounts{
+		period:  period,
+		buckets: make([]Counts, n),
+	}
+}
+
+// bucketAge returns the number of whole periods elapsed from start to t,
+// rounding down when period doesn't divide the elapsed time.
+// Every instance sharing a rolling window computes the age with this function,
+// so that they agree on the bucket of a given time as long as they agree on start.
+// It returns 0 if t is before start, e.g. because of clock skew between instances,
+// or if period is not positive.
+func bucketAge(start, t time.Time, period time.Duration) uint64 {
+	elapsed := t.Sub(start)
+	if elapsed < 0 || period <= 0 {
+		return 0
+	}
+	return uint64(elapsed / period)
+}
+
+// bucketIndex returns the index of the bucket of the given age in a ring of n buckets.
+// It returns 0 if n is not positive.
+func bucketIndex(age uint64, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	return int(age % uint64(n))
+}
+
+// reset clears all the buckets and starts the window at now.
+func (rc *rollingCounts) reset(now time.Time) {
+	rc.start = now
+	rc.age = 0
+	rc.dropped.clear()
+	for i := range rc.buckets {
+		rc.buckets[i].clear()
+	}
+}
+
+// WindowInfo describes the closed-state rolling window of CircuitBreaker for diagnostics.
+// BucketPeriod is the period of a bucket and Start is when the window started.
+// Age is the number of whole periods of BucketPeriod elapsed since Start, i.e. the age of the newest bucket,
+// and Index is the index of the newest bucket in Buckets.
+// Buckets are the Counts of the buckets in the order of the ring, where the bucket of age a is at a % len(Buckets).
+// A bucket older than len(Buckets) periods has been dropped, and its index is reused by a newer bucket.
+// The window is started anew on every change of the generation of CircuitBreaker.
+type WindowInfo struct {
+	BucketPeriod time.Duration
+	Start        time.Time
+	Age          uint64
+	Index        int
+	Buckets      []Counts
+}
+
+// info returns the WindowInfo of the window advanced to now, leaving the window unchanged like peek.
+func (rc *rollingCounts) info(now time.Time) WindowInfo {
+	c := rc.clone()
+	c.rotate(now, new(Counts))
+	return WindowInfo{
+		BucketPeriod: c.period,
+		Start:        c.start,
+		Age:          c.age,
+		Index:        bucketIndex(c.age, len(c.buckets)),
+		Buckets:      c.buckets,
+	}
+}
+
+// clone returns a copy of the window.
+func (rc *rollingCounts) clone() *rollingCounts {
+	c := *rc
+	c.buckets = append([]Counts(nil), rc.buckets...)
+	return &c
+}
+
+// bucket returns the bucket of the given age, or nil if the bucket has been dropped.
+func (rc *rollingCounts) bucket(age uint64) *Counts {
+	n := uint64(len(rc.buckets))
+	if age > rc.age || rc.age-age >= n {
+		return nil
+	}
+	return &rc.buckets[bucketIndex(age, len(rc.buckets))]
+}
+
+// expire calls f with each bucket that is dropped when the window advances to the given age.
+func (rc *rollingCounts) expire(age uint64, f func(bucket *Counts)) {
+	expireBuckets(rc.age, age, len(rc.buckets), func(i int) {
+		f(&rc.buckets[i])
+	})
+}
+
+// expireBuckets calls f with the index of each bucket in a ring of n buckets
+// that is dropped when the newest bucket advances from the age of from to the age of to.
+func expireBuckets(from, to uint64, n int, f func(i int)) {
+	if to <= from {
+		return
+	}
+
+	first := from + 1
+	if to-from > uint64(n) {
+		first = to - uint64(n) + 1
+	}
+	for a := first; a <= to; a++ {
+		f(bucketIndex(a, n))
+	}
+}
+
+// rotate advances the window to now and subtracts the dropped buckets from counts.
+func (rc *rollingCounts) rotate(now time.Time, counts *Counts) {
+	age := bucketAge(rc.start, now, rc.period)
+	rc.expire(age, func(bucket *Counts) {
+		counts.subtract(*bucket)
+		rc.dropped.add(*bucket)
+		bucket.clear()
+	})
+	if age > rc.age {
+		rc.age = age
+	}
+}
+
+// peek is like rotate but leaves the window unchanged.
+func (rc *rollingCounts) peek(now time.Time, counts *Counts) {
+	age := bucketAge(rc.start, now, rc.period)
+	rc.expire(age, func(bucket *Counts) {
+		counts.subtract(*bucket)
+	})
+}
+
+// load replaces the window with the given buckets, e.g. read from the shared state.
+// If the number of buckets doesn't match, the window starts anew
+// with the totals of counts in the bucket of the given age.
+// The totals of the dropped buckets are cleared in either case.
+func (rc *rollingCounts) load(buckets []Counts, start time.Time, age uint64, counts Counts) {
+	rc.start = start
+	rc.age = age
+	rc.dropped.clear()
+	if len(buckets) == len(rc.buckets) {
+		copy(rc.buckets, buckets)
+		return
+	}
+
+	for i := range rc.buckets {
+		rc.buckets[i].clear()
+	}
+	bucket := rc.bucket(age)
+	bucket.Requests = counts.Requests
+	bucket.TotalSuccesses = counts.TotalSuccesses
+	bucket.TotalFailures = counts.TotalFailures
+	bucket.TotalExclusions = counts.TotalExclusions
+	bucket.TotalFailureWeight = counts.TotalFailureWeight
+}
+
+// weighted returns counts with the totals replaced by the sum of the buckets,
+// each weighted by decay to the power of its age relative to the newest bucket.
+// The weighted totals are rounded to the nearest integer, except for TotalFailureWeight,
+// and the consecutive counts of counts are capped by them.
+func (rc *rollingCounts) weighted(counts Counts, decay float64) Counts {
+	var requests, successes, failures, exclusions, failureWeight float64
+	weight := 1.0
+	for a := uint64(0); a < uint64(len(rc.buckets)) && a <= rc.age; a++ {
+		bucket := rc.buckets[bucketIndex(rc.age-a, len(rc.buckets))]
+		requests += weight * float64(bucket.Requests)
+		successes += weight * float64(bucket.TotalSuccesses)
+		failures += weight * float64(bucket.TotalFailures)
+		exclusions += weight * float64(bucket.TotalExclusions)
+		failureWeight += weight * bucket.TotalFailureWeight
+		weight *= decay
+	}
+
+	weighted := Counts{
+		Requests:           uint32(math.Round(min(requests, math.MaxUint32))),
+		TotalSuccesses:     uint32(math.Round(min(successes, math.MaxUint32))),
+		TotalFailures:      uint32(math.Round(min(failures, math.MaxUint32))),
+		TotalExclusions:    uint32(math.Round(min(exclusions, math.MaxUint32))),
+		TotalFailureWeight: failureWeight,
+	}
+	weighted.ConsecutiveSuccesses = min(counts.ConsecutiveSuccesses, weighted.TotalSuccesses)
+	weighted.ConsecutiveFailures = min(counts.ConsecutiveFailures, weighted.TotalFailures)
+	return weighted
+}
@@ -0,0 +1,137 @@
+package gobreaker
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketAge(t *testing.T) {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		elapsed time.Duration
+		period  time.Duration
+		age     uint64
+	}{
+		{0, time.Second, 0},
+		{time.Nanosecond, time.Second, 0},
+		{999 * time.Millisecond, time.Second, 0},
+		{time.Second, time.Second, 1},
+		{1500 * time.Millisecond, time.Second, 1},
+		{10 * time.Second, 3 * time.Second, 3},
+		{12 * time.Second, 3 * time.Second, 4},
+		{-time.Nanosecond, time.Second, 0},
+		{-time.Hour, time.Second, 0},
+		{time.Hour, 0, 0},
+		{time.Hour, -time.Second, 0},
+		{math.MaxInt64, time.Nanosecond, math.MaxInt64},
+		{math.MaxInt64, time.Second, uint64(math.MaxInt64 / int64(time.Second))},
+	} {
+		assert.Equal(t, c.age, bucketAge(start, start.Add(c.elapsed), c.period), "elapsed %v, period %v", c.elapsed, c.period)
+	}
+}
+
+func TestRollingCountsClockSkew(t *testing.T) {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	rc := newRollingCounts(3*time.Second, time.Second)
+	rc.load([]Counts{{1, 1, 0, 0, 0, 0, 0}, {1, 0, 1, 0, 0, 0, 1}, {1, 1, 0, 0, 0, 0, 0}}, start, 5, Counts{})
+	counts := Counts{3, 2, 1, 0, 0, 0, 1}
+
+	// an instance whose clock is behind the one that wrote the window doesn't move it back
+	rc.rotate(start.Add(4*time.Second), &counts)
+	assert.Equal(t, uint64(5), rc.age)
+	assert.Equal(t, Counts{3, 2, 1, 0, 0, 0, 1}, counts)
+	assert.NotNil(t, rc.bucket(5))
+
+	rc.rotate(start.Add(6*time.Second), &counts)
+	assert.Equal(t, uint64(6), rc.age)
+	assert.Equal(t, Counts{2, 1, 1, 0, 0, 0, 1}, counts)
+}
+
+func TestBucketIndex(t *testing.T) {
+	for _, c := range []struct {
+		age   uint64
+		n     int
+		index int
+	}{
+		{0, 3, 0},
+		{2, 3, 2},
+		{3, 3, 0},
+		{7, 3, 1},
+		{math.MaxUint64, 3, int(math.MaxUint64 % 3)},
+		{math.MaxUint64, 1, 0},
+		{5, 1, 0},
+		{5, 0, 0},
+		{5, -1, 0},
+	} {
+		assert.Equal(t, c.index, bucketIndex(c.age, c.n), "age %d, n %d", c.age, c.n)
+	}
+
+	// consecutive ages wrap around the ring
+	for age := uint64(0); age < 10; age++ {
+		assert.Equal(t, (bucketIndex(age, 4)+1)%4, bucketIndex(age+1, 4))
+	}
+}
+
+func TestRollingCounts(t *testing.T) {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	rc := newRollingCounts(2500*time.Millisecond, time.Second)
+	assert.Equal(t, 3, len(rc.buckets))
+	rc.reset(start)
+
+	var counts Counts
+	for i := 0; i < 3; i++ {
+		rc.rotate(start.Add(time.Duration(i)*time.Second), &counts)
+		counts.onRequest()
+		counts.onFailure()
+		bucket := rc.bucket(rc.age)
+		bucket.onRequest()
+		bucket.onFailure()
+	}
+	assert.Equal(t, Counts{3, 0, 3, 0, 3, 0, 3}, counts)
+	assert.Nil(t, rc.bucket(3))
+
+	peeked := counts
+	rc.peek(start.Add(4*time.Second), &peeked)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0, 1}, peeked)
+	assert.Equal(t, uint64(2), rc.age)
+
+	rc.rotate(start.Add(4*time.Second), &counts)
+	assert.Equal(t, peeked, counts)
+	assert.Nil(t, rc.bucket(1))
+	assert.NotNil(t, rc.bucket(2))
+
+	// far beyond the window
+	rc.rotate(start.Add(time.Hour), &counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0, 0}, counts)
+}
+
+func TestRollingCountsLoad(t *testing.T) {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	rc := newRollingCounts(2*time.Second, time.Second)
+
+	rc.load([]Counts{{1, 1, 0, 1, 0, 0, 0}, {2, 0, 2, 0, 2, 0, 2}}, start, 5, Counts{})
+	assert.Equal(t, []Counts{{1, 1, 0, 1, 0, 0, 0}, {2, 0, 2, 0, 2, 0, 2}}, rc.buckets)
+	assert.Equal(t, uint64(5), rc.age)
+
+	// a mismatching number of buckets starts the window anew from the totals
+	rc.load(nil, start, 5, Counts{3, 1, 2, 0, 2, 0, 2})
+	assert.Equal(t, []Counts{{0, 0, 0, 0, 0, 0, 0}, {3, 1, 2, 0, 0, 0, 2}}, rc.buckets)
+}
+
+func TestRollingCountsWeighted(t *testing.T) {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	rc := newRollingCounts(4*time.Second, time.Second)
+	rc.load([]Counts{{4, 0, 4, 0, 0, 0, 4}, {2, 2, 0, 0, 0, 0, 0}, {4, 0, 4, 0, 0, 0, 4}, {4, 0, 2, 0, 0, 2, 2}}, start, 5, Counts{})
+	counts := Counts{14, 2, 10, 0, 6, 2, 10}
+
+	// ages 5, 4, 3 and 2 are in the buckets 1, 0, 3 and 2
+	assert.Equal(t, counts, rc.weighted(counts, 1))
+	assert.Equal(t, Counts{6, 2, 3, 0, 3, 1, 3}, rc.weighted(counts, 0.5))
+
+	// a window younger than its buckets has no older buckets to weigh
+	rc.load([]Counts{{2, 0, 2, 0, 0, 0, 2}, {1, 0, 1, 0, 0, 0, 1}, {}, {}}, start, 1, Counts{})
+	assert.Equal(t, Counts{2, 0, 2, 0, 2, 0, 2}, rc.weighted(Counts{3, 0, 3, 0, 3, 0, 3}, 0.5))
+}